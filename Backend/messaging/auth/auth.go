@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrMissingToken = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid token")
+	ErrRevokedToken = errors.New("token has been revoked")
+)
+
+// Claims is the part of a users-service access token this service relies on.
+type Claims struct {
+	UserID      uint
+	JTI         string
+	ExpiresAt   time.Time
+	Role        string
+	Permissions []string
+}
+
+// Permissions the users service grants through roles, carried in the perms claim.
+const (
+	PermModerateListings   = "listings:moderate"
+	PermManageUsers        = "users:manage"
+	PermManageUniversities = "universities:manage"
+)
+
+// Can reports whether the token grants permission.
+func (c Claims) Can(permission string) bool {
+	for _, p := range c.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RevocationChecker reports whether a token was revoked (for example by logout).
+type RevocationChecker interface {
+	IsRevoked(token string, claims Claims) (bool, error)
+}
+
+// Authenticator validates access tokens issued by the users service. It only
+// holds public keys; tokens are signed by the users service alone.
+type Authenticator struct {
+	keys        KeySource
+	revocations RevocationChecker
+}
+
+// NewAuthenticator builds an Authenticator. A nil RevocationChecker skips revocation checks.
+func NewAuthenticator(keys KeySource, revocations RevocationChecker) *Authenticator {
+	return &Authenticator{keys: keys, revocations: revocations}
+}
+
+// NewAuthenticatorFromEnv fetches keys from JWKS_URL, defaulting to the JWKS
+// endpoint of USERS_SERVICE_URL, which is also used for revocation checks.
+func NewAuthenticatorFromEnv() *Authenticator {
+	usersURL := strings.TrimRight(os.Getenv("USERS_SERVICE_URL"), "/")
+	jwksURL := os.Getenv("JWKS_URL")
+	if jwksURL == "" && usersURL != "" {
+		jwksURL = usersURL + "/.well-known/jwks.json"
+	}
+	var keys KeySource = StaticKeys{}
+	if jwksURL != "" {
+		keys = NewJWKSKeySource(jwksURL)
+	} else {
+		log.Println("neither JWKS_URL nor USERS_SERVICE_URL is set, every authenticated request will be rejected")
+	}
+	var revocations RevocationChecker
+	if usersURL != "" {
+		revocations = NewUsersServiceChecker(usersURL)
+	} else {
+		log.Println("USERS_SERVICE_URL is not set, token revocation will not be checked")
+	}
+	return NewAuthenticator(keys, revocations)
+}
+
+// Verify parses and validates tokenString and checks that it has not been revoked.
+func (a *Authenticator) Verify(tokenString string) (Claims, error) {
+	mapClaims, err := a.parse(tokenString)
+	if err != nil {
+		return Claims{}, err
+	}
+	if use, _ := mapClaims["token_use"].(string); use == serviceTokenUse {
+		return Claims{}, ErrInvalidToken
+	}
+	claims, err := claimsFromMap(mapClaims)
+	if err != nil {
+		return Claims{}, err
+	}
+	if a.revocations != nil {
+		revoked, err := a.revocations.IsRevoked(tokenString, claims)
+		if err != nil {
+			return Claims{}, fmt.Errorf("checking revocation: %w", err)
+		}
+		if revoked {
+			return Claims{}, ErrRevokedToken
+		}
+	}
+	return claims, nil
+}
+
+// parse checks the signature and expiry of tokenString. Errors other than
+// ErrInvalidToken mean the signing keys could not be fetched.
+func (a *Authenticator) parse(tokenString string, opts ...jwt.ParserOption) (jwt.MapClaims, error) {
+	var keyErr error
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := a.keys.PublicKey(kid)
+		if err != nil {
+			keyErr = err
+			return nil, err
+		}
+		if !keyMatchesMethod(key, token.Method) {
+			return nil, ErrInvalidToken
+		}
+		return key, nil
+	}, append([]jwt.ParserOption{jwt.WithValidMethods(signingMethods), jwt.WithExpirationRequired()}, opts...)...)
+	if keyErr != nil && !errors.Is(keyErr, ErrUnknownKey) {
+		return nil, fmt.Errorf("resolving signing key: %w", keyErr)
+	}
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	mapClaims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return mapClaims, nil
+}
+
+var signingMethods = []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+
+func keyMatchesMethod(key crypto.PublicKey, method jwt.SigningMethod) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return method.Alg() == jwt.SigningMethodRS256.Alg()
+	case ed25519.PublicKey:
+		return method.Alg() == jwt.SigningMethodEdDSA.Alg()
+	}
+	return false
+}
+
+func claimsFromMap(m jwt.MapClaims) (Claims, error) {
+	var claims Claims
+	if sub, _ := m.GetSubject(); sub != "" {
+		id, err := strconv.ParseUint(sub, 10, 32)
+		if err != nil {
+			return Claims{}, ErrInvalidToken
+		}
+		claims.UserID = uint(id)
+	} else if user, ok := m["user"].(map[string]interface{}); ok {
+		// Tokens issued before the sub claim was added.
+		if id, ok := user["UserID"].(float64); ok && id > 0 {
+			claims.UserID = uint(id)
+		}
+	}
+	if claims.UserID == 0 {
+		return Claims{}, ErrInvalidToken
+	}
+	claims.JTI, _ = m["jti"].(string)
+	if exp, err := m.GetExpirationTime(); err == nil && exp != nil {
+		claims.ExpiresAt = exp.Time
+	}
+	claims.Role, _ = m["role"].(string)
+	if perms, ok := m["perms"].([]interface{}); ok {
+		for _, p := range perms {
+			if s, ok := p.(string); ok {
+				claims.Permissions = append(claims.Permissions, s)
+			}
+		}
+	}
+	return claims, nil
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>" header.
+func BearerToken(header string) (string, error) {
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || strings.TrimSpace(parts[1]) == "" {
+		return "", ErrMissingToken
+	}
+	return strings.TrimSpace(parts[1]), nil
+}
+
+type contextKey struct{}
+
+// ContextWithClaims returns a copy of ctx carrying the authenticated token's claims.
+func ContextWithClaims(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by the middleware.
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(Claims)
+	return claims, ok && claims.UserID > 0
+}
+
+// ContextWithUserID returns a copy of ctx carrying the authenticated user ID.
+func ContextWithUserID(ctx context.Context, userID uint) context.Context {
+	return ContextWithClaims(ctx, Claims{UserID: userID})
+}
+
+// UserIDFromContext returns the user ID stored by the middleware.
+func UserIDFromContext(ctx context.Context) (uint, bool) {
+	claims, ok := ClaimsFromContext(ctx)
+	return claims.UserID, ok
+}
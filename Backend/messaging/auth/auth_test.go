@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const testKeyID = "test-key"
+
+var testPublicKey, testPrivateKey, _ = ed25519.GenerateKey(rand.Reader)
+
+func signToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = testKeyID
+	signed, err := token.SignedString(testPrivateKey)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return signed
+}
+
+func testKeys() StaticKeys {
+	return StaticKeys{testKeyID: testPublicKey}
+}
+
+func TestVerify(t *testing.T) {
+	a := NewAuthenticator(testKeys(), nil)
+
+	claims, err := a.Verify(signToken(t, jwt.MapClaims{"sub": "42", "exp": time.Now().Add(time.Minute).Unix()}))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(42), claims.UserID)
+
+	_, err = a.Verify(signToken(t, jwt.MapClaims{"sub": "42", "exp": time.Now().Add(-time.Minute).Unix()}))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestJWKSKeySource(t *testing.T) {
+	users := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "OKP", "crv": "Ed25519", "kid": testKeyID, "use": "sig", "alg": "EdDSA",
+			"x": base64.RawURLEncoding.EncodeToString(testPublicKey),
+		}}})
+	}))
+	defer users.Close()
+
+	a := NewAuthenticator(NewJWKSKeySource(users.URL), nil)
+	claims, err := a.Verify(signToken(t, jwt.MapClaims{"sub": "11", "exp": time.Now().Add(time.Minute).Unix()}))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(11), claims.UserID)
+}
+
+func TestWebSocketMiddleware(t *testing.T) {
+	a := NewAuthenticator(testKeys(), nil)
+	var gotUserID uint
+	h := a.WebSocketMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUserID, _ = UserIDFromContext(r.Context())
+	}))
+
+	// The user_id query parameter alone no longer identifies the caller.
+	req := httptest.NewRequest(http.MethodGet, "/ws?user_id=3", nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	token := signToken(t, jwt.MapClaims{"sub": "5", "exp": time.Now().Add(time.Minute).Unix()})
+	req = httptest.NewRequest(http.MethodGet, "/ws?user_id=3&token="+token, nil)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, uint(5), gotUserID)
+}
+
+func TestClaimsCan(t *testing.T) {
+	a := NewAuthenticator(testKeys(), nil)
+	exp := time.Now().Add(time.Minute).Unix()
+
+	claims, err := a.Verify(signToken(t, jwt.MapClaims{"sub": "7", "exp": exp, "role": "moderator", "perms": []string{PermModerateListings}}))
+	assert.NoError(t, err)
+	assert.Equal(t, "moderator", claims.Role)
+	assert.True(t, claims.Can(PermModerateListings))
+	assert.False(t, claims.Can(PermManageUsers))
+
+	claims, err = a.Verify(signToken(t, jwt.MapClaims{"sub": "9", "exp": exp}))
+	assert.NoError(t, err)
+	assert.False(t, claims.Can(PermModerateListings))
+}
+
+func TestVerifyService(t *testing.T) {
+	a := NewAuthenticator(testKeys(), nil)
+	exp := time.Now().Add(time.Minute).Unix()
+
+	service := signToken(t, jwt.MapClaims{"sub": "service:users", "aud": "messaging", "token_use": "service", "scope": "users:sync", "exp": exp})
+	assert.NoError(t, a.VerifyService(service, ScopeUsersSync))
+	assert.ErrorIs(t, a.VerifyService(service, "messages:write"), ErrInsufficientScope)
+	_, err := a.Verify(service)
+	assert.ErrorIs(t, err, ErrInvalidToken, "service tokens do not identify a user")
+
+	otherAudience := signToken(t, jwt.MapClaims{"sub": "service:users", "aud": "products", "token_use": "service", "scope": "users:sync", "exp": exp})
+	assert.ErrorIs(t, a.VerifyService(otherAudience, ScopeUsersSync), ErrInvalidToken)
+
+	user := signToken(t, jwt.MapClaims{"sub": "42", "exp": exp})
+	assert.ErrorIs(t, a.VerifyService(user, ScopeUsersSync), ErrInvalidToken)
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+)
+
+// Middleware rejects requests without a valid bearer token and stores the
+// token's claims in the request context.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return a.middleware(next, false)
+}
+
+// WebSocketMiddleware is Middleware for WebSocket upgrades. Browsers cannot set
+// an Authorization header on the upgrade request, so the token may also be
+// passed in the "token" query parameter.
+func (a *Authenticator) WebSocketMiddleware(next http.Handler) http.Handler {
+	return a.middleware(next, true)
+}
+
+func (a *Authenticator) middleware(next http.Handler, allowQueryToken bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := BearerToken(r.Header.Get("Authorization"))
+		if err != nil && allowQueryToken && r.URL.Query().Get("token") != "" {
+			token, err = r.URL.Query().Get("token"), nil
+		}
+		if err != nil {
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		claims, err := a.Verify(token)
+		if err != nil {
+			if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrRevokedToken) {
+				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+				return
+			}
+			log.Printf("Error verifying token: %v", err)
+			http.Error(w, "Unable to verify token", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
+	})
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UsersServiceChecker asks the users service's /verifyjwt endpoint whether a
+// token is still valid. Answers are cached per jti: a revocation is
+// remembered until the token expires, a "still valid" answer for CacheTTL.
+type UsersServiceChecker struct {
+	BaseURL  string
+	Client   *http.Client
+	CacheTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedRevocation
+}
+
+type cachedRevocation struct {
+	revoked bool
+	until   time.Time
+}
+
+func NewUsersServiceChecker(baseURL string) *UsersServiceChecker {
+	return &UsersServiceChecker{
+		BaseURL:  strings.TrimRight(baseURL, "/"),
+		Client:   &http.Client{Timeout: 5 * time.Second},
+		CacheTTL: 30 * time.Second,
+		cache:    make(map[string]cachedRevocation),
+	}
+}
+
+func (c *UsersServiceChecker) IsRevoked(token string, claims Claims) (bool, error) {
+	now := time.Now()
+	if claims.JTI != "" {
+		c.mu.Lock()
+		entry, ok := c.cache[claims.JTI]
+		c.mu.Unlock()
+		if ok && now.Before(entry.until) {
+			return entry.revoked, nil
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.BaseURL+"/verifyjwt", nil)
+	if err != nil {
+		return false, fmt.Errorf("IsRevoked: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("IsRevoked: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var revoked bool
+	switch resp.StatusCode {
+	case http.StatusOK:
+		revoked = false
+	case http.StatusUnauthorized:
+		revoked = true
+	default:
+		return false, fmt.Errorf("IsRevoked: users service returned status %d", resp.StatusCode)
+	}
+
+	if claims.JTI != "" {
+		until := now.Add(c.CacheTTL)
+		if revoked {
+			until = claims.ExpiresAt
+		}
+		c.mu.Lock()
+		for jti, entry := range c.cache {
+			if now.After(entry.until) {
+				delete(c.cache, jti)
+			}
+		}
+		c.cache[claims.JTI] = cachedRevocation{revoked: revoked, until: until}
+		c.mu.Unlock()
+	}
+	return revoked, nil
+}
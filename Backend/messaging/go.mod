@@ -10,6 +10,8 @@ require (
 	github.com/stretchr/testify v1.10.0
 )
 
+require github.com/golang-jwt/jwt/v5 v5.2.1
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/google/uuid v1.6.0
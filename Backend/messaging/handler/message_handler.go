@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"time"
 
+	"messaging/auth"
 	"messaging/models"
 	"messaging/repository"
 	ws "messaging/websocket"
@@ -31,23 +32,21 @@ func NewMessageHandler(repo *repository.MessageRepository, ws *ws.WebSocketManag
 }
 
 func (h *MessageHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		http.Error(w, "Failed to upgrade to WebSocket", http.StatusInternalServerError)
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
 		return
 	}
 
-	userIDStr := r.URL.Query().Get("user_id")
-	userID, err := strconv.Atoi(userIDStr)
+	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println("Invalid user_id:", err)
-		conn.Close()
+		http.Error(w, "Failed to upgrade to WebSocket", http.StatusInternalServerError)
 		return
 	}
 
 	client := &ws.Client{
 		Conn:     conn,
-		UserID:   uint(userID),
+		UserID:   userID,
 		SendChan: make(chan models.Message, 256),
 		Manager:  h.ws,
 	}
@@ -62,12 +61,19 @@ func (h *MessageHandler) HandleSendMessage(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	senderID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
 	var msg models.Message
 	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	msg.SenderID = senderID
 	msg.Timestamp = time.Now().Unix()
 	msg.Read = false
 	msg.ID = uuid.New().String()
@@ -98,6 +104,16 @@ func (h *MessageHandler) GetConversationHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	if userID != uint(user1ID) && userID != uint(user2ID) {
+		http.Error(w, "Not a participant in this conversation", http.StatusForbidden)
+		return
+	}
+
 	conversations, err := h.repo.GetConversation(uint(user1ID), uint(user2ID))
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error getting conversation: %v", err), http.StatusInternalServerError)
@@ -109,14 +125,11 @@ func (h *MessageHandler) GetConversationHandler(w http.ResponseWriter, r *http.R
 }
 
 func (h *MessageHandler) GetUnreadSendersHandler(w http.ResponseWriter, r *http.Request) {
-	userIDStr := r.URL.Query().Get("user_id")
-	userIDInt, err := strconv.Atoi(userIDStr)
-	if err != nil {
-		log.Printf("Error parsing user_id query parameter '%s': %v", userIDStr, err)
-		http.Error(w, "Invalid or missing user_id query parameter", http.StatusBadRequest)
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
 		return
 	}
-	userID := uint(userIDInt)
 
 	senderIDs, err := h.repo.GetUnreadSenderIDs(userID)
 	if err != nil {
@@ -4,13 +4,16 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"messaging/auth"
 	"messaging/db"
 	"messaging/handler"
+	"messaging/migrations"
 	"messaging/repository"
 	"messaging/websocket"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -25,6 +28,11 @@ func main() {
 		log.Println("No .env file found or error loading .env")
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8000"
@@ -50,14 +58,16 @@ func main() {
 	msgHandler := handler.NewMessageHandler(msgRepo, wsManager)
 	userHandler := handler.NewUserHandler(userRepo)
 
+	authenticator := auth.NewAuthenticatorFromEnv()
+
 	r := mux.NewRouter()
 
-	r.HandleFunc("/ws", msgHandler.HandleWebSocket)
-	r.HandleFunc("/api/conversation/{user1ID}/{user2ID}", msgHandler.GetConversationHandler).Methods(http.MethodGet)
-	r.HandleFunc("/messages", msgHandler.HandleSendMessage).Methods(http.MethodPost)
-	r.HandleFunc("/users", userHandler.GetUsersHandler).Methods("GET")
-	r.HandleFunc("/api/users/sync", userHandler.SyncUserHandler).Methods(http.MethodPost)
-	r.HandleFunc("/api/unread-senders", msgHandler.GetUnreadSendersHandler).Methods(http.MethodGet)
+	r.Handle("/ws", authenticator.WebSocketMiddleware(http.HandlerFunc(msgHandler.HandleWebSocket)))
+	r.Handle("/api/conversation/{user1ID}/{user2ID}", authenticator.Middleware(http.HandlerFunc(msgHandler.GetConversationHandler))).Methods(http.MethodGet)
+	r.Handle("/messages", authenticator.Middleware(http.HandlerFunc(msgHandler.HandleSendMessage))).Methods(http.MethodPost)
+	r.Handle("/users", authenticator.Middleware(http.HandlerFunc(userHandler.GetUsersHandler))).Methods(http.MethodGet)
+	r.Handle("/internal/user-events", authenticator.ServiceMiddleware(auth.ScopeUsersSync, http.HandlerFunc(userHandler.UserEventHandler))).Methods(http.MethodPost)
+	r.Handle("/api/unread-senders", authenticator.Middleware(http.HandlerFunc(msgHandler.GetUnreadSendersHandler))).Methods(http.MethodGet)
 
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{allowedOrigin},
@@ -95,3 +105,56 @@ func main() {
 
 	fmt.Println("Server stopped gracefully")
 }
+
+// runMigrate implements `messaging migrate up|down [n]|status` against CHAT_DB_URI.
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		log.Fatal("Usage: messaging migrate up|down [n]|status")
+	}
+	database := db.ConnectDB()
+	defer database.Close()
+
+	m, err := migrations.New(database)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up()
+		for _, mig := range applied {
+			fmt.Printf("Applied %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				log.Fatalf("Invalid step count %q", args[1])
+			}
+		}
+		reverted, err := m.Down(steps)
+		for _, mig := range reverted {
+			fmt.Printf("Reverted %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		status, err := m.Status()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-24s %s\n", s.Version, s.Name, applied)
+		}
+	default:
+		log.Fatalf("Unknown migrate command %q, expected up, down or status", args[0])
+	}
+}
@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	m, err := New(nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, m.Migrations)
+	for i, mig := range m.Migrations {
+		assert.Equal(t, i+1, mig.Version, "migration versions must be contiguous")
+	}
+
+	var all strings.Builder
+	for _, mig := range m.Migrations {
+		all.WriteString(mig.Up)
+	}
+	for _, want := range []string{
+		"CREATE TABLE IF NOT EXISTS users",
+		"CREATE TABLE IF NOT EXISTS messages",
+		"ON messages (receiver_id, read)",
+		"ON messages (sender_id, receiver_id, timestamp)",
+	} {
+		assert.Contains(t, all.String(), want)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	list, err := Load(fstest.MapFS{
+		"0002_b.up.sql":   {Data: []byte("B")},
+		"0002_b.down.sql": {Data: []byte("-B")},
+		"0001_a.up.sql":   {Data: []byte("A")},
+		"0001_a.down.sql": {Data: []byte("-A")},
+		"notes.txt":       {Data: []byte("ignored")},
+	})
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, Migration{Version: 1, Name: "a", Up: "A", Down: "-A"}, list[0])
+	assert.Equal(t, "b", list[1].Name)
+
+	_, err = Load(fstest.MapFS{"0001_a.up.sql": {Data: []byte("A")}})
+	assert.Error(t, err, "missing down file")
+
+	_, err = Load(fstest.MapFS{"a.up.sql": {Data: []byte("A")}, "a.down.sql": {Data: []byte("-A")}})
+	assert.Error(t, err, "missing version")
+}
@@ -0,0 +1,17 @@
+-- The tables the messaging service was first deployed with. IF NOT EXISTS
+-- lets this run against databases created by hand before this file.
+CREATE TABLE IF NOT EXISTS users (
+    id    BIGSERIAL PRIMARY KEY,
+    name  VARCHAR(255) NOT NULL,
+    email VARCHAR(255) UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id          VARCHAR(255) PRIMARY KEY,
+    sender_id   BIGINT NOT NULL REFERENCES users(id),
+    receiver_id BIGINT NOT NULL REFERENCES users(id),
+    content     TEXT NOT NULL,
+    timestamp   BIGINT NOT NULL,
+    read        BOOLEAN NOT NULL DEFAULT false,
+    sender_name VARCHAR(255) NOT NULL
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_messages_conversation;
+DROP INDEX IF EXISTS idx_messages_receiver_read;
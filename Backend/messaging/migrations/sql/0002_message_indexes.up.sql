@@ -0,0 +1,4 @@
+-- Unread badges and GetUnreadSenderIDs filter on the receiver's unread messages.
+CREATE INDEX IF NOT EXISTS idx_messages_receiver_read ON messages (receiver_id, read);
+-- GetConversation reads one pair of participants in timestamp order.
+CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages (sender_id, receiver_id, timestamp);
@@ -0,0 +1,7 @@
+-- Users are kept in sync by events from the users service. source_version is
+-- the version of the last event applied to a row, so redelivered and
+-- out-of-order events are ignored. Deleted users become tombstones that keep
+-- their ID for existing messages but no personal data.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS source_version BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE users ALTER COLUMN email DROP NOT NULL;
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// User event types sent by the users service.
+const (
+	UserCreated = "user.created"
+	UserUpdated = "user.updated"
+	UserDeleted = "user.deleted"
+)
+
+// UserEvent is a change to a user in the users service. Version increases
+// with every event for the same user.
+type UserEvent struct {
+	EventID    string    `json:"event_id"`
+	Type       string    `json:"type"`
+	Version    int64     `json:"version"`
+	UserID     uint      `json:"user_id"`
+	PublicID   string    `json:"public_id,omitempty"`
+	Name       string    `json:"name,omitempty"`
+	Email      string    `json:"email,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
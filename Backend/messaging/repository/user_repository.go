@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"messaging/models"
+	"time"
 )
 
 // UserRepository struct will hold the database connection
@@ -12,47 +13,14 @@ type UserRepository struct {
 	DB *sql.DB
 }
 
-func (r *UserRepository) AddUser(id uint, name string, email string) error {
-	// Prepare the SQL statement for inserting a user
-	// Using Exec directly is fine for simple inserts like this
-	// Ensure your table name is 'users' and columns are 'id', 'name', 'email'
-	query := "INSERT INTO users (id, name, email) VALUES ($1, $2, $3)"
-	_, err := r.DB.Exec(query, id, name, email)
-	if err != nil {
-		// Log the error and return a wrapped error
-		// The handler will check for specific duplicate key errors (like pq.ErrCode unique_violation)
-		log.Printf("Error inserting user (ID: %d, Name: %s) into messaging db: %v", id, name, err)
-		return fmt.Errorf("failed to add user %d to messaging database: %w", id, err)
-	}
-
-	// Log success (optional)
-	// log.Printf("Successfully added user %d (%s) to messaging user table", id, name)
-	return nil // Return nil on success
-}
-
 // NewUserRepository creates a new instance of UserRepository
 func NewUserRepository(db *sql.DB) *UserRepository {
 	return &UserRepository{DB: db}
 }
 
-func (r *UserRepository) UserExists(id uint) (bool, error) {
-	var exists bool
-	// Use EXISTS for efficiency, it stops scanning once a match is found
-	query := "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)"
-	// Use QueryRowContext for context propagation if needed, otherwise QueryRow is fine
-	err := r.DB.QueryRow(query, id).Scan(&exists)
-	if err != nil {
-		// Don't log sql.ErrNoRows as an error here, QueryRow handles it.
-		// EXISTS query always returns a row (true or false).
-		log.Printf("Error checking existence for user ID %d: %v", id, err)
-		return false, fmt.Errorf("failed to check user existence for ID %d: %w", id, err)
-	}
-	return exists, nil
-}
-
 // GetAllUsers retrieves all users from the database
 func (r *UserRepository) GetAllUsers() ([]models.User, error) {
-	rows, err := r.DB.Query("SELECT id, name, email FROM users")
+	rows, err := r.DB.Query("SELECT id, name, COALESCE(email, '') FROM users WHERE deleted_at IS NULL")
 	if err != nil {
 		log.Println("Error fetching users:", err)
 		return nil, err
@@ -77,3 +45,53 @@ func (r *UserRepository) GetAllUsers() ([]models.User, error) {
 
 	return users, nil
 }
+
+// ApplyUserEvent applies a user event from the users service. Created and
+// updated events upsert the user; deleted events leave a tombstone so existing
+// messages still resolve. Events not newer than the row's source_version were
+// already applied and are ignored, which makes redelivery harmless. It reports
+// whether the row changed.
+func (r *UserRepository) ApplyUserEvent(ev models.UserEvent) (bool, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to apply user event %s: %w", ev.EventID, err)
+	}
+	defer tx.Rollback()
+
+	var current int64
+	err = tx.QueryRow("SELECT source_version FROM users WHERE id = $1 FOR UPDATE", ev.UserID).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("failed to apply user event %s: %w", ev.EventID, err)
+	}
+	if err == nil && current >= ev.Version {
+		return false, nil
+	}
+
+	var name, email interface{} = ev.Name, ev.Email
+	var deletedAt interface{}
+	if ev.Type == models.UserDeleted {
+		name, email, deletedAt = "Deleted user", nil, time.Now().UTC()
+	} else {
+		// The users service owns email addresses; a row still holding this
+		// one belongs to an account that has since changed or lost it.
+		if _, err := tx.Exec("UPDATE users SET email = NULL WHERE email = $1 AND id <> $2", ev.Email, ev.UserID); err != nil {
+			return false, fmt.Errorf("failed to apply user event %s: %w", ev.EventID, err)
+		}
+	}
+	res, err := tx.Exec(`
+        INSERT INTO users (id, name, email, source_version, deleted_at)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (id) DO UPDATE
+        SET name = EXCLUDED.name, email = EXCLUDED.email,
+            source_version = EXCLUDED.source_version, deleted_at = EXCLUDED.deleted_at
+        WHERE users.source_version < EXCLUDED.source_version`,
+		ev.UserID, name, email, ev.Version, deletedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to apply user event %s: %w", ev.EventID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to apply user event %s: %w", ev.EventID, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const testKeyID = "test-key"
+
+var testPublicKey, testPrivateKey, _ = ed25519.GenerateKey(rand.Reader)
+
+func signToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = testKeyID
+	signed, err := token.SignedString(testPrivateKey)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return signed
+}
+
+func testKeys() StaticKeys {
+	return StaticKeys{testKeyID: testPublicKey}
+}
+
+func TestVerify(t *testing.T) {
+	a := NewAuthenticator(testKeys(), nil)
+
+	token := signToken(t, jwt.MapClaims{"sub": "42", "jti": "abc", "exp": time.Now().Add(time.Minute).Unix()})
+	claims, err := a.Verify(token)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, claims.UserID)
+	assert.Equal(t, "abc", claims.JTI)
+
+	legacy := signToken(t, jwt.MapClaims{"user": map[string]interface{}{"UserID": 7}, "exp": time.Now().Add(time.Minute).Unix()})
+	claims, err = a.Verify(legacy)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, claims.UserID)
+
+	expired := signToken(t, jwt.MapClaims{"sub": "42", "exp": time.Now().Add(-time.Minute).Unix()})
+	_, err = a.Verify(expired)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	forged := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"sub": "42", "exp": time.Now().Add(time.Minute).Unix()})
+	forged.Header["kid"] = testKeyID
+	forgedString, _ := forged.SignedString(otherKey)
+	_, err = a.Verify(forgedString)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Shared-secret tokens are not accepted, even with a known kid.
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "42", "exp": time.Now().Add(time.Minute).Unix()})
+	hmac.Header["kid"] = testKeyID
+	hmacString, _ := hmac.SignedString([]byte("testsecret"))
+	_, err = a.Verify(hmacString)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestJWKSKeySource(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	published := []map[string]string{{
+		"kty": "OKP", "crv": "Ed25519", "kid": testKeyID, "use": "sig", "alg": "EdDSA",
+		"x": base64.RawURLEncoding.EncodeToString(testPublicKey),
+	}}
+	fetches := 0
+	users := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": published})
+	}))
+	defer users.Close()
+
+	source := NewJWKSKeySource(users.URL)
+	source.MinRefreshInterval = 0
+	a := NewAuthenticator(source, nil)
+
+	claims, err := a.Verify(signToken(t, jwt.MapClaims{"sub": "42", "exp": time.Now().Add(time.Minute).Unix()}))
+	assert.NoError(t, err)
+	assert.Equal(t, 42, claims.UserID)
+	_, _ = a.Verify(signToken(t, jwt.MapClaims{"sub": "42", "exp": time.Now().Add(time.Minute).Unix()}))
+	assert.Equal(t, 1, fetches, "keys are cached")
+
+	// A key rotated in on the users service is picked up on first sight of its kid.
+	published = append(published, map[string]string{
+		"kty": "RSA", "kid": "rotated", "use": "sig", "alg": "RS256",
+		"n": base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+	})
+	rotated := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "8", "exp": time.Now().Add(time.Minute).Unix()})
+	rotated.Header["kid"] = "rotated"
+	rotatedString, _ := rotated.SignedString(rsaKey)
+	claims, err = a.Verify(rotatedString)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, claims.UserID)
+	assert.Equal(t, 2, fetches)
+
+	unknown := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "8", "exp": time.Now().Add(time.Minute).Unix()})
+	unknown.Header["kid"] = "nope"
+	unknownString, _ := unknown.SignedString(rsaKey)
+	_, err = a.Verify(unknownString)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestMiddleware(t *testing.T) {
+	a := NewAuthenticator(testKeys(), nil)
+	var gotUserID int
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUserID, _ = UserIDFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/products", nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/products", nil)
+	req.Header.Set("Authorization", "Bearer "+signToken(t, jwt.MapClaims{"sub": "9", "exp": time.Now().Add(time.Minute).Unix()}))
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 9, gotUserID)
+}
+
+func TestRequirePermission(t *testing.T) {
+	a := NewAuthenticator(testKeys(), nil)
+	var got Claims
+	h := a.RequirePermission(PermModerateListings, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = ClaimsFromContext(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	request := func(claims jwt.MapClaims) int {
+		req := httptest.NewRequest(http.MethodDelete, "/moderation/products/1/p1", nil)
+		req.Header.Set("Authorization", "Bearer "+signToken(t, claims))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	exp := time.Now().Add(time.Minute).Unix()
+
+	assert.Equal(t, http.StatusForbidden, request(jwt.MapClaims{"sub": "9", "exp": exp, "role": "student"}))
+	assert.Equal(t, http.StatusForbidden, request(jwt.MapClaims{"sub": "9", "exp": exp}), "tokens from before roles grant nothing")
+	assert.Equal(t, http.StatusNoContent, request(jwt.MapClaims{"sub": "7", "exp": exp, "role": "moderator", "perms": []string{PermModerateListings}}))
+	assert.Equal(t, 7, got.UserID)
+	assert.Equal(t, "moderator", got.Role)
+	assert.True(t, got.Can(PermModerateListings))
+	assert.False(t, got.Can(PermManageUsers))
+
+	req := httptest.NewRequest(http.MethodDelete, "/moderation/products/1/p1", nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestUsersServiceChecker(t *testing.T) {
+	calls := 0
+	users := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Equal(t, "/verifyjwt", r.URL.Path)
+		if r.Header.Get("Authorization") == "Bearer revoked" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer users.Close()
+
+	checker := NewUsersServiceChecker(users.URL)
+	exp := time.Now().Add(time.Minute)
+
+	revoked, err := checker.IsRevoked("valid", Claims{JTI: "a", ExpiresAt: exp})
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	revoked, err = checker.IsRevoked("revoked", Claims{JTI: "b", ExpiresAt: exp})
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	// Answers are cached per jti.
+	_, _ = checker.IsRevoked("valid", Claims{JTI: "a", ExpiresAt: exp})
+	_, _ = checker.IsRevoked("revoked", Claims{JTI: "b", ExpiresAt: exp})
+	assert.Equal(t, 2, calls)
+}
+
+func TestVerifyService(t *testing.T) {
+	a := NewAuthenticator(testKeys(), nil)
+	exp := time.Now().Add(time.Minute).Unix()
+
+	service := signToken(t, jwt.MapClaims{"sub": "service:users", "aud": "products", "token_use": "service", "scope": "users:sync", "exp": exp})
+	assert.NoError(t, a.VerifyService(service, ScopeUsersSync))
+	assert.ErrorIs(t, a.VerifyService(service, "products:write"), ErrInsufficientScope)
+	_, err := a.Verify(service)
+	assert.ErrorIs(t, err, ErrInvalidToken, "service tokens do not identify a user")
+
+	otherAudience := signToken(t, jwt.MapClaims{"sub": "service:users", "aud": "messaging", "token_use": "service", "scope": "users:sync", "exp": exp})
+	assert.ErrorIs(t, a.VerifyService(otherAudience, ScopeUsersSync), ErrInvalidToken)
+
+	user := signToken(t, jwt.MapClaims{"sub": "42", "exp": exp})
+	assert.ErrorIs(t, a.VerifyService(user, ScopeUsersSync), ErrInvalidToken)
+}
@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrUnknownKey is returned when a token names a kid the key source does not know.
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// KeySource resolves the public key a token's kid header refers to.
+type KeySource interface {
+	PublicKey(kid string) (crypto.PublicKey, error)
+}
+
+// StaticKeys is a fixed set of verification keys, keyed by kid.
+type StaticKeys map[string]crypto.PublicKey
+
+func (k StaticKeys) PublicKey(kid string) (crypto.PublicKey, error) {
+	key, ok := k[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// JWKSKeySource fetches verification keys from the users service's
+// /.well-known/jwks.json. Keys are cached for CacheTTL; an unknown kid triggers
+// an early refresh, at most once per MinRefreshInterval, so newly rotated keys
+// are picked up without hammering the users service with forged kids.
+type JWKSKeySource struct {
+	URL                string
+	Client             *http.Client
+	CacheTTL           time.Duration
+	MinRefreshInterval time.Duration
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	lastFetch   time.Time
+	lastAttempt time.Time
+}
+
+func NewJWKSKeySource(url string) *JWKSKeySource {
+	return &JWKSKeySource{
+		URL:                url,
+		Client:             &http.Client{Timeout: 5 * time.Second},
+		CacheTTL:           10 * time.Minute,
+		MinRefreshInterval: time.Minute,
+	}
+}
+
+func (s *JWKSKeySource) PublicKey(kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if key, ok := s.keys[kid]; ok && now.Sub(s.lastFetch) <= s.CacheTTL {
+		return key, nil
+	}
+	var fetchErr error
+	if now.Sub(s.lastAttempt) >= s.MinRefreshInterval {
+		s.lastAttempt = now
+		keys, err := s.fetch()
+		if err == nil {
+			s.keys = keys
+			s.lastFetch = now
+		}
+		fetchErr = err
+	}
+	// Known keys keep working while the users service is unreachable.
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+	return nil, ErrUnknownKey
+}
+
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+}
+
+func (s *JWKSKeySource) fetch() (map[string]crypto.PublicKey, error) {
+	resp, err := s.Client.Get(s.URL)
+	if err != nil {
+		return nil, fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching JWKS: users service returned status %d", resp.StatusCode)
+	}
+
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decoding JWKS: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("decoding JWKS key %q: %w", k.KeyID, err)
+		}
+		keys[k.KeyID] = key
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch {
+	case k.KeyType == "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case k.KeyType == "OKP" && k.Curve == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key length")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
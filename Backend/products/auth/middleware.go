@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"web-service/model"
+)
+
+// Middleware rejects requests without a valid bearer token and stores the
+// token's claims, including the authenticated user ID, in the request context.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := BearerToken(r.Header.Get("Authorization"))
+		if err != nil {
+			writeAuthError(w, http.StatusUnauthorized, "Authentication required", err)
+			return
+		}
+		claims, err := a.Verify(token)
+		if err != nil {
+			status := http.StatusUnauthorized
+			if !errors.Is(err, ErrInvalidToken) && !errors.Is(err, ErrRevokedToken) {
+				status = http.StatusServiceUnavailable
+			}
+			writeAuthError(w, status, "Invalid or expired token", err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
+	})
+}
+
+// RequirePermission is Middleware that also requires the token to grant permission.
+func (a *Authenticator) RequirePermission(permission string, next http.Handler) http.Handler {
+	return a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := ClaimsFromContext(r.Context())
+		if !claims.Can(permission) {
+			writeAuthError(w, http.StatusForbidden, "Forbidden", fmt.Errorf("the %s permission is required", permission))
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+func writeAuthError(w http.ResponseWriter, statusCode int, message string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	response := model.ErrorResponse{Error: message, Details: err.Error()}
+	if encodeErr := json.NewEncoder(w).Encode(response); encodeErr != nil {
+		log.Printf("Error encoding JSON response: %v\n", encodeErr)
+	}
+	log.Printf("HTTP Error: Status=%d, Message=\"%s\", Error=\"%v\"", statusCode, message, err)
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ServiceAudience is the aud claim the users service puts in tokens meant for
+// this service.
+const ServiceAudience = "products"
+
+// ScopeUsersSync lets the users service push user events.
+const ScopeUsersSync = "users:sync"
+
+const serviceTokenUse = "service"
+
+var ErrInsufficientScope = errors.New("token lacks the required scope")
+
+// VerifyService validates a token the users service issued for its own calls
+// to this service and checks that it grants scope. User access tokens are rejected.
+func (a *Authenticator) VerifyService(tokenString, scope string) error {
+	claims, err := a.parse(tokenString, jwt.WithAudience(ServiceAudience))
+	if err != nil {
+		return err
+	}
+	if use, _ := claims["token_use"].(string); use != serviceTokenUse {
+		return ErrInvalidToken
+	}
+	granted, _ := claims["scope"].(string)
+	for _, s := range strings.Fields(granted) {
+		if s == scope {
+			return nil
+		}
+	}
+	return ErrInsufficientScope
+}
+
+// ServiceMiddleware only lets through requests carrying a service token with scope.
+func (a *Authenticator) ServiceMiddleware(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := BearerToken(r.Header.Get("Authorization"))
+		if err != nil {
+			writeAuthError(w, http.StatusUnauthorized, "Authentication required", err)
+			return
+		}
+		if err := a.VerifyService(token, scope); err != nil {
+			switch {
+			case errors.Is(err, ErrInsufficientScope):
+				writeAuthError(w, http.StatusForbidden, "Forbidden", err)
+			case errors.Is(err, ErrInvalidToken):
+				writeAuthError(w, http.StatusUnauthorized, "Invalid or expired token", err)
+			default:
+				writeAuthError(w, http.StatusServiceUnavailable, "Unable to verify token", err)
+			}
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
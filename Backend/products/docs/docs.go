@@ -18,6 +18,71 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/moderation/products/{userId}/{productId}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Delete any user's product and its image. Requires a token whose role grants the listings:moderate permission.",
+                "tags": [
+                    "Moderation"
+                ],
+                "summary": "Remove a listing as a moderator",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID of the user who listed the product",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Product ID",
+                        "name": "productId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Product removed"
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid access token",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Token lacks the listings:moderate permission",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Product not found",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/products": {
             "get": {
                 "description": "Fetch all products from the system, regardless of the user ID. If no products are found, an error is returned.",
@@ -70,7 +135,12 @@ const docTemplate = `{
                 }
             },
             "post": {
-                "description": "Creates a new product by parsing form data, uploading images to S3, and saving it to the database. The product is linked to the user via their User ID.",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Creates a new product by parsing form data, uploading images to S3, and saving it to the database. The product is linked to the user identified by the bearer token.",
                 "consumes": [
                     "multipart/form-data"
                 ],
@@ -82,13 +152,6 @@ const docTemplate = `{
                 ],
                 "summary": "Create a new product",
                 "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "User ID (form data)",
-                        "name": "UserId",
-                        "in": "formData",
-                        "required": true
-                    },
                     {
                         "type": "string",
                         "description": "Product title",
@@ -139,7 +202,13 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Invalid User ID or form data",
+                        "description": "Invalid form data",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid access token",
                         "schema": {
                             "$ref": "#/definitions/model.ErrorResponse"
                         }
@@ -220,7 +289,12 @@ const docTemplate = `{
         },
         "/products/{userId}/{productId}": {
             "put": {
-                "description": "Update a product's details based on the user ID and product ID. The product image is also updated if provided.",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Update a product's details based on the user ID and product ID. The product image is also updated if provided. The user ID must match the bearer token.",
                 "consumes": [
                     "application/json"
                 ],
@@ -269,6 +343,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/model.ErrorResponse"
                         }
                     },
+                    "401": {
+                        "description": "Missing or invalid access token",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Product belongs to another user",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
                     "404": {
                         "description": "Product not found",
                         "schema": {
@@ -284,7 +370,12 @@ const docTemplate = `{
                 }
             },
             "delete": {
-                "description": "Delete a product from the system based on the user ID and product ID. This also removes the associated image from S3 if available.",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Delete a product from the system based on the user ID and product ID. This also removes the associated image from S3 if available. The user ID must match the bearer token.",
                 "tags": [
                     "Products"
                 ],
@@ -315,6 +406,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/model.ErrorResponse"
                         }
                     },
+                    "401": {
+                        "description": "Missing or invalid access token",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Product belongs to another user",
+                        "schema": {
+                            "$ref": "#/definitions/model.ErrorResponse"
+                        }
+                    },
                     "404": {
                         "description": "Product not found",
                         "schema": {
@@ -445,6 +548,11 @@ const docTemplate = `{
                     "type": "string",
                     "example": "Laptop"
                 },
+                "sellerPhoneVerified": {
+                    "description": "Joined from the seller when products are read; never stored",
+                    "type": "boolean",
+                    "example": true
+                },
                 "userId": {
                     "description": "Unique user ID",
                     "type": "integer",
@@ -452,6 +560,14 @@ const docTemplate = `{
                 }
             }
         }
+    },
+    "securityDefinitions": {
+        "BearerAuth": {
+            "description": "Users-service access token, sent as \"Bearer \u003ctoken\u003e\".",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        }
     }
 }`
 
@@ -97,3 +97,31 @@ func NewBadRequestError(message string, cause error) *BadRequestError {
 		},
 	}
 }
+
+type UnauthorizedError struct {
+	*CustomError
+}
+
+func NewUnauthorizedError(message string, cause error) *UnauthorizedError {
+	return &UnauthorizedError{
+		&CustomError{
+			Message:    message,
+			StatusCode: http.StatusUnauthorized,
+			Cause:      cause,
+		},
+	}
+}
+
+type ForbiddenError struct {
+	*CustomError
+}
+
+func NewForbiddenError(message string, cause error) *ForbiddenError {
+	return &ForbiddenError{
+		&CustomError{
+			Message:    message,
+			StatusCode: http.StatusForbidden,
+			Cause:      cause,
+		},
+	}
+}
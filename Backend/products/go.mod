@@ -20,6 +20,8 @@ require (
 	gopkg.in/validator.v2 v2.0.1
 )
 
+require github.com/golang-jwt/jwt/v5 v5.2.1
+
 require (
 	github.com/KyleBanks/depth v1.2.1 // indirect
 	github.com/PuerkitoBio/purell v1.1.1 // indirect
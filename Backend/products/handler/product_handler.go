@@ -4,8 +4,11 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"strconv"
 	"sync"
 
+	"web-service/auth"
+	customerrors "web-service/errors"
 	"web-service/helper"
 	"web-service/model"
 	"web-service/repository"
@@ -16,6 +19,9 @@ import (
 type ProductHandler struct {
 	ProductRepo repository.ProductRepository
 	ImageRepo   repository.ImageRepository
+	// SellerRepo keeps the seller details products show, such as the
+	// verified-phone badge. Without it user updates are ignored.
+	SellerRepo repository.SellerRepository
 }
 
 func NewProductHandler(productRepo repository.ProductRepository, imageRepo repository.ImageRepository) *ProductHandler {
@@ -26,11 +32,11 @@ func NewProductHandler(productRepo repository.ProductRepository, imageRepo repos
 }
 
 // @Summary Create a new product
-// @Description Creates a new product by parsing form data, uploading images to S3, and saving it to the database. The product is linked to the user via their User ID.
+// @Description Creates a new product by parsing form data, uploading images to S3, and saving it to the database. The product is linked to the user identified by the bearer token.
 // @Tags Products
 // @Accept multipart/form-data
 // @Produce json
-// @Param UserId formData int true "User ID (form data)"
+// @Security BearerAuth
 // @Param productTitle formData string true "Product title"
 // @Param productDescription formData string false "Product description"
 // @Param productPrice formData float64 true "Product price"
@@ -38,15 +44,17 @@ func NewProductHandler(productRepo repository.ProductRepository, imageRepo repos
 // @Param productLocation formData string true "Product location"
 // @Param productImage formData file true "Product image"
 // @Success 201 {object} model.Product "Product created successfully"
-// @Failure 400 {object} model.ErrorResponse "Invalid User ID or form data"
+// @Failure 400 {object} model.ErrorResponse "Invalid form data"
+// @Failure 401 {object} model.ErrorResponse "Missing or invalid access token"
 // @Failure 500 {object} model.ErrorResponse "Internal server error"
 // @Router /products [post]
 func (h *ProductHandler) CreateProductHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Received request to create a new product.")
 
-	userID, err := helper.GetUserID(r.FormValue("userId"))
+	// The owner is always the authenticated user; a userId form field is ignored.
+	userID, err := authenticatedUserID(r)
 	if err != nil {
-		HandleError(w, err, "Invalid userId")
+		HandleError(w, err, "Authentication required")
 		return
 	}
 
@@ -55,7 +63,6 @@ func (h *ProductHandler) CreateProductHandler(w http.ResponseWriter, r *http.Req
 		HandleError(w, err, "Error creating product")
 		return
 	}
-	product.UserID = userID
 
 	s3ImageKey, err := h.handleProductImageUpload(w, r, &product)
 	if err != nil {
@@ -143,22 +150,25 @@ func (h *ProductHandler) GetAllProductsByUserIDHandler(w http.ResponseWriter, r
 }
 
 // @Summary Update a product by user ID and product ID
-// @Description Update a product's details based on the user ID and product ID. The product image is also updated if provided.
+// @Description Update a product's details based on the user ID and product ID. The product image is also updated if provided. The user ID must match the bearer token.
 // @Tags Products
 // @Accept json
 // @Produce json
+// @Security BearerAuth
 // @Param userId path int true "User ID"
 // @Param productId path string true "Product ID"
 // @Param product body model.Product true "Product Details"
 // @Success 200 {object} model.Product "Updated product"
 // @Failure 400 {object} model.ErrorResponse "Invalid request"
+// @Failure 401 {object} model.ErrorResponse "Missing or invalid access token"
+// @Failure 403 {object} model.ErrorResponse "Product belongs to another user"
 // @Failure 404 {object} model.ErrorResponse "Product not found"
 // @Failure 500 {object} model.ErrorResponse "Internal Server Error"
 // @Router /products/{userId}/{productId} [put]
 func (h *ProductHandler) UpdateProductHandler(w http.ResponseWriter, r *http.Request) {
-	userId, err := helper.GetUserID(mux.Vars(r)["UserId"])
+	userId, err := authorizeOwner(r)
 	if err != nil {
-		HandleError(w, err, "Invalid userId")
+		HandleError(w, err, "Not allowed to update this product")
 		return
 	}
 
@@ -233,19 +243,22 @@ func (h *ProductHandler) UpdateProductHandler(w http.ResponseWriter, r *http.Req
 }
 
 // @Summary Delete a product by user ID and product ID
-// @Description Delete a product from the system based on the user ID and product ID. This also removes the associated image from S3 if available.
+// @Description Delete a product from the system based on the user ID and product ID. This also removes the associated image from S3 if available. The user ID must match the bearer token.
 // @Tags Products
+// @Security BearerAuth
 // @Param userId path int true "User ID"
 // @Param productId path string true "Product ID"
 // @Success 204 "Product deleted"
 // @Failure 400 {object} model.ErrorResponse "Invalid request"
+// @Failure 401 {object} model.ErrorResponse "Missing or invalid access token"
+// @Failure 403 {object} model.ErrorResponse "Product belongs to another user"
 // @Failure 404 {object} model.ErrorResponse "Product not found"
 // @Failure 500 {object} model.ErrorResponse "Internal Server Error"
 // @Router /products/{userId}/{productId} [delete]
 func (h *ProductHandler) DeleteProductHandler(w http.ResponseWriter, r *http.Request) {
-	userId, err := helper.GetUserID(mux.Vars(r)["UserId"])
+	userId, err := authorizeOwner(r)
 	if err != nil {
-		HandleError(w, err, "Invalid userId")
+		HandleError(w, err, "Not allowed to delete this product")
 		return
 	}
 
@@ -256,7 +269,45 @@ func (h *ProductHandler) DeleteProductHandler(w http.ResponseWriter, r *http.Req
 	}
 
 	log.Printf("Received request to delete product with ID: %s by user %d\n", productId, userId)
+	h.deleteProduct(w, userId, productId)
+}
 
+// @Summary Remove a listing as a moderator
+// @Description Delete any user's product and its image. Requires a token whose role grants the listings:moderate permission.
+// @Tags Moderation
+// @Security BearerAuth
+// @Param userId path int true "ID of the user who listed the product"
+// @Param productId path string true "Product ID"
+// @Success 204 "Product removed"
+// @Failure 400 {object} model.ErrorResponse "Invalid request"
+// @Failure 401 {object} model.ErrorResponse "Missing or invalid access token"
+// @Failure 403 {object} model.ErrorResponse "Token lacks the listings:moderate permission"
+// @Failure 404 {object} model.ErrorResponse "Product not found"
+// @Failure 500 {object} model.ErrorResponse "Internal Server Error"
+// @Router /moderation/products/{userId}/{productId} [delete]
+func (h *ProductHandler) ModerateDeleteProductHandler(w http.ResponseWriter, r *http.Request) {
+	moderatorID, err := authenticatedUserID(r)
+	if err != nil {
+		HandleError(w, err, "Not allowed to remove this product")
+		return
+	}
+	userId, err := helper.GetUserID(mux.Vars(r)["UserId"])
+	if err != nil {
+		HandleError(w, err, "Error checking user ID")
+		return
+	}
+	productId, err := helper.CheckParam(mux.Vars(r)["ProductId"])
+	if err != nil {
+		HandleError(w, err, "Error checking product ID")
+		return
+	}
+
+	log.Printf("Moderator %d removing product %s of user %d\n", moderatorID, productId, userId)
+	h.deleteProduct(w, userId, productId)
+}
+
+// deleteProduct removes a product and its image and answers 204.
+func (h *ProductHandler) deleteProduct(w http.ResponseWriter, userId int, productId string) {
 	product, err := h.ProductRepo.FindProductByUserAndId(userId, productId)
 	if err != nil {
 		HandleError(w, err, "Error updating product")
@@ -334,10 +385,35 @@ func (h *ProductHandler) handleProductImageUpload(w http.ResponseWriter, r *http
 		return "", err
 	}
 
-	s3ImageKey, err := h.ImageRepo.UploadImage(product.ProductID, r.FormValue("userId"), imageData.Bytes(), format)
+	s3ImageKey, err := h.ImageRepo.UploadImage(product.ProductID, strconv.Itoa(product.UserID), imageData.Bytes(), format)
 	if err != nil {
 		HandleError(w, err, "Error uploading image to S3")
 		return "", err
 	}
 	return s3ImageKey, nil
 }
+
+// authenticatedUserID returns the user ID that the auth middleware attached to r.
+func authenticatedUserID(r *http.Request) (int, error) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		return 0, customerrors.NewUnauthorizedError("authentication required", nil)
+	}
+	return userID, nil
+}
+
+// authorizeOwner checks that the {UserId} path segment names the authenticated user.
+func authorizeOwner(r *http.Request) (int, error) {
+	userID, err := authenticatedUserID(r)
+	if err != nil {
+		return 0, err
+	}
+	pathUserID, err := helper.GetUserID(mux.Vars(r)["UserId"])
+	if err != nil {
+		return 0, err
+	}
+	if pathUserID != userID {
+		return 0, customerrors.NewForbiddenError("products can only be changed by their owner", nil)
+	}
+	return userID, nil
+}
@@ -11,8 +11,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
+	"web-service/auth"
 	"web-service/model"
 
 	"github.com/gorilla/mux"
@@ -59,6 +61,25 @@ func (m *MockProductRepository) FindProductByUserAndId(userID int, productID str
 	return args.Get(0).(*model.Product), args.Error(1)
 }
 
+func (m *MockProductRepository) DeleteProductsByUserID(userID int) (int64, error) {
+	args := m.Called(userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockSellerRepository struct {
+	mock.Mock
+}
+
+func (m *MockSellerRepository) ApplySeller(seller model.Seller) (bool, error) {
+	args := m.Called(seller)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockSellerRepository) DeleteSeller(userID int) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
 type MockImageRepository struct {
 	mock.Mock
 }
@@ -126,7 +147,8 @@ func TestCreateProductHandler(t *testing.T) {
 	var requestBody bytes.Buffer
 	writer := multipart.NewWriter(&requestBody)
 
-	_ = writer.WriteField("userId", "1")
+	// The form names another user; the token's user must still own the product.
+	_ = writer.WriteField("userId", "2")
 	_ = writer.WriteField("productTitle", "Test Product")
 	_ = writer.WriteField("productDescription", "A sample product description")
 	_ = writer.WriteField("productPostDate", "03-03-2025")
@@ -147,9 +169,10 @@ func TestCreateProductHandler(t *testing.T) {
 
 	req, _ := http.NewRequest("POST", "/products", &requestBody)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req = req.WithContext(auth.ContextWithUserID(req.Context(), 1))
 	rr := httptest.NewRecorder()
 
-	mockProductRepo.On("CreateProduct", mock.AnythingOfType("model.Product")).Return(nil)
+	mockProductRepo.On("CreateProduct", mock.MatchedBy(func(p model.Product) bool { return p.UserID == 1 })).Return(nil)
 	mockImageRepo.On("UploadImage", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return("test-image-key", nil)
 
 	handler.CreateProductHandler(rr, req)
@@ -269,6 +292,7 @@ func TestUpdateProductHandler(t *testing.T) {
 
 	req, _ := http.NewRequest("PUT", "/products/1/test-product-id", &requestBody)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req = req.WithContext(auth.ContextWithUserID(req.Context(), 1))
 	rr := httptest.NewRecorder()
 
 	vars := map[string]string{
@@ -322,6 +346,7 @@ func TestDeleteProductHandler(t *testing.T) {
 	mockImageRepo.On("DeleteImage", "test-image-key").Return(nil)
 
 	req, _ := http.NewRequest("DELETE", "/products/1/test-product-id", nil)
+	req = req.WithContext(auth.ContextWithUserID(req.Context(), userID))
 	rr := httptest.NewRecorder()
 
 	vars := map[string]string{
@@ -337,6 +362,119 @@ func TestDeleteProductHandler(t *testing.T) {
 	mockImageRepo.AssertExpectations(t)
 }
 
+func TestDeleteProductHandlerRejectsOtherUser(t *testing.T) {
+	mockProductRepo := new(MockProductRepository)
+	mockImageRepo := new(MockImageRepository)
+	handler := NewProductHandler(mockProductRepo, mockImageRepo)
+
+	req, _ := http.NewRequest("DELETE", "/products/1/test-product-id", nil)
+	req = req.WithContext(auth.ContextWithUserID(req.Context(), 2))
+	rr := httptest.NewRecorder()
+
+	vars := map[string]string{
+		"UserId":    "1",
+		"ProductId": "test-product-id",
+	}
+	req = mux.SetURLVars(req, vars)
+
+	handler.DeleteProductHandler(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	mockProductRepo.AssertNotCalled(t, "DeleteProduct", mock.Anything, mock.Anything)
+	mockImageRepo.AssertNotCalled(t, "DeleteImage", mock.Anything)
+}
+
+func TestModerateDeleteProductHandler(t *testing.T) {
+	mockProductRepo := new(MockProductRepository)
+	mockImageRepo := new(MockImageRepository)
+	handler := NewProductHandler(mockProductRepo, mockImageRepo)
+
+	product := &model.Product{UserID: 1, ProductID: "test-product-id"}
+	mockProductRepo.On("FindProductByUserAndId", 1, "test-product-id").Return(product, nil)
+	mockProductRepo.On("DeleteProduct", 1, "test-product-id").Return(nil)
+
+	req, _ := http.NewRequest("DELETE", "/moderation/products/1/test-product-id", nil)
+	req = req.WithContext(auth.ContextWithClaims(req.Context(), auth.Claims{UserID: 2, Role: "moderator", Permissions: []string{auth.PermModerateListings}}))
+	req = mux.SetURLVars(req, map[string]string{"UserId": "1", "ProductId": "test-product-id"})
+	rr := httptest.NewRecorder()
+
+	handler.ModerateDeleteProductHandler(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	mockProductRepo.AssertExpectations(t)
+	mockImageRepo.AssertNotCalled(t, "DeleteImage", mock.Anything)
+}
+
+func TestUserEventHandlerDeletesProductsOfDeletedUser(t *testing.T) {
+	mockProductRepo := new(MockProductRepository)
+	mockImageRepo := new(MockImageRepository)
+	handler := NewProductHandler(mockProductRepo, mockImageRepo)
+
+	mockProductRepo.On("GetProductsByUserID", 7, "", userEventPageSize).Return([]model.Product{
+		{UserID: 7, ProductID: "a", ProductImage: "image-a"},
+		{UserID: 7, ProductID: "b"},
+	}, nil)
+	mockImageRepo.On("DeleteImage", "image-a").Return(nil)
+	mockProductRepo.On("DeleteProductsByUserID", 7).Return(int64(2), nil)
+
+	body := strings.NewReader(`{"event_id":"e1","type":"user.deleted","version":3,"user_id":7}`)
+	req, _ := http.NewRequest("POST", "/internal/user-events", body)
+	rr := httptest.NewRecorder()
+	handler.UserEventHandler(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	mockProductRepo.AssertExpectations(t)
+	mockImageRepo.AssertExpectations(t)
+}
+
+func TestUserEventHandlerIgnoresOtherEvents(t *testing.T) {
+	mockProductRepo := new(MockProductRepository)
+	handler := NewProductHandler(mockProductRepo, new(MockImageRepository))
+
+	body := strings.NewReader(`{"event_id":"e2","type":"user.updated","version":4,"user_id":7,"name":"New Name"}`)
+	req, _ := http.NewRequest("POST", "/internal/user-events", body)
+	rr := httptest.NewRecorder()
+	handler.UserEventHandler(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	mockProductRepo.AssertNotCalled(t, "DeleteProductsByUserID", mock.Anything)
+}
+
+func TestUserEventHandlerUpdatesSeller(t *testing.T) {
+	mockSellerRepo := new(MockSellerRepository)
+	handler := NewProductHandler(new(MockProductRepository), new(MockImageRepository))
+	handler.SellerRepo = mockSellerRepo
+
+	mockSellerRepo.On("ApplySeller", model.Seller{UserID: 7, PhoneVerified: true, Version: 5}).Return(true, nil)
+
+	body := strings.NewReader(`{"event_id":"e3","type":"user.updated","version":5,"user_id":7,"phone_verified":true}`)
+	req, _ := http.NewRequest("POST", "/internal/user-events", body)
+	rr := httptest.NewRecorder()
+	handler.UserEventHandler(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	mockSellerRepo.AssertExpectations(t)
+}
+
+func TestUserEventHandlerDeletesSellerOfDeletedUser(t *testing.T) {
+	mockProductRepo := new(MockProductRepository)
+	mockSellerRepo := new(MockSellerRepository)
+	handler := NewProductHandler(mockProductRepo, new(MockImageRepository))
+	handler.SellerRepo = mockSellerRepo
+
+	mockProductRepo.On("GetProductsByUserID", 7, "", userEventPageSize).Return([]model.Product{}, nil)
+	mockProductRepo.On("DeleteProductsByUserID", 7).Return(int64(0), nil)
+	mockSellerRepo.On("DeleteSeller", 7).Return(nil)
+
+	body := strings.NewReader(`{"event_id":"e4","type":"user.deleted","version":6,"user_id":7}`)
+	req, _ := http.NewRequest("POST", "/internal/user-events", body)
+	rr := httptest.NewRecorder()
+	handler.UserEventHandler(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	mockSellerRepo.AssertExpectations(t)
+}
+
 func TestSearchProductsHandler(t *testing.T) {
 	mockProductRepo := new(MockProductRepository)
 	mockImageRepo := new(MockImageRepository)
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	customerrors "web-service/errors"
+	"web-service/model"
+)
+
+// userEventPageSize is how many of a deleted user's products are loaded at a
+// time to remove their images.
+const userEventPageSize = 100
+
+// UserEventHandler receives user events from the users service's outbox
+// relay. Created and updated users refresh the seller details shown on their
+// listings; when a user is deleted their listings and images are removed.
+// Redelivered and stale events are harmless, so every successfully handled
+// event is acknowledged with 204.
+func (h *ProductHandler) UserEventHandler(w http.ResponseWriter, r *http.Request) {
+	var event model.UserEvent
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil || event.UserID <= 0 {
+		HandleError(w, customerrors.NewCustomError("Invalid event payload", http.StatusBadRequest, err), "Invalid event payload")
+		return
+	}
+
+	var err error
+	switch event.Type {
+	case model.UserCreated, model.UserUpdated:
+		err = h.applySeller(event)
+	case model.UserDeleted:
+		err = h.removeUser(event)
+	}
+	if err != nil {
+		HandleError(w, err, "Error applying user event")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applySeller stores the seller details of a created or updated user.
+func (h *ProductHandler) applySeller(event model.UserEvent) error {
+	if h.SellerRepo == nil {
+		return nil
+	}
+	seller := model.Seller{UserID: event.UserID, PhoneVerified: event.PhoneVerified, Version: event.Version}
+	_, err := h.SellerRepo.ApplySeller(seller)
+	return err
+}
+
+// removeUser deletes the listings, images and seller details of a deleted user.
+func (h *ProductHandler) removeUser(event model.UserEvent) error {
+	if err := h.deleteImagesOfUser(event.UserID); err != nil {
+		return err
+	}
+	removed, err := h.ProductRepo.DeleteProductsByUserID(event.UserID)
+	if err != nil {
+		return err
+	}
+	log.Printf("Removed %d products of deleted user %d (event %s)\n", removed, event.UserID, event.EventID)
+	if h.SellerRepo != nil {
+		return h.SellerRepo.DeleteSeller(event.UserID)
+	}
+	return nil
+}
+
+// deleteImagesOfUser removes the stored image of every product of userID. It
+// runs before the products are deleted so a failure can be retried.
+func (h *ProductHandler) deleteImagesOfUser(userID int) error {
+	lastID := ""
+	for {
+		products, err := h.ProductRepo.GetProductsByUserID(userID, lastID, userEventPageSize)
+		var notFound *customerrors.NotFoundError
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, product := range products {
+			if product.ProductImage == "" {
+				continue
+			}
+			if err := h.ImageRepo.DeleteImage(product.ProductImage); err != nil {
+				return err
+			}
+		}
+		if len(products) < userEventPageSize {
+			return nil
+		}
+		lastID = products[len(products)-1].ProductID
+	}
+}
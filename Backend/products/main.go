@@ -10,6 +10,7 @@ import (
 	"syscall"
 	"time"
 
+	"web-service/auth"
 	"web-service/config"
 	"web-service/handler"
 	"web-service/repository"
@@ -27,6 +28,10 @@ import (
 // @BasePath /
 // @contact.name Avaneesh Khandekar
 // @contact.email avaneesh.khandekar@gmail.com
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Users-service access token, sent as "Bearer <token>".
 func main() {
 	err := godotenv.Load()
 	if err != nil {
@@ -49,10 +54,15 @@ func main() {
 	}
 	s3 := repository.NewS3ImageRepository()
 	productHandler := handler.NewProductHandler(repo, s3)
+	sellers, err := repository.NewMongoSellerRepository()
+	if err != nil {
+		log.Fatalf("Failed to create seller repository: %v", err)
+	}
+	productHandler.SellerRepo = sellers
 
 	router := mux.NewRouter()
 	router.HandleFunc("/health", healthCheck).Methods(http.MethodGet)
-	routes.RegisterProductRoutes(router, productHandler)
+	routes.RegisterProductRoutes(router, productHandler, auth.NewAuthenticatorFromEnv())
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -20,16 +20,18 @@ import (
 // @Property productPrice float64 "Price of the product" required example(999.99)
 // @Property productLocation string "Location of the product" example("University of Florida")
 // @Property productImage string "In POST: The product image file. In GET: The URL of the product image" example("https://example.com/laptop.jpg")
+// @Property sellerPhoneVerified bool "Whether the seller verified their phone number, read-only" example(true)
 type Product struct {
-	UserID             int       `json:"userId" bson:"UserId" validate:"nonzero" example:"123"`                            // Unique user ID
-	ProductID          string    `json:"productId" bson:"ProductId" example:"9b96a85c-f02e-47a1-9a1a-1dd9ed6147bd"`        // Unique product ID (UUID)
-	ProductTitle       string    `json:"productTitle" bson:"ProductTitle" validate:"nonzero" example:"Laptop"`             // Product title
-	ProductDescription string    `json:"productDescription" bson:"ProductDescription" example:"A high-performance laptop"` // Product description
-	ProductPostDate    time.Time `json:"productPostDate" bson:"ProductPostDate" validate:"nonzero" example:"02-20-2025"`   // Product post date (time.Time)
-	ProductCondition   int       `json:"productCondition" bson:"ProductCondition" validate:"nonzero" example:"4"`          // Product condition
-	ProductPrice       float64   `json:"productPrice" bson:"ProductPrice" validate:"nonzero" example:"999.99"`             // Price of the product
-	ProductLocation    string    `json:"productLocation" bson:"ProductLocation" example:"University of Florida"`           // Location of the product
-	ProductImage       string    `json:"productImage" bson:"ProductImage" example:"https://example.com/laptop.jpg"`        // Product image URL in GET, Actual product image in PUT
+	UserID              int       `json:"userId" bson:"UserId" validate:"nonzero" example:"123"`                            // Unique user ID
+	ProductID           string    `json:"productId" bson:"ProductId" example:"9b96a85c-f02e-47a1-9a1a-1dd9ed6147bd"`        // Unique product ID (UUID)
+	ProductTitle        string    `json:"productTitle" bson:"ProductTitle" validate:"nonzero" example:"Laptop"`             // Product title
+	ProductDescription  string    `json:"productDescription" bson:"ProductDescription" example:"A high-performance laptop"` // Product description
+	ProductPostDate     time.Time `json:"productPostDate" bson:"ProductPostDate" validate:"nonzero" example:"02-20-2025"`   // Product post date (time.Time)
+	ProductCondition    int       `json:"productCondition" bson:"ProductCondition" validate:"nonzero" example:"4"`          // Product condition
+	ProductPrice        float64   `json:"productPrice" bson:"ProductPrice" validate:"nonzero" example:"999.99"`             // Price of the product
+	ProductLocation     string    `json:"productLocation" bson:"ProductLocation" example:"University of Florida"`           // Location of the product
+	ProductImage        string    `json:"productImage" bson:"ProductImage" example:"https://example.com/laptop.jpg"`        // Product image URL in GET, Actual product image in PUT
+	SellerPhoneVerified bool      `json:"sellerPhoneVerified" bson:"SellerPhoneVerified,omitempty" example:"true"`          // Joined from the seller when products are read; never stored
 }
 
 func (p *Product) Validate() error {
@@ -0,0 +1,9 @@
+package model
+
+// Seller is what the products service knows about a user from the users
+// service's events. Version is the version of the last event applied.
+type Seller struct {
+	UserID        int   `json:"userId" bson:"UserId"`
+	PhoneVerified bool  `json:"phoneVerified" bson:"PhoneVerified"`
+	Version       int64 `json:"-" bson:"Version"`
+}
@@ -0,0 +1,17 @@
+package model
+
+// Types of the events the users service sends when an account changes.
+const (
+	UserCreated = "user.created"
+	UserUpdated = "user.updated"
+	UserDeleted = "user.deleted"
+)
+
+// UserEvent is a change to a user in the users service.
+type UserEvent struct {
+	EventID       string `json:"event_id"`
+	Type          string `json:"type"`
+	Version       int64  `json:"version"`
+	UserID        int    `json:"user_id"`
+	PhoneVerified bool   `json:"phone_verified"`
+}
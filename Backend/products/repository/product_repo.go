@@ -10,4 +10,5 @@ type ProductRepository interface {
 	DeleteProduct(userID int, productID string) error
 	FindProductByUserAndId(userID int, productID string) (*model.Product, error)
 	SearchProducts(query string, limit int) ([]model.Product, error)
+	DeleteProductsByUserID(userID int) (int64, error)
 }
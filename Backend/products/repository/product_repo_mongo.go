@@ -59,6 +59,7 @@ func (repo *MongoProductRepository) getProducts(filter bson.M, limit int) ([]mod
 		{{Key: "$sort", Value: bson.D{{Key: "ProductId", Value: 1}}}},
 		{{Key: "$limit", Value: int64(limit)}},
 	}
+	pipeline = append(pipeline, sellerBadgeStages()...)
 
 	cursor, err := repo.collection.Aggregate(ctx, pipeline)
 	if err != nil {
@@ -160,6 +161,23 @@ func (repo *MongoProductRepository) DeleteProduct(userID int, productID string)
 	return nil
 }
 
+// DeleteProductsByUserID removes every product listed by userID. Deleting a
+// user with no products is not an error.
+func (repo *MongoProductRepository) DeleteProductsByUserID(userID int) (int64, error) {
+	log.Printf("Attempting to delete all products for UserID: %d\n", userID)
+
+	ctx, cancel := repo.getContextWithTimeout()
+	defer cancel()
+
+	result, err := repo.collection.DeleteMany(ctx, bson.M{"UserId": userID})
+	if err != nil {
+		return 0, customerrors.NewDatabaseError("Error deleting products", err)
+	}
+
+	log.Printf("Deleted %d products for UserID: %d\n", result.DeletedCount, userID)
+	return result.DeletedCount, nil
+}
+
 func (repo *MongoProductRepository) FindProductByUserAndId(userID int, productID string) (*model.Product, error) {
 	log.Printf("Attempting to find product for UserId: %d and ProductId: %s\n", userID, productID)
 
@@ -205,6 +223,7 @@ func (repo *MongoProductRepository) SearchProducts(query string, limit int) ([]m
 			bson.E{Key: "$limit", Value: limit},
 		},
 	}
+	pipeline = append(pipeline, sellerBadgeStages()...)
 
 	cursor, err := repo.collection.Aggregate(ctx, pipeline)
 	if err != nil {
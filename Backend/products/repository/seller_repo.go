@@ -0,0 +1,10 @@
+package repository
+
+import "web-service/model"
+
+type SellerRepository interface {
+	// ApplySeller stores seller unless a newer version is already stored, and
+	// reports whether it was applied.
+	ApplySeller(seller model.Seller) (bool, error)
+	DeleteSeller(userID int) error
+}
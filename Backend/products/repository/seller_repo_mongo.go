@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"web-service/config"
+	customerrors "web-service/errors"
+	"web-service/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// sellersCollection holds one document per seller, joined into products when they are read.
+const sellersCollection = "sellers"
+
+type MongoSellerRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoSellerRepository() (*MongoSellerRepository, error) {
+	collection, err := config.GetCollection(sellersCollection)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// The unique index makes a stale upsert fail instead of adding a second document.
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "UserId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, customerrors.NewDatabaseError("Error creating sellers index", err)
+	}
+	return &MongoSellerRepository{collection: collection}, nil
+}
+
+func (repo *MongoSellerRepository) ApplySeller(seller model.Seller) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"UserId": seller.UserID, "Version": bson.M{"$lt": seller.Version}}
+	update := bson.M{"$set": seller}
+	_, err := repo.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// A document with the same or a newer version exists.
+		return false, nil
+	}
+	if err != nil {
+		return false, customerrors.NewDatabaseError("Error saving seller", err)
+	}
+	return true, nil
+}
+
+func (repo *MongoSellerRepository) DeleteSeller(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := repo.collection.DeleteOne(ctx, bson.M{"UserId": userID}); err != nil {
+		return customerrors.NewDatabaseError("Error deleting seller", err)
+	}
+	return nil
+}
+
+// sellerBadgeStages joins the seller of each product and sets
+// SellerPhoneVerified from it. Sellers the service has not heard of yet read as unverified.
+func sellerBadgeStages() mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: sellersCollection},
+			{Key: "localField", Value: "UserId"},
+			{Key: "foreignField", Value: "UserId"},
+			{Key: "as", Value: "seller"},
+		}}},
+		{{Key: "$addFields", Value: bson.D{
+			{Key: "SellerPhoneVerified", Value: bson.D{{Key: "$ifNull", Value: bson.A{
+				bson.D{{Key: "$arrayElemAt", Value: bson.A{"$seller.PhoneVerified", 0}}},
+				false,
+			}}}},
+		}}},
+		{{Key: "$project", Value: bson.D{{Key: "seller", Value: 0}}}},
+	}
+}
@@ -2,19 +2,25 @@ package routes
 
 import (
 	"net/http"
+	"web-service/auth"
 	"web-service/handler"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 )
 
-func RegisterProductRoutes(router *mux.Router, productHandler *handler.ProductHandler) {
-	router.HandleFunc("/products", productHandler.CreateProductHandler).Methods("POST")
+// RegisterProductRoutes wires the product endpoints. Mutating endpoints require
+// a users-service access token and act on behalf of its user; moderation
+// endpoints also require a permission from the user's role.
+func RegisterProductRoutes(router *mux.Router, productHandler *handler.ProductHandler, authenticator *auth.Authenticator) {
+	router.Handle("/products", authenticator.Middleware(http.HandlerFunc(productHandler.CreateProductHandler))).Methods("POST")
 	router.HandleFunc("/products", productHandler.GetAllProductsHandler).Methods("GET")
 	router.HandleFunc("/products/{UserId}", productHandler.GetAllProductsByUserIDHandler).Methods("GET")
-	router.HandleFunc("/products/{UserId}/{ProductId}", productHandler.UpdateProductHandler).Methods("PUT")
-	router.HandleFunc("/products/{UserId}/{ProductId}", productHandler.DeleteProductHandler).Methods("DELETE")
+	router.Handle("/products/{UserId}/{ProductId}", authenticator.Middleware(http.HandlerFunc(productHandler.UpdateProductHandler))).Methods("PUT")
+	router.Handle("/products/{UserId}/{ProductId}", authenticator.Middleware(http.HandlerFunc(productHandler.DeleteProductHandler))).Methods("DELETE")
+	router.Handle("/moderation/products/{UserId}/{ProductId}", authenticator.RequirePermission(auth.PermModerateListings, http.HandlerFunc(productHandler.ModerateDeleteProductHandler))).Methods("DELETE")
 	router.HandleFunc("/search/products", productHandler.SearchProductsHandler).Methods("GET")
+	router.Handle("/internal/user-events", authenticator.ServiceMiddleware(auth.ScopeUsersSync, http.HandlerFunc(productHandler.UserEventHandler))).Methods("POST")
 }
 
 func SetupCORS(router *mux.Router) http.Handler {
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"web-service/auth"
 	"web-service/handler"
 	"web-service/model"
 
@@ -50,6 +51,11 @@ func (m *MockProductRepository) FindProductByUserAndId(userID int, productID str
 	return args.Get(0).(*model.Product), args.Error(1)
 }
 
+func (m *MockProductRepository) DeleteProductsByUserID(userID int) (int64, error) {
+	args := m.Called(userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 type MockImageRepository struct {
 	mock.Mock
 }
@@ -117,7 +123,7 @@ func TestCORSHeaders(t *testing.T) {
 	handler := handler.NewProductHandler(mockProductRepo, mockImageRepo)
 
 	router := mux.NewRouter()
-	RegisterProductRoutes(router, handler)
+	RegisterProductRoutes(router, handler, auth.NewAuthenticator(auth.StaticKeys{}, nil))
 
 	corsRouter := SetupCORS(router)
 
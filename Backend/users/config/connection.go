@@ -8,7 +8,8 @@ import (
 )
 
 func Connect(dsn string) *gorm.DB {
-	db, err := gorm.Open(postgres.Open(dsn))
+	// TranslateError reports unique index violations as gorm.ErrDuplicatedKey.
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 	if err != nil {
 		fmt.Println(err)
 		return nil
@@ -0,0 +1,131 @@
+// Package events delivers user events from the outbox to other services.
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	models "users/models"
+	utils "users/utils"
+)
+
+// ScopeUsersSync is the scope of the service token the relay presents to the
+// messaging service.
+const ScopeUsersSync = "users:sync"
+
+// Relay posts the due outbox events of Destination to Endpoint, one request
+// per event. Failed deliveries are retried with exponential backoff; the
+// receiver must treat a redelivered event as a no-op, which the version in
+// every event allows. Each batch is leased for Lease, which has to outlast
+// delivering it, so relays on several replicas can run side by side.
+type Relay struct {
+	Outbox      models.OutboxModel
+	Destination string
+	Endpoint    string
+	Client      *http.Client
+	Token       func() (string, error)
+	BatchSize   int
+	Lease       time.Duration
+	MaxBackoff  time.Duration
+}
+
+// NewRelay returns a Relay for destination that authenticates with a
+// users-service token whose audience is the destination service.
+func NewRelay(outbox models.OutboxModel, destination, endpoint string) *Relay {
+	return &Relay{
+		Outbox:      outbox,
+		Destination: destination,
+		Endpoint:    endpoint,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		Token: func() (string, error) {
+			return utils.GenerateServiceJWT(destination, ScopeUsersSync)
+		},
+		BatchSize:  100,
+		Lease:      20 * time.Minute, // 100 events at the 10s client timeout take under 17 minutes
+		MaxBackoff: 10 * time.Minute,
+	}
+}
+
+// DeliverDue sends every event that is due and returns how many were delivered.
+func (r *Relay) DeliverDue() (int, error) {
+	due, err := r.Outbox.Claim(r.Destination, r.BatchSize, r.Lease)
+	if err != nil || len(due) == 0 {
+		return 0, err
+	}
+	token, err := r.Token()
+	if err != nil {
+		return 0, fmt.Errorf("DeliverDue (issuing service token): %w", err)
+	}
+	delivered := 0
+	for _, row := range due {
+		if err := r.deliver(row, token); err != nil {
+			if markErr := r.Outbox.MarkFailed(row.ID, err, r.backoff(row.Attempts)); markErr != nil {
+				return delivered, markErr
+			}
+			log.Printf("failed to deliver %s event %s to %s (attempt %d): %v\n", row.Type, row.EventID, r.Destination, row.Attempts+1, err)
+			continue
+		}
+		if err := r.Outbox.MarkDelivered(row.ID); err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+func (r *Relay) deliver(row models.OutboxEvent, token string) error {
+	ev, err := row.Event()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, r.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Idempotency-Key", ev.EventID)
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// backoff is the wait after the given number of earlier failed attempts:
+// 1s, 2s, 4s, ... up to MaxBackoff.
+func (r *Relay) backoff(attempts int) time.Duration {
+	if attempts > 30 {
+		return r.MaxBackoff
+	}
+	d := time.Second << attempts
+	if d > r.MaxBackoff {
+		d = r.MaxBackoff
+	}
+	return d
+}
+
+// Run delivers due events every interval until the process exits.
+func (r *Relay) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := r.DeliverDue(); err != nil {
+			log.Printf("outbox relay to %s: %v\n", r.Destination, err)
+		}
+	}
+}
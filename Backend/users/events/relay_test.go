@@ -0,0 +1,150 @@
+package events
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"users/mailer"
+	"users/models"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestRelay(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.OTP{}, &models.OutboxEvent{}))
+	m := models.NewModels(db, mailer.NewFileMailer(t.TempDir()))
+
+	var mu sync.Mutex
+	var received []models.UserEvent
+	fail := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer service-token", r.Header.Get("Authorization"))
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		var ev models.UserEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&ev))
+		assert.Equal(t, ev.EventID, r.Header.Get("Idempotency-Key"))
+		received = append(received, ev)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	relay := NewRelay(m.Outbox, models.DestinationMessaging, srv.URL)
+	relay.Token = func() (string, error) { return "service-token", nil }
+
+	user, err := m.UserModel.Insert("Ellie Williams", "ellie@ufl.edu", "SomeStrongPassword@123", "")
+	require.NoError(t, err)
+	name := "Ellie W"
+	require.NoError(t, m.UserModel.UpdateProfile(user, &name, nil))
+	require.NoError(t, m.UserModel.Delete("ellie@ufl.edu"))
+
+	t.Run("failures are retried later", func(t *testing.T) {
+		delivered, err := relay.DeliverDue()
+		assert.NoError(t, err)
+		assert.Zero(t, delivered)
+
+		var rows []models.OutboxEvent
+		require.NoError(t, db.Where("destination = ?", models.DestinationMessaging).Order("id").Find(&rows).Error)
+		require.Len(t, rows, 3)
+		for _, row := range rows {
+			assert.Equal(t, 1, row.Attempts)
+			assert.Contains(t, row.LastError, "503")
+			assert.True(t, row.NextAttemptAt.After(time.Now()))
+		}
+
+		delivered, err = relay.DeliverDue()
+		assert.NoError(t, err)
+		assert.Zero(t, delivered, "nothing is due until the backoff has passed")
+	})
+
+	t.Run("due events are delivered in order", func(t *testing.T) {
+		mu.Lock()
+		fail = false
+		mu.Unlock()
+		require.NoError(t, db.Model(&models.OutboxEvent{}).Where("1 = 1").Update("next_attempt_at", time.Now()).Error)
+
+		delivered, err := relay.DeliverDue()
+		assert.NoError(t, err)
+		assert.Equal(t, 3, delivered)
+
+		require.Len(t, received, 3)
+		assert.Equal(t, models.EventUserCreated, received[0].Type)
+		assert.Equal(t, user.UserID, received[0].UserID)
+		assert.Equal(t, "ellie@ufl.edu", received[0].Email)
+		assert.Equal(t, models.EventUserUpdated, received[1].Type)
+		assert.Equal(t, "Ellie W", received[1].Name)
+		assert.Equal(t, models.EventUserDeleted, received[2].Type)
+		assert.Empty(t, received[2].Email, "deleted events carry no profile data")
+		assert.Less(t, received[0].Version, received[1].Version)
+		assert.Less(t, received[1].Version, received[2].Version)
+
+		delivered, err = relay.DeliverDue()
+		assert.NoError(t, err)
+		assert.Zero(t, delivered)
+	})
+
+	t.Run("delivered events are pruned", func(t *testing.T) {
+		removed, err := m.Outbox.Prune(-time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), removed)
+
+		var pending int64
+		require.NoError(t, db.Model(&models.OutboxEvent{}).Where("destination = ? AND delivered_at IS NULL", models.DestinationProducts).Count(&pending).Error)
+		assert.Equal(t, int64(3), pending, "each destination tracks its own delivery")
+	})
+}
+
+func TestClaimLeasesEvents(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.OTP{}, &models.OutboxEvent{}))
+	m := models.NewModels(db, mailer.NewFileMailer(t.TempDir()))
+	for _, email := range []string{"abby@ufl.edu", "owen@ufl.edu", "dina@ufl.edu"} {
+		_, err := m.UserModel.Insert("Test User", email, "SomeStrongPassword@123", "")
+		require.NoError(t, err)
+	}
+
+	first, err := m.Outbox.Claim(models.DestinationMessaging, 2, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, first, 2)
+	assert.Less(t, first[0].ID, first[1].ID, "oldest first")
+
+	second, err := m.Outbox.Claim(models.DestinationMessaging, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, second, 1, "another relay skips leased events")
+	assert.Greater(t, second[0].ID, first[1].ID)
+
+	none, err := m.Outbox.Claim(models.DestinationMessaging, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, none)
+
+	require.NoError(t, m.Outbox.MarkFailed(first[0].ID, assert.AnError, 0))
+	require.NoError(t, db.Model(&models.OutboxEvent{}).Where("id = ?", first[1].ID).
+		Update("locked_until", time.Now().Add(-time.Second)).Error)
+	again, err := m.Outbox.Claim(models.DestinationMessaging, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, again, 2, "failed events and expired leases are claimable")
+	assert.Equal(t, first[0].ID, again[0].ID)
+	assert.Equal(t, first[1].ID, again[1].ID)
+}
+
+func TestBackoff(t *testing.T) {
+	r := &Relay{MaxBackoff: time.Minute}
+	assert.Equal(t, time.Second, r.backoff(0))
+	assert.Equal(t, 8*time.Second, r.backoff(3))
+	assert.Equal(t, time.Minute, r.backoff(10))
+	assert.Equal(t, time.Minute, r.backoff(100))
+}
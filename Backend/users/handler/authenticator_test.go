@@ -0,0 +1,159 @@
+package handler_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+// softAuthenticator is a WebAuthn authenticator in software: it answers the
+// options the server hands out the way a browser and a platform authenticator
+// would, with "none" attestation and an ES256 key per credential. With
+// skipUserVerification it behaves like a security key without a PIN, leaving
+// the UV flag unset.
+type softAuthenticator struct {
+	rpID                 string
+	origin               string
+	credentials          map[string]*softCredential
+	skipUserVerification bool
+}
+
+type softCredential struct {
+	id         []byte
+	key        *ecdsa.PrivateKey
+	userHandle []byte
+	signCount  uint32
+}
+
+// creationOptions and requestOptions are the parts of the begin responses the
+// authenticator needs.
+type creationOptions struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+		RP        struct {
+			ID string `json:"id"`
+		} `json:"rp"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	} `json:"publicKey"`
+}
+
+type requestOptions struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+	} `json:"publicKey"`
+}
+
+func newSoftAuthenticator(rpID, origin string) *softAuthenticator {
+	return &softAuthenticator{rpID: rpID, origin: origin, credentials: map[string]*softCredential{}}
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func (a *softAuthenticator) clientData(t *testing.T, ceremony, challenge string) []byte {
+	data, err := json.Marshal(map[string]string{"type": ceremony, "challenge": challenge, "origin": a.origin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func (a *softAuthenticator) authData(flags byte, counter uint32, attested []byte) []byte {
+	if a.skipUserVerification {
+		flags &^= 0x04
+	}
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, counter)
+	return append(data, attested...)
+}
+
+// create answers navigator.credentials.create and returns the
+// PublicKeyCredential JSON and the new credential.
+func (a *softAuthenticator) create(t *testing.T, options creationOptions) (json.RawMessage, *softCredential) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userHandle, err := base64.RawURLEncoding.DecodeString(options.PublicKey.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred := &softCredential{id: make([]byte, 16), key: key, userHandle: userHandle}
+	_, _ = rand.Read(cred.id)
+
+	coseKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.EllipticKey), Algorithm: int64(webauthncose.AlgES256)},
+		Curve:         1, // P-256
+		XCoord:        key.PublicKey.X.FillBytes(make([]byte, 32)),
+		YCoord:        key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attested := make([]byte, 16) // zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(cred.id)))
+	attested = append(attested, cred.id...)
+	attested = append(attested, coseKey...)
+
+	attestation, err := webauthncbor.Marshal(struct {
+		Fmt      string                 `cbor:"fmt"`
+		AttStmt  map[string]interface{} `cbor:"attStmt"`
+		AuthData []byte                 `cbor:"authData"`
+	}{
+		Fmt:      "none",
+		AttStmt:  map[string]interface{}{},
+		AuthData: a.authData(0x45, 0, attested), // UP, UV, AT
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    b64(cred.id),
+		"rawId": b64(cred.id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64(a.clientData(t, "webauthn.create", options.PublicKey.Challenge)),
+			"attestationObject": b64(attestation),
+		},
+	})
+	a.credentials[string(cred.id)] = cred
+	return body, cred
+}
+
+// get answers navigator.credentials.get with cred.
+func (a *softAuthenticator) get(t *testing.T, options requestOptions, cred *softCredential) json.RawMessage {
+	t.Helper()
+	cred.signCount++
+	authData := a.authData(0x05, cred.signCount, nil) // UP, UV
+	clientData := a.clientData(t, "webauthn.get", options.PublicKey.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, cred.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    b64(cred.id),
+		"rawId": b64(cred.id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64(clientData),
+			"authenticatorData": b64(authData),
+			"signature":         b64(signature),
+			"userHandle":        b64(cred.userHandle),
+		},
+	})
+	return body
+}
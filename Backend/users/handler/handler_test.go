@@ -3,31 +3,42 @@ package handler_test
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"regexp"
+	"strconv"
 	"testing"
 	"time"
 	"users/handler"
+	"users/mailer"
 	"users/models"
+	"users/sms"
+	"users/utils"
 
 	"github.com/alexedwards/argon2id"
 	"github.com/glebarez/sqlite"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pquerna/otp/totp"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/gorm"
 )
 
 func TestHandlers(t *testing.T) {
-	orig := os.Getenv("JWT_SECRET")
-	defer os.Setenv("JWT_SECRET", orig)
-	_ = os.Setenv("JWT_SECRET", "testsecret")
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true})
+	_ = db.AutoMigrate(&models.User{}, &models.OTP{}, &models.RevokedToken{}, &models.RevokedSubject{}, &models.RefreshToken{}, &models.LoginAttempt{}, &models.University{}, &models.OutboxEvent{}, &models.RecoveryCode{}, &models.LoginChallenge{}, &models.Passkey{}, &models.PasskeyCeremony{}, &models.Session{}, &models.AuditEntry{}, &models.AuthEvent{})
 
-	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	_ = db.AutoMigrate(&models.User{})
-
-	userModel := models.UserModel{DB: db}
-	app := handler.Application{Models: models.Models{UserModel: userModel}}
+	outbox := mailer.NewFileMailer(t.TempDir())
+	app := handler.Application{Models: models.NewModels(db, outbox)}
+	userModel := app.Models.UserModel
 
 	t.Run("SignUpHandler", func(t *testing.T) {
 		body := map[string]interface{}{
@@ -42,11 +53,60 @@ func TestHandlers(t *testing.T) {
 		var created models.User
 		assert.NoError(t, db.Where("email = ?", "ellie@ufl.edu").First(&created).Error)
 		assert.False(t, created.Verified)
+		assert.NotEqual(t, 101, created.UserID, "IDs are assigned by the database, not the client")
+
+		var resp struct {
+			UserID   int    `json:"userid"`
+			PublicID string `json:"public_id"`
+		}
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		assert.Equal(t, created.UserID, resp.UserID)
+		assert.Equal(t, created.PublicID, resp.PublicID)
+		assert.NotEmpty(t, resp.PublicID)
+
+		sent := lastEmail(t, outbox)
+		assert.Contains(t, sent, "To: <ellie@ufl.edu>")
+		code := otpRegex.FindStringSubmatch(sent)
+		assert.Len(t, code, 2)
+
+		var otp models.OTP
+		assert.NoError(t, db.Where("userid = ? AND purpose = ?", created.UserID, models.PurposeEmailVerification).First(&otp).Error)
+		assert.NotContains(t, otp.CodeHash, code[1], "code must be stored hashed")
+	})
+
+	t.Run("SignUpHandler_DuplicateEmail", func(t *testing.T) {
+		body := map[string]interface{}{
+			"name": "Ellie Again", "email": "ellie@ufl.edu", "password": "AnotherStrongPassword@456",
+		}
+		req, _ := http.NewRequest(http.MethodPost, "/signup", toJSON(body))
+		rec := httptest.NewRecorder()
+		app.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("DisplayUserHandler_PublicID", func(t *testing.T) {
+		var created models.User
+		assert.NoError(t, db.Where("email = ?", "ellie@ufl.edu").First(&created).Error)
+
+		req, _ := http.NewRequest(http.MethodGet, "/displayUser/"+created.PublicID, nil)
+		rec := httptest.NewRecorder()
+		app.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "ellie@ufl.edu")
+
+		for _, id := range []string{strconv.Itoa(created.UserID), "not-a-uuid"} {
+			req, _ := http.NewRequest(http.MethodGet, "/displayUser/"+id, nil)
+			rec := httptest.NewRecorder()
+			app.Routes().ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusNotFound, rec.Code, "numeric IDs are not looked up")
+		}
 	})
 
 	t.Run("VerifyEmailHandler", func(t *testing.T) {
-		db.Create(&models.User{UserID: 202, Name: "Joel Miller", Email: "joel@ufl.edu", OTPCode: "123456"})
-		body := map[string]string{"email": "joel@ufl.edu", "code": "123456"}
+		db.Create(&models.User{UserID: 202, Name: "Joel Miller", Email: "joel@ufl.edu"})
+		code, err := userModel.IssueOTP(202, models.PurposeEmailVerification)
+		assert.NoError(t, err)
+		body := map[string]string{"email": "joel@ufl.edu", "code": code}
 		req, _ := http.NewRequest(http.MethodPost, "/verifyEmail", toJSON(body))
 		rec := httptest.NewRecorder()
 		app.Routes().ServeHTTP(rec, req)
@@ -55,6 +115,76 @@ func TestHandlers(t *testing.T) {
 		var u models.User
 		_ = db.Where("email = ?", "joel@ufl.edu").First(&u)
 		assert.True(t, u.Verified)
+
+		// The code is single-use.
+		req, _ = http.NewRequest(http.MethodPost, "/verifyEmail", toJSON(body))
+		rec = httptest.NewRecorder()
+		app.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("VerifyEmailHandlerRejectsResetCode", func(t *testing.T) {
+		db.Create(&models.User{UserID: 203, Name: "Dina Woodward", Email: "dina@ufl.edu"})
+		code, err := userModel.IssueOTP(203, models.PurposePasswordReset)
+		assert.NoError(t, err)
+		body := map[string]string{"email": "dina@ufl.edu", "code": code}
+		req, _ := http.NewRequest(http.MethodPost, "/verifyEmail", toJSON(body))
+		rec := httptest.NewRecorder()
+		app.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		var u models.User
+		_ = db.Where("email = ?", "dina@ufl.edu").First(&u)
+		assert.False(t, u.Verified)
+	})
+
+	t.Run("VerifyEmailHandlerRejectsExpiredCode", func(t *testing.T) {
+		db.Create(&models.User{UserID: 204, Name: "Jesse Ramirez", Email: "jesse@ufl.edu"})
+		code, err := userModel.IssueOTP(204, models.PurposeEmailVerification)
+		assert.NoError(t, err)
+		db.Model(&models.OTP{}).Where("userid = ?", 204).Update("issued_at", time.Now().Add(-models.DefaultOTPTTL-time.Minute))
+
+		body := map[string]string{"email": "jesse@ufl.edu", "code": code}
+		req, _ := http.NewRequest(http.MethodPost, "/verifyEmail", toJSON(body))
+		rec := httptest.NewRecorder()
+		app.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		var resp map[string]bool
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.True(t, resp["expired"])
+	})
+
+	t.Run("VerifyEmailHandlerLocksAfterWrongCodes", func(t *testing.T) {
+		db.Create(&models.User{UserID: 205, Name: "Nora Harris", Email: "nora@ufl.edu", Status: models.StatusPending})
+		code, err := userModel.IssueOTP(205, models.PurposeEmailVerification)
+		assert.NoError(t, err)
+
+		verify := func(code string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodPost, "/verifyEmail", toJSON(map[string]string{"email": "nora@ufl.edu", "code": code}))
+			rec := httptest.NewRecorder()
+			app.Routes().ServeHTTP(rec, req)
+			return rec
+		}
+		for i := 0; i < models.MaxFailedCodeAttempts; i++ {
+			assert.Equal(t, http.StatusUnauthorized, verify("000000").Code)
+		}
+
+		var u models.User
+		assert.NoError(t, db.Where("email = ?", "nora@ufl.edu").First(&u).Error, "wrong codes must not delete the account")
+		assert.Equal(t, models.StatusLocked, u.CurrentStatus(time.Now()))
+
+		rec := verify(code)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+		// After the cooling-off period a fresh code verifies the account.
+		db.Model(&models.User{}).Where("userid = ?", 205).Update("locked_until", time.Now().Add(-time.Second))
+		code, err = userModel.IssueOTP(205, models.PurposeEmailVerification)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, verify(code).Code)
+		assert.NoError(t, db.Where("email = ?", "nora@ufl.edu").First(&u).Error)
+		assert.Equal(t, models.StatusActive, u.Status)
 	})
 
 	t.Run("ForgotPasswordHandler", func(t *testing.T) {
@@ -64,29 +194,48 @@ func TestHandlers(t *testing.T) {
 		app.Routes().ServeHTTP(rec, req)
 		assert.Equal(t, http.StatusOK, rec.Code)
 
-		var updated models.User
-		_ = db.Where("email = ?", "tommy@ufl.edu").First(&updated)
-		assert.NotEmpty(t, updated.OTPCode)
+		sent := lastEmail(t, outbox)
+		assert.Contains(t, sent, "Subject: UniBazaar Password Reset Code")
+		assert.Regexp(t, otpRegex, sent)
+
+		var otp models.OTP
+		assert.NoError(t, db.Where("userid = ? AND purpose = ?", 303, models.PurposePasswordReset).First(&otp).Error)
 	})
 
 	t.Run("UpdatePasswordHandler", func(t *testing.T) {
-		db.Create(&models.User{UserID: 404, Name: "Sarah", Email: "sarah@ufl.edu", OTPCode: "654321", Verified: true})
+		db.Create(&models.User{UserID: 404, Name: "Sarah", Email: "sarah@ufl.edu", Verified: true})
+		signedIn, err := app.Models.RefreshTokens.Issue(404, "")
+		assert.NoError(t, err)
+		verifyCode, _ := userModel.IssueOTP(404, models.PurposeEmailVerification)
+		code, err := userModel.IssueOTP(404, models.PurposePasswordReset)
+		assert.NoError(t, err)
+
+		// An email-verification code cannot reset the password.
 		body := map[string]string{
-			"email": "sarah@ufl.edu", "otp_code": "654321", "new_password": "BrandNewPassword@99",
+			"email": "sarah@ufl.edu", "otp_code": verifyCode, "new_password": "BrandNewPassword@99",
 		}
 		req, _ := http.NewRequest(http.MethodPost, "/updatePassword", toJSON(body))
 		rec := httptest.NewRecorder()
 		app.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		body["otp_code"] = code
+		req, _ = http.NewRequest(http.MethodPost, "/updatePassword", toJSON(body))
+		rec = httptest.NewRecorder()
+		app.Routes().ServeHTTP(rec, req)
 		assert.Equal(t, http.StatusOK, rec.Code)
 
-		var updated models.User
-		_ = db.Where("email = ?", "sarah@ufl.edu").First(&updated)
-		assert.Empty(t, updated.OTPCode)
+		var remaining int64
+		db.Model(&models.OTP{}).Where("userid = ? AND purpose = ?", 404, models.PurposePasswordReset).Count(&remaining)
+		assert.Zero(t, remaining)
+		_, _, err = app.Models.RefreshTokens.Rotate(signedIn)
+		assert.ErrorIs(t, err, models.ErrRefreshTokenInvalid, "a password reset signs out every session")
 	})
 
 	t.Run("DisplayUserHandler", func(t *testing.T) {
-		db.Create(&models.User{UserID: 505, Name: "Henry", Email: "henry@ufl.edu"})
-		req, _ := http.NewRequest(http.MethodGet, "/displayUser/505", nil)
+		henry := models.User{UserID: 505, Name: "Henry", Email: "henry@ufl.edu"}
+		db.Create(&henry)
+		req, _ := http.NewRequest(http.MethodGet, "/displayUser/"+henry.PublicID, nil)
 		rec := httptest.NewRecorder()
 		app.Routes().ServeHTTP(rec, req)
 		assert.Equal(t, http.StatusOK, rec.Code)
@@ -106,17 +255,26 @@ func TestHandlers(t *testing.T) {
 			KeyLength:   32,
 		}
 		hash, _ := argon2id.CreateHash(raw, params)
-		db.Create(&models.User{UserID: 606, Name: "Bill", Email: "bill@ufl.edu", Password: hash, Verified: true})
+		bill := models.User{UserID: 606, Name: "Bill", Email: "bill@ufl.edu", Password: hash, Verified: true}
+		db.Create(&bill)
 
 		body := map[string]string{"email": "bill@ufl.edu", "password": raw, "newName": "Billy"}
 		req, _ := http.NewRequest(http.MethodPost, "/updateName", toJSON(body))
 		rec := httptest.NewRecorder()
 		app.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "email and password no longer identify the user")
+
+		token, err := utils.GenerateJWT(bill)
+		assert.NoError(t, err)
+		req, _ = http.NewRequest(http.MethodPatch, "/me", toJSON(map[string]string{"name": "Billy Jones"}))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec = httptest.NewRecorder()
+		app.Routes().ServeHTTP(rec, req)
 		assert.Equal(t, http.StatusOK, rec.Code)
 
 		var updated models.User
 		_ = db.Where("email = ?", "bill@ufl.edu").First(&updated)
-		assert.Equal(t, "Billy", updated.Name)
+		assert.Equal(t, "Billy Jones", updated.Name)
 	})
 
 	t.Run("UpdatePhoneHandler", func(t *testing.T) {
@@ -129,12 +287,21 @@ func TestHandlers(t *testing.T) {
 			KeyLength:   32,
 		}
 		hash, _ := argon2id.CreateHash(raw, params)
-		db.Create(&models.User{UserID: 707, Name: "Maria", Email: "maria@ufl.edu", Password: hash, Phone: "5551234567", Verified: true})
+		maria := models.User{UserID: 707, Name: "Maria", Email: "maria@ufl.edu", Password: hash, Phone: "5551234567", Verified: true}
+		db.Create(&maria)
 
 		body := map[string]string{"email": "maria@ufl.edu", "password": raw, "newPhone": "5559998888"}
 		req, _ := http.NewRequest(http.MethodPost, "/updatePhone", toJSON(body))
 		rec := httptest.NewRecorder()
 		app.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "email and password no longer identify the user")
+
+		token, err := utils.GenerateJWT(maria)
+		assert.NoError(t, err)
+		req, _ = http.NewRequest(http.MethodPatch, "/me", toJSON(map[string]string{"phone": "5559998888"}))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec = httptest.NewRecorder()
+		app.Routes().ServeHTTP(rec, req)
 		assert.Equal(t, http.StatusOK, rec.Code)
 
 		var updated models.User
@@ -143,20 +310,1184 @@ func TestHandlers(t *testing.T) {
 	})
 
 	t.Run("DeleteUserHandler", func(t *testing.T) {
-		db.Create(&models.User{UserID: 808, Name: "David", Email: "david@ufl.edu"})
-		body := map[string]string{"email": "david@ufl.edu"}
-		req, _ := http.NewRequest(http.MethodPost, "/deleteUser", toJSON(body))
+		hash, _ := argon2id.CreateHash("DeleteMe@2025", &argon2id.Params{Memory: 65536, Iterations: 2, Parallelism: 2, SaltLength: 16, KeyLength: 32})
+		david := models.User{UserID: 808, Name: "David", Email: "david@ufl.edu", Password: hash}
+		db.Create(&david)
+
+		req, _ := http.NewRequest(http.MethodPost, "/deleteUser", toJSON(map[string]string{"email": "david@ufl.edu", "password": "DeleteMe@2025"}))
 		rec := httptest.NewRecorder()
 		app.Routes().ServeHTTP(rec, req)
-		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "email and password no longer identify the user")
+
+		token, err := utils.GenerateJWT(david)
+		assert.NoError(t, err)
+		deleteMe := func(body interface{}) int {
+			req, _ := http.NewRequest(http.MethodDelete, "/me", toJSON(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.RemoteAddr = "198.51.100.80:443"
+			rec := httptest.NewRecorder()
+			app.Routes().ServeHTTP(rec, req)
+			return rec.Code
+		}
+		assert.Equal(t, http.StatusBadRequest, deleteMe(map[string]string{}), "the password is required")
+		assert.Equal(t, http.StatusUnauthorized, deleteMe(map[string]string{"password": "wrong"}))
+		assert.Equal(t, http.StatusNoContent, deleteMe(map[string]string{"password": "DeleteMe@2025"}))
 
 		var gone models.User
 		assert.Error(t, db.Where("email = ?", "david@ufl.edu").First(&gone).Error)
+		req, _ = http.NewRequest(http.MethodGet, "/verifyjwt", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec = httptest.NewRecorder()
+		app.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "the deleted user's tokens are revoked")
+	})
+
+	t.Run("LogoutRevokesAcrossInstances", func(t *testing.T) {
+		lev := models.User{UserID: 909, Name: "Lev", Email: "lev@ufl.edu", Verified: true}
+		db.Create(&lev)
+		token, err := utils.GenerateJWT(lev)
+		assert.NoError(t, err)
+		replica := handler.Application{Models: models.NewModels(db, outbox)}
+
+		req, _ := http.NewRequest(http.MethodGet, "/verifyjwt", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		replica.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		req, _ = http.NewRequest(http.MethodPost, "/logout", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec = httptest.NewRecorder()
+		app.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		req, _ = http.NewRequest(http.MethodGet, "/verifyjwt", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec = httptest.NewRecorder()
+		replica.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("VerifyJWTResolvesSubject", func(t *testing.T) {
+		db.Create(&models.User{UserID: 939, Name: "Sam Subject", Email: "sam.subject@ufl.edu", Verified: true})
+		db.Create(&models.User{UserID: 940, Name: "Dora Deactivated", Email: "dora.deactivated@ufl.edu", Verified: true, Status: models.StatusDeactivated})
+		verify := func(token string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodGet, "/verifyjwt", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			app.Routes().ServeHTTP(rec, req)
+			return rec
+		}
+		subOnly := func(sub string) string {
+			key := utils.CurrentKeySet().Active()
+			token := jwt.NewWithClaims(key.Method, jwt.MapClaims{
+				"sub": sub,
+				"exp": time.Now().Add(time.Minute).Unix(),
+				"iat": float64(time.Now().UnixMicro()) / 1e6,
+				"jti": "sub-only-" + sub,
+			})
+			token.Header["kid"] = key.ID
+			signed, err := token.SignedString(key.Key)
+			assert.NoError(t, err)
+			return signed
+		}
+
+		rec := verify(subOnly("939"))
+		assert.Equal(t, http.StatusOK, rec.Code, "the legacy user claim is not needed")
+		assert.Contains(t, rec.Body.String(), "sam.subject@ufl.edu")
+
+		service, err := utils.GenerateServiceJWT("messaging", "users:sync")
+		assert.NoError(t, err)
+		rec = verify(service)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "service:users")
+
+		assert.Equal(t, http.StatusUnauthorized, verify(subOnly("999999")).Code, "unknown user")
+		assert.Equal(t, http.StatusUnauthorized, verify(subOnly("service:users")).Code, "not a user ID and not a service token")
+		assert.Equal(t, http.StatusUnauthorized, verify(subOnly("940")).Code, "deactivated user")
+	})
+
+	t.Run("LoginAndRefreshRotation", func(t *testing.T) {
+		raw := "RefreshRotation@2025"
+		hash, _ := argon2id.CreateHash(raw, &argon2id.Params{Memory: 65536, Iterations: 2, Parallelism: 2, SaltLength: 16, KeyLength: 32})
+		db.Create(&models.User{UserID: 910, Name: "Owen Moore", Email: "owen@ufl.edu", Password: hash, Verified: true})
+
+		req, _ := http.NewRequest(http.MethodPost, "/login", toJSON(map[string]string{"email": "owen@ufl.edu", "password": raw}))
+		rec := httptest.NewRecorder()
+		app.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var login map[string]interface{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &login)
+		first, _ := login["refresh_token"].(string)
+		assert.NotEmpty(t, login["token"])
+		assert.NotEmpty(t, login["public_id"])
+		assert.NotEmpty(t, first)
+
+		refresh := func(token string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodPost, "/token/refresh", toJSON(map[string]string{"refresh_token": token}))
+			rec := httptest.NewRecorder()
+			app.Routes().ServeHTTP(rec, req)
+			return rec
+		}
+
+		rec = refresh(first)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var rotated map[string]interface{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &rotated)
+		second, _ := rotated["refresh_token"].(string)
+		assert.NotEmpty(t, second)
+		assert.NotEqual(t, first, second)
+
+		// Replaying the rotated token revokes the family, including the latest token.
+		assert.Equal(t, http.StatusUnauthorized, refresh(first).Code)
+		assert.Equal(t, http.StatusUnauthorized, refresh(second).Code)
+
+		// Locking or deactivating the account ends its sessions at the next refresh.
+		loginRefresh := func() string {
+			req, _ := http.NewRequest(http.MethodPost, "/login", toJSON(map[string]string{"email": "owen@ufl.edu", "password": raw}))
+			rec := httptest.NewRecorder()
+			app.Routes().ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			var login map[string]interface{}
+			_ = json.Unmarshal(rec.Body.Bytes(), &login)
+			token, _ := login["refresh_token"].(string)
+			return token
+		}
+		setStatus := func(status models.AccountStatus, lockedUntil *time.Time) {
+			db.Model(&models.User{}).Where("userid = ?", 910).Updates(map[string]interface{}{"status": status, "locked_until": lockedUntil})
+		}
+		token := loginRefresh()
+		until := time.Now().Add(time.Hour)
+		setStatus(models.StatusLocked, &until)
+		assert.Equal(t, http.StatusTooManyRequests, refresh(token).Code)
+		setStatus(models.StatusActive, nil)
+		assert.Equal(t, http.StatusUnauthorized, refresh(token).Code, "the session stays revoked after the lock lifts")
+
+		token = loginRefresh()
+		setStatus(models.StatusDeactivated, nil)
+		rec = refresh(token)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), "account is deactivated")
+		setStatus(models.StatusActive, nil)
+		assert.Equal(t, http.StatusUnauthorized, refresh(token).Code)
+	})
+
+	t.Run("MeHandlers", func(t *testing.T) {
+		raw := "SelfService@2025"
+		hash, _ := argon2id.CreateHash(raw, &argon2id.Params{Memory: 65536, Iterations: 2, Parallelism: 2, SaltLength: 16, KeyLength: 32})
+		user := models.User{UserID: 920, Name: "Dina Rivera", Email: "dina.rivera@ufl.edu", Password: hash, Verified: true}
+		db.Create(&user)
+		token, err := utils.GenerateJWT(user)
+		assert.NoError(t, err)
+		db.Create(&models.RefreshToken{UserID: 920, TokenHash: "dina-refresh", FamilyID: "dina-family", ExpiresAt: time.Now().Add(time.Hour)})
+
+		me := func(method, token string, body interface{}) *httptest.ResponseRecorder {
+			var req *http.Request
+			if body != nil {
+				req, _ = http.NewRequest(method, "/me", toJSON(body))
+			} else {
+				req, _ = http.NewRequest(method, "/me", nil)
+			}
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			rec := httptest.NewRecorder()
+			app.Routes().ServeHTTP(rec, req)
+			return rec
+		}
+
+		assert.Equal(t, http.StatusUnauthorized, me(http.MethodGet, "", nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, me(http.MethodGet, "not-a-token", nil).Code)
+
+		rec := me(http.MethodGet, token, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var profile map[string]interface{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &profile)
+		assert.Equal(t, "dina.rivera@ufl.edu", profile["email"])
+		assert.NotContains(t, profile, "password")
+
+		assert.Equal(t, http.StatusBadRequest, me(http.MethodPatch, token, map[string]string{"name": "Dina"}).Code)
+		rec = me(http.MethodPatch, token, map[string]string{"name": "Dina  R", "phone": "3525551234"})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var updated models.User
+		db.First(&updated, 920)
+		assert.Equal(t, "Dina R", updated.Name)
+		assert.Equal(t, "3525551234", updated.Phone)
+
+		assert.Equal(t, http.StatusBadRequest, me(http.MethodDelete, token, map[string]string{}).Code)
+		assert.Equal(t, http.StatusUnauthorized, me(http.MethodDelete, token, map[string]string{"password": "wrong"}).Code)
+		assert.Equal(t, http.StatusNoContent, me(http.MethodDelete, token, map[string]string{"password": raw}).Code)
+
+		assert.Error(t, db.First(&models.User{}, 920).Error)
+		var refresh models.RefreshToken
+		db.Where("token_hash = ?", "dina-refresh").First(&refresh)
+		assert.NotNil(t, refresh.RevokedAt, "refresh tokens are revoked")
+		assert.Equal(t, http.StatusUnauthorized, me(http.MethodGet, token, nil).Code, "the access token is revoked")
+
+		var events []models.OutboxEvent
+		db.Where("userid = ? AND type = ?", 920, models.EventUserDeleted).Find(&events)
+		assert.Len(t, events, len(models.EventDestinations), "deletion is published to every service")
+	})
+
+	t.Run("EmailChange", func(t *testing.T) {
+		raw := "ChangeEmail@2025"
+		hash, _ := argon2id.CreateHash(raw, &argon2id.Params{Memory: 65536, Iterations: 2, Parallelism: 2, SaltLength: 16, KeyLength: 32})
+		user := models.User{UserID: 921, Name: "Jesse Wu", Email: "jwu@ufl.edu", Password: hash, Verified: true}
+		db.Create(&user)
+		db.Create(&models.User{UserID: 922, Name: "Nora Harris", Email: "nora.harris@ufl.edu", Verified: true})
+		token, err := utils.GenerateJWT(user)
+		assert.NoError(t, err)
+
+		post := func(path string, body interface{}) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodPost, path, toJSON(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			app.Routes().ServeHTTP(rec, req)
+			return rec
+		}
+
+		assert.Equal(t, http.StatusBadRequest, post("/me/email/confirm", map[string]string{"code": "123456"}).Code, "nothing is pending")
+		assert.Equal(t, http.StatusUnauthorized, post("/me/email", map[string]string{"new_email": "jesse.wu@ufl.edu", "password": "wrong"}).Code)
+		assert.Equal(t, http.StatusBadRequest, post("/me/email", map[string]string{"new_email": "jesse@gmail.com", "password": raw}).Code)
+		assert.Equal(t, http.StatusConflict, post("/me/email", map[string]string{"new_email": "nora.harris@ufl.edu", "password": raw}).Code)
+
+		assert.Equal(t, http.StatusAccepted, post("/me/email", map[string]string{"new_email": "jesse.wu@ufl.edu", "password": raw}).Code)
+		paths, err := outbox.Messages()
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, len(paths), 2)
+		confirmation, _ := os.ReadFile(paths[len(paths)-2])
+		assert.Contains(t, string(confirmation), "To: <jesse.wu@ufl.edu>")
+		match := otpRegex.FindStringSubmatch(string(confirmation))
+		assert.Len(t, match, 2)
+		notice := lastEmail(t, outbox)
+		assert.Contains(t, notice, "To: <jwu@ufl.edu>")
+		assert.Contains(t, notice, "jesse.wu@ufl.edu")
+
+		var pending models.User
+		db.First(&pending, 921)
+		assert.Equal(t, "jwu@ufl.edu", pending.Email, "the email only changes once confirmed")
+
+		assert.Equal(t, http.StatusUnauthorized, post("/me/email/confirm", map[string]string{"code": "000000"}).Code)
+		rec := post("/me/email/confirm", map[string]string{"code": match[1]})
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var changed models.User
+		db.First(&changed, 921)
+		assert.Equal(t, "jesse.wu@ufl.edu", changed.Email)
+		assert.Empty(t, changed.PendingEmail)
+
+		assert.Equal(t, http.StatusUnauthorized, post("/me/email/confirm", map[string]string{"code": match[1]}).Code, "outstanding tokens are revoked")
+		req, _ := http.NewRequest(http.MethodGet, "/verifyjwt", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec = httptest.NewRecorder()
+		app.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		var events []models.OutboxEvent
+		db.Where("userid = ? AND type = ?", 921, models.EventUserUpdated).Find(&events)
+		if assert.Len(t, events, len(models.EventDestinations)) {
+			ev, err := events[0].Event()
+			assert.NoError(t, err)
+			assert.Equal(t, "jesse.wu@ufl.edu", ev.Email)
+		}
+	})
+
+	t.Run("PhoneVerification", func(t *testing.T) {
+		user := models.User{UserID: 923, Name: "Lev Ortiz", Email: "lev.ortiz@ufl.edu", Phone: "352-555-1234", Verified: true}
+		db.Create(&user)
+		token, err := utils.GenerateJWT(user)
+		assert.NoError(t, err)
+		texts := &sms.FileSender{Dir: t.TempDir()}
+		texting := handler.Application{Models: app.Models}
+		texting.Models.UserModel.SMS = texts
+
+		do := func(a handler.Application, method, path string, body interface{}) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(method, path, toJSON(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			a.Routes().ServeHTTP(rec, req)
+			return rec
+		}
+
+		assert.Equal(t, http.StatusServiceUnavailable, do(app, http.MethodPost, "/me/phone/verify", nil).Code, "no SMS backend configured")
+		assert.Equal(t, http.StatusAccepted, do(texting, http.MethodPost, "/me/phone/verify", nil).Code)
+		assert.Equal(t, http.StatusTooManyRequests, do(texting, http.MethodPost, "/me/phone/verify", nil).Code)
+
+		paths, err := texts.Messages()
+		assert.NoError(t, err)
+		if !assert.Len(t, paths, 1) {
+			return
+		}
+		raw, _ := os.ReadFile(paths[0])
+		assert.Contains(t, string(raw), "To: +13525551234")
+		code := regexp.MustCompile(`code is (\d{6})`).FindStringSubmatch(string(raw))
+		if !assert.Len(t, code, 2) {
+			return
+		}
+
+		assert.Equal(t, http.StatusUnauthorized, do(texting, http.MethodPost, "/me/phone/confirm", map[string]string{"code": "000000"}).Code)
+		assert.Equal(t, http.StatusOK, do(texting, http.MethodPost, "/me/phone/confirm", map[string]string{"code": code[1]}).Code)
+
+		req, _ := http.NewRequest(http.MethodGet, "/displayUser/"+user.PublicID, nil)
+		rec := httptest.NewRecorder()
+		app.Routes().ServeHTTP(rec, req)
+		var shown map[string]interface{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &shown)
+		assert.Equal(t, true, shown["phone_verified"])
+
+		var event models.OutboxEvent
+		db.Where("userid = ? AND type = ?", 923, models.EventUserUpdated).Order("id DESC").First(&event)
+		ev, err := event.Event()
+		assert.NoError(t, err)
+		assert.True(t, ev.PhoneVerified, "listings learn about the verified phone")
+
+		assert.Equal(t, http.StatusConflict, do(texting, http.MethodPost, "/me/phone/verify", nil).Code)
+		assert.Equal(t, http.StatusOK, do(app, http.MethodPatch, "/me", map[string]string{"phone": "3525559999"}).Code)
+		var changed models.User
+		db.First(&changed, 923)
+		assert.False(t, changed.PhoneVerified, "a new number has to be verified again")
+	})
+
+	t.Run("TwoFactor", func(t *testing.T) {
+		params := &argon2id.Params{Memory: 65536, Iterations: 2, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+		hash, _ := argon2id.CreateHash("Secret123!", params)
+		user := models.User{UserID: 924, Name: "Ada Byron", Email: "ada.byron@ufl.edu", Password: hash, Verified: true}
+		db.Create(&user)
+		token, err := utils.GenerateJWT(user)
+		assert.NoError(t, err)
+
+		// The wrong codes below would otherwise start the login backoff, and
+		// a client address of its own keeps them out of the other subtests.
+		lenient := handler.Application{Models: app.Models}
+		lenient.Models.LoginThrottle.Policy = models.ThrottlePolicy{
+			FreeAttempts: 100, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond,
+			EmailLockoutAfter: 100, IPLockoutAfter: 100, LockoutDuration: time.Hour, ResetAfter: time.Hour,
+		}
+
+		do := func(method, path, bearer string, body interface{}) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(method, path, toJSON(body))
+			req.RemoteAddr = "198.51.100.24:40000"
+			if bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+bearer)
+			}
+			rec := httptest.NewRecorder()
+			lenient.Routes().ServeHTTP(rec, req)
+			return rec
+		}
+		login := func() string {
+			rec := do(http.MethodPost, "/login", "", map[string]string{"email": user.Email, "password": "Secret123!"})
+			assert.Equal(t, http.StatusOK, rec.Code)
+			var resp map[string]interface{}
+			_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+			assert.Equal(t, true, resp["two_factor_required"])
+			assert.Nil(t, resp["token"], "no tokens before the second factor")
+			challenge, _ := resp["challenge_token"].(string)
+			return challenge
+		}
+
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/me/2fa/enroll", token, map[string]string{"password": "wrong"}).Code)
+		rec := do(http.MethodPost, "/me/2fa/enroll", token, map[string]string{"password": "Secret123!"})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var enrollment map[string]string
+		_ = json.Unmarshal(rec.Body.Bytes(), &enrollment)
+		secret := enrollment["secret"]
+		assert.Contains(t, enrollment["otpauth_uri"], "otpauth://totp/")
+		png, err := base64.StdEncoding.DecodeString(enrollment["qr_png"])
+		assert.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(png, []byte("\x89PNG")))
+
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/me/2fa/confirm", token, map[string]string{"code": "000000"}).Code)
+		code, _ := totp.GenerateCode(secret, time.Now())
+		rec = do(http.MethodPost, "/me/2fa/confirm", token, map[string]string{"code": code})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var confirmed struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		}
+		_ = json.Unmarshal(rec.Body.Bytes(), &confirmed)
+		assert.Len(t, confirmed.RecoveryCodes, 10)
+		assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/me/2fa/enroll", token, map[string]string{"password": "Secret123!"}).Code)
+
+		challenge := login()
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/login/2fa", "", map[string]string{"challenge_token": challenge, "code": code}).Code, "a TOTP step cannot be reused")
+		// The confirmation used the current step, so sign in with the next one.
+		next, _ := totp.GenerateCode(secret, time.Now().Add(30*time.Second))
+		rec = do(http.MethodPost, "/login/2fa", "", map[string]string{"challenge_token": challenge, "code": next})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var signedIn map[string]interface{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &signedIn)
+		assert.NotEmpty(t, signedIn["token"])
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/login/2fa", "", map[string]string{"challenge_token": challenge, "code": next}).Code, "a challenge is single use")
+
+		challenge = login()
+		rec = do(http.MethodPost, "/login/2fa", "", map[string]string{"challenge_token": challenge, "code": confirmed.RecoveryCodes[0]})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		challenge = login()
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/login/2fa", "", map[string]string{"challenge_token": challenge, "code": confirmed.RecoveryCodes[0]}).Code, "recovery codes are single use")
+		remaining, err := app.Models.TwoFactor.RemainingRecoveryCodes(924)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(9), remaining)
+
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodDelete, "/me/2fa", token, map[string]string{"password": "Secret123!", "code": "000000"}).Code)
+		assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/me/2fa", token, map[string]string{"password": "Secret123!", "code": confirmed.RecoveryCodes[1]}).Code)
+		rec = do(http.MethodPost, "/login", "", map[string]string{"email": user.Email, "password": "Secret123!"})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"token"`)
+	})
+
+	t.Run("Passkeys", func(t *testing.T) {
+		user := models.User{UserID: 925, Name: "Grace Hopper", Email: "grace.hopper@ufl.edu", Verified: true}
+		db.Create(&user)
+		token, err := utils.GenerateJWT(user)
+		assert.NoError(t, err)
+		wa, err := webauthn.New(&webauthn.Config{RPID: "unibazaar.test", RPDisplayName: "UniBazaar", RPOrigins: []string{"https://unibazaar.test"}})
+		assert.NoError(t, err)
+		passkeys := handler.Application{Models: app.Models}
+		passkeys.Models.Passkeys.WebAuthn = wa
+		authenticator := newSoftAuthenticator("unibazaar.test", "https://unibazaar.test")
+
+		do := func(a handler.Application, method, path, bearer string, body interface{}) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(method, path, toJSON(body))
+			if bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+bearer)
+			}
+			rec := httptest.NewRecorder()
+			a.Routes().ServeHTTP(rec, req)
+			return rec
+		}
+		var begun struct {
+			SessionToken string          `json:"session_token"`
+			Options      json.RawMessage `json:"options"`
+		}
+
+		assert.Equal(t, http.StatusServiceUnavailable, do(app, http.MethodPost, "/me/passkeys", token, map[string]string{}).Code, "passkeys not configured")
+
+		rec := do(passkeys, http.MethodPost, "/me/passkeys", token, map[string]string{})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		_ = json.Unmarshal(rec.Body.Bytes(), &begun)
+		var creation creationOptions
+		_ = json.Unmarshal(begun.Options, &creation)
+		assert.Equal(t, "unibazaar.test", creation.PublicKey.RP.ID)
+		assert.Contains(t, string(begun.Options), `"userVerification":"required"`)
+		authenticator.skipUserVerification = true
+		unverified, _ := authenticator.create(t, creation)
+		authenticator.skipUserVerification = false
+		assert.Equal(t, http.StatusUnauthorized, do(passkeys, http.MethodPost, "/me/passkeys/finish", token, map[string]interface{}{"session_token": begun.SessionToken, "credential": unverified}).Code, "registration requires user verification")
+		rec = do(passkeys, http.MethodPost, "/me/passkeys", token, map[string]string{})
+		_ = json.Unmarshal(rec.Body.Bytes(), &begun)
+		_ = json.Unmarshal(begun.Options, &creation)
+		credential, cred := authenticator.create(t, creation)
+		assert.Equal(t, user.PublicID, string(cred.userHandle), "authenticators know the public ID")
+
+		rec = do(passkeys, http.MethodPost, "/me/passkeys/finish", token, map[string]interface{}{"session_token": begun.SessionToken, "name": "Laptop", "credential": credential})
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, http.StatusBadRequest, do(passkeys, http.MethodPost, "/me/passkeys/finish", token, map[string]interface{}{"session_token": begun.SessionToken, "credential": credential}).Code, "a ceremony finishes once")
+
+		rec = do(passkeys, http.MethodGet, "/me/passkeys", token, nil)
+		var listed []map[string]interface{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &listed)
+		if !assert.Len(t, listed, 1) {
+			return
+		}
+		assert.Equal(t, "Laptop", listed[0]["name"])
+
+		login := func(body map[string]string) *httptest.ResponseRecorder {
+			rec := do(passkeys, http.MethodPost, "/login/passkey", "", body)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			_ = json.Unmarshal(rec.Body.Bytes(), &begun)
+			var request requestOptions
+			_ = json.Unmarshal(begun.Options, &request)
+			return do(passkeys, http.MethodPost, "/login/passkey/finish", "", map[string]interface{}{
+				"session_token": begun.SessionToken,
+				"credential":    authenticator.get(t, request, cred),
+			})
+		}
+
+		rec = login(map[string]string{})
+		assert.Equal(t, http.StatusOK, rec.Code, "discoverable login")
+		var signedIn map[string]interface{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &signedIn)
+		parsed, err := utils.ParseJWT(signedIn["token"].(string))
+		assert.NoError(t, err)
+		sub, _ := parsed.Claims.GetSubject()
+		assert.Equal(t, "925", sub)
+
+		assert.Equal(t, http.StatusOK, login(map[string]string{"email": user.Email}).Code, "login for a named account")
+
+		authenticator.skipUserVerification = true
+		assert.Equal(t, http.StatusUnauthorized, login(map[string]string{}).Code, "a passkey without user verification does not replace a second factor")
+		assert.Equal(t, http.StatusUnauthorized, login(map[string]string{"email": user.Email}).Code)
+		authenticator.skipUserVerification = false
+
+		cred.signCount = 0
+		assert.Equal(t, http.StatusUnauthorized, login(map[string]string{}).Code, "a counter that goes backwards is refused")
+
+		stranger := *cred
+		stranger.key, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		stranger.signCount = 100
+		rec = do(passkeys, http.MethodPost, "/login/passkey", "", map[string]string{})
+		_ = json.Unmarshal(rec.Body.Bytes(), &begun)
+		var request requestOptions
+		_ = json.Unmarshal(begun.Options, &request)
+		rec = do(passkeys, http.MethodPost, "/login/passkey/finish", "", map[string]interface{}{"session_token": begun.SessionToken, "credential": authenticator.get(t, request, &stranger)})
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "signature from another key")
+
+		id := strconv.Itoa(int(listed[0]["id"].(float64)))
+		assert.Equal(t, http.StatusNoContent, do(passkeys, http.MethodDelete, "/me/passkeys/"+id, token, nil).Code)
+		assert.Equal(t, http.StatusNotFound, do(passkeys, http.MethodDelete, "/me/passkeys/"+id, token, nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, do(passkeys, http.MethodPost, "/login/passkey", "", map[string]string{"email": user.Email}).Code, "no passkeys left")
+	})
+
+	t.Run("Sessions", func(t *testing.T) {
+		hash, _ := argon2id.CreateHash("Sessions@2025", &argon2id.Params{Memory: 65536, Iterations: 2, Parallelism: 2, SaltLength: 16, KeyLength: 32})
+		db.Create(&models.User{UserID: 926, Name: "Katherine Johnson", Email: "katherine@ufl.edu", Password: hash, Verified: true})
+
+		do := func(method, path, bearer string, body interface{}) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(method, path, toJSON(body))
+			if bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+bearer)
+			}
+			rec := httptest.NewRecorder()
+			app.Routes().ServeHTTP(rec, req)
+			return rec
+		}
+		login := func(userAgent string) (access, refresh string) {
+			req, _ := http.NewRequest(http.MethodPost, "/login", toJSON(map[string]string{"email": "katherine@ufl.edu", "password": "Sessions@2025"}))
+			req.Header.Set("User-Agent", userAgent)
+			req.RemoteAddr = "203.0.113.7:51000"
+			rec := httptest.NewRecorder()
+			app.Routes().ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			var resp map[string]interface{}
+			_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+			access, _ = resp["token"].(string)
+			refresh, _ = resp["refresh_token"].(string)
+			return access, refresh
+		}
+		list := func(bearer string) []map[string]interface{} {
+			rec := do(http.MethodGet, "/sessions", bearer, nil)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			var sessions []map[string]interface{}
+			_ = json.Unmarshal(rec.Body.Bytes(), &sessions)
+			return sessions
+		}
+
+		laptop, _ := login("Mozilla/5.0 (Macintosh; Intel Mac OS X 14_4) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15")
+		phone, phoneRefresh := login("Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0 Mobile Safari/537.36")
+		tablet, tabletRefresh := login("Mozilla/5.0 (iPad; CPU OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1")
+
+		sessions := list(laptop)
+		if !assert.Len(t, sessions, 3) {
+			return
+		}
+		devices := map[string]bool{}
+		var phoneSession string
+		for _, s := range sessions {
+			devices[s["device"].(string)] = s["current"].(bool)
+			assert.Equal(t, "203.0.113.7", s["ip"])
+			if s["device"] == "Chrome on Android" {
+				phoneSession = s["id"].(string)
+			}
+		}
+		assert.Equal(t, map[string]bool{"Safari on macOS": true, "Chrome on Android": false, "Safari on iPadOS": false}, devices)
+
+		assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/sessions/"+phoneSession, laptop, nil).Code)
+		assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/sessions/"+phoneSession, laptop, nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/me", phone, nil).Code, "the session's access token is revoked")
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/token/refresh", "", map[string]string{"refresh_token": phoneRefresh}).Code)
+		assert.Len(t, list(laptop), 2)
+
+		rec := do(http.MethodDelete, "/sessions", laptop, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"revoked": 1}`, rec.Body.String())
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/me", tablet, nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/token/refresh", "", map[string]string{"refresh_token": tabletRefresh}).Code)
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, "/me", laptop, nil).Code, "the current session stays signed in")
+
+		assert.Equal(t, http.StatusOK, do(http.MethodPost, "/logout", laptop, nil).Code)
+		var live int64
+		db.Model(&models.RefreshToken{}).Where("userid = ? AND revoked_at IS NULL", 926).Count(&live)
+		assert.Zero(t, live, "logging out ends the session, not only the access token")
+	})
+
+	t.Run("Roles", func(t *testing.T) {
+		admin := models.User{UserID: 927, Name: "Ida Admin", Email: "ida.admin@ufl.edu", Verified: true, Role: models.RoleAdmin}
+		student := models.User{UserID: 928, Name: "Sam Student", Email: "sam.student@ufl.edu", Verified: true}
+		db.Create(&admin)
+		db.Create(&student)
+		adminToken, err := utils.GenerateJWT(admin)
+		assert.NoError(t, err)
+		studentToken, err := utils.GenerateJWT(student)
+		assert.NoError(t, err)
+
+		do := func(method, path, bearer string, body interface{}) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(method, path, toJSON(body))
+			req.Header.Set("Authorization", "Bearer "+bearer)
+			rec := httptest.NewRecorder()
+			app.Routes().ServeHTTP(rec, req)
+			return rec
+		}
+
+		parsed, err := utils.ParseJWT(studentToken)
+		assert.NoError(t, err)
+		claims := parsed.Claims.(jwt.MapClaims)
+		assert.Equal(t, "student", claims["role"])
+		assert.Empty(t, claims["perms"])
+
+		var me map[string]interface{}
+		_ = json.Unmarshal(do(http.MethodGet, "/me", adminToken, nil).Body.Bytes(), &me)
+		assert.Equal(t, "admin", me["role"])
+
+		assert.Equal(t, http.StatusForbidden, do(http.MethodPut, "/admin/users/927/role", studentToken, map[string]string{"role": "admin"}).Code)
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/admin/users/928/role", adminToken, map[string]string{"role": "owner"}).Code)
+		assert.Equal(t, http.StatusConflict, do(http.MethodPut, "/admin/users/927/role", adminToken, map[string]string{"role": "student"}).Code)
+		assert.Equal(t, http.StatusNotFound, do(http.MethodPut, "/admin/users/99999/role", adminToken, map[string]string{"role": "moderator"}).Code)
+
+		rec := do(http.MethodPut, "/admin/users/928/role", adminToken, map[string]string{"role": "moderator"})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"userid": 928, "role": "moderator", "permissions": ["listings:moderate"]}`, rec.Body.String())
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/me", studentToken, nil).Code, "tokens with the old role are revoked")
+
+		var promoted models.User
+		db.First(&promoted, 928)
+		moderatorToken, err := utils.GenerateJWT(promoted)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, "/me", moderatorToken, nil).Code, "a token issued right after the revocation stays valid")
+		parsed, err = utils.ParseJWT(moderatorToken)
+		assert.NoError(t, err)
+		claims = parsed.Claims.(jwt.MapClaims)
+		assert.Equal(t, "moderator", claims["role"])
+		assert.Equal(t, []interface{}{"listings:moderate"}, claims["perms"])
+
+		assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/admin/universities", moderatorToken, map[string]string{"domain": "rice.edu", "name": "Rice University"}).Code)
+		assert.Equal(t, http.StatusCreated, do(http.MethodPost, "/admin/universities", adminToken, map[string]string{"domain": "rice.edu", "name": "Rice University"}).Code, "admins manage universities")
+	})
+
+	t.Run("AdminUsers", func(t *testing.T) {
+		admin := models.User{UserID: 929, Name: "Ada Operator", Email: "ada.operator@ufl.edu", Verified: true, Role: models.RoleAdmin}
+		target := models.User{UserID: 930, Name: "Tess Target", Email: "tess.target@ufl.edu", Verified: true, Status: models.StatusActive}
+		pending := models.User{UserID: 931, Name: "Uma Unverified", Email: "uma@cs.fiu.edu", Status: models.StatusPending}
+		db.Create(&admin)
+		db.Create(&target)
+		db.Create(&pending)
+		fiu := models.University{Domain: "fiu.edu", Name: "Florida International University", Enabled: true}
+		assert.NoError(t, app.Models.Universities.Create(&fiu))
+		adminToken, err := utils.GenerateJWT(admin)
+		assert.NoError(t, err)
+		targetToken, err := utils.GenerateJWT(target)
+		assert.NoError(t, err)
+
+		do := func(method, path, bearer string, body interface{}) *httptest.ResponseRecorder {
+			var reader io.Reader = http.NoBody
+			if body != nil {
+				reader = toJSON(body)
+			}
+			req, _ := http.NewRequest(method, path, reader)
+			req.Header.Set("Authorization", "Bearer "+bearer)
+			req.RemoteAddr = "198.51.100.9:443"
+			rec := httptest.NewRecorder()
+			app.Routes().ServeHTTP(rec, req)
+			return rec
+		}
+		type userPage struct {
+			Users []struct {
+				UserID int    `json:"userid"`
+				Status string `json:"status"`
+			} `json:"users"`
+			Total int `json:"total"`
+		}
+		list := func(query string) userPage {
+			rec := do(http.MethodGet, "/admin/users?"+query, adminToken, nil)
+			assert.Equal(t, http.StatusOK, rec.Code, query)
+			var page userPage
+			_ = json.Unmarshal(rec.Body.Bytes(), &page)
+			return page
+		}
+		status := func(id int) models.AccountStatus {
+			var user models.User
+			db.Unscoped().First(&user, id)
+			return user.Status
+		}
+
+		assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/admin/users", targetToken, nil).Code)
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/admin/users?verified=maybe", adminToken, nil).Code)
+
+		page := list("q=TESS")
+		assert.Equal(t, 1, page.Total)
+		assert.Equal(t, 930, page.Users[0].UserID)
+		page = list(fmt.Sprintf("verified=false&university=%d", fiu.ID))
+		assert.Equal(t, 1, page.Total, "subdomains belong to the university")
+		assert.Equal(t, 931, page.Users[0].UserID)
+		assert.Equal(t, 0, list("q=tess&created_after="+time.Now().AddDate(0, 0, 1).Format("2006-01-02")).Total)
+		assert.Equal(t, 1, list("q=tess&created_before="+time.Now().Add(time.Minute).Format(time.RFC3339)).Total)
+		assert.Equal(t, 0, list("q=%25").Total, "wildcards match literally")
+
+		assert.Equal(t, http.StatusOK, do(http.MethodPost, "/admin/users/931/verify", adminToken, nil).Code)
+		assert.Equal(t, models.StatusActive, status(931))
+		assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/admin/users/931/verify", adminToken, nil).Code)
+
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/admin/users/930/lock", adminToken, map[string]string{"duration": "soon"}).Code)
+		assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/admin/users/929/lock", adminToken, map[string]string{"duration": "1h"}).Code)
+		rec := do(http.MethodPost, "/admin/users/930/lock", adminToken, map[string]string{"duration": "1h", "reason": "spam listings"})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"status":"locked"`)
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/me", targetToken, nil).Code, "locking signs the user out")
+		assert.Equal(t, http.StatusOK, do(http.MethodPost, "/admin/users/930/unlock", adminToken, nil).Code)
+		assert.Equal(t, models.StatusActive, status(930))
+
+		hash, _ := argon2id.CreateHash("Deactivated@2025", &argon2id.Params{Memory: 65536, Iterations: 2, Parallelism: 2, SaltLength: 16, KeyLength: 32})
+		db.Model(&models.User{}).Where("userid = ?", 930).Update("password", hash)
+		login := func() *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodPost, "/login", toJSON(map[string]string{"email": "tess.target@ufl.edu", "password": "Deactivated@2025"}))
+			req.RemoteAddr = "198.51.100.9:443"
+			rec := httptest.NewRecorder()
+			app.Routes().ServeHTTP(rec, req)
+			return rec
+		}
+		assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/admin/users/929/deactivate", adminToken, nil).Code)
+		assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/admin/users/930/reactivate", adminToken, nil).Code, "only deactivated accounts are reactivated")
+		rec = do(http.MethodPost, "/admin/users/930/deactivate", adminToken, map[string]string{"reason": "graduated"})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"status":"deactivated"`)
+		assert.Equal(t, models.StatusDeactivated, status(930))
+		rec = login()
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), "account is deactivated")
+		assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/admin/users/930/lock", adminToken, map[string]string{"duration": "1h"}).Code)
+		assert.Equal(t, http.StatusOK, do(http.MethodPost, "/admin/users/930/reactivate", adminToken, nil).Code)
+		assert.Equal(t, models.StatusActive, status(930))
+		assert.Equal(t, http.StatusOK, login().Code)
+
+		assert.Equal(t, http.StatusConflict, do(http.MethodDelete, "/admin/users/930/2fa", adminToken, nil).Code)
+		db.Model(&models.User{}).Where("userid = ?", 930).Updates(map[string]interface{}{"totp_enabled": true, "totp_secret": "SECRET"})
+		db.Create(&models.RecoveryCode{UserID: 930, CodeHash: "hash"})
+		assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/admin/users/930/2fa", adminToken, nil).Code)
+		var reset models.User
+		db.First(&reset, 930)
+		assert.False(t, reset.TOTPEnabled)
+		assert.Empty(t, reset.TOTPSecret)
+
+		assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/admin/users/930", adminToken, map[string]string{"reason": "requested by owner"}).Code)
+		assert.Equal(t, models.StatusDeleted, status(930))
+		assert.Equal(t, 0, list("q=tess").Total)
+		assert.Equal(t, 1, list("q=tess&deleted=true").Total)
+		assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/admin/users/930/verify", adminToken, nil).Code)
+		rec = do(http.MethodPost, "/admin/users/930/restore", adminToken, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"status":"active"`)
+		assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/admin/users/930/restore", adminToken, nil).Code)
+		var restored []models.OutboxEvent
+		db.Where("userid = ? AND type = ?", 930, models.EventUserCreated).Find(&restored)
+		assert.NotEmpty(t, restored, "other services learn of the restored account")
+
+		rec = do(http.MethodGet, "/admin/users/930", adminToken, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var detail struct {
+			User  map[string]interface{} `json:"user"`
+			Audit []models.AuditEntry    `json:"audit"`
+		}
+		_ = json.Unmarshal(rec.Body.Bytes(), &detail)
+		assert.Equal(t, "tess.target@ufl.edu", detail.User["email"])
+		var actions []string
+		for _, entry := range detail.Audit {
+			actions = append(actions, entry.Action)
+			assert.Equal(t, 929, entry.ActorID)
+			assert.Equal(t, "198.51.100.9", entry.IP)
+		}
+		assert.Equal(t, []string{models.AuditRestore, models.AuditDelete, models.AuditResetTwoFactor, models.AuditReactivate, models.AuditDeactivate, models.AuditUnlock, models.AuditLock}, actions)
+		assert.Equal(t, "requested by owner", detail.Audit[1].Details)
+
+		rec = do(http.MethodGet, "/admin/audit?actor=929&limit=2", adminToken, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var entries []models.AuditEntry
+		_ = json.Unmarshal(rec.Body.Bytes(), &entries)
+		assert.Len(t, entries, 2)
+		rec = do(http.MethodGet, fmt.Sprintf("/admin/audit?target=931&before=%d", entries[1].ID), adminToken, nil)
+		_ = json.Unmarshal(rec.Body.Bytes(), &entries)
+		assert.Len(t, entries, 1)
+		assert.Equal(t, models.AuditVerify, entries[0].Action)
+	})
+
+	t.Run("AuthEvents", func(t *testing.T) {
+		raw := "AuthEvents@2025"
+		hash, _ := argon2id.CreateHash(raw, &argon2id.Params{Memory: 65536, Iterations: 2, Parallelism: 2, SaltLength: 16, KeyLength: 32})
+		db.Create(&models.User{UserID: 932, Name: "Ivy Events", Email: "ivy.events@ufl.edu", Password: hash, Verified: true})
+		admin := models.User{UserID: 933, Name: "Abe Auditor", Email: "abe.auditor@ufl.edu", Verified: true, Role: models.RoleAdmin}
+		db.Create(&admin)
+		adminToken, err := utils.GenerateJWT(admin)
+		assert.NoError(t, err)
+
+		do := func(method, path, bearer string, body interface{}) *httptest.ResponseRecorder {
+			var reader io.Reader = http.NoBody
+			if body != nil {
+				reader = toJSON(body)
+			}
+			req, _ := http.NewRequest(method, path, reader)
+			if bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+bearer)
+			}
+			req.Header.Set("User-Agent", "events-test/1.0")
+			req.RemoteAddr = "198.51.100.23:443"
+			rec := httptest.NewRecorder()
+			app.Routes().ServeHTTP(rec, req)
+			return rec
+		}
+		events := func(path, bearer string) []models.AuthEvent {
+			rec := do(http.MethodGet, path, bearer, nil)
+			assert.Equal(t, http.StatusOK, rec.Code, path)
+			var list []models.AuthEvent
+			_ = json.Unmarshal(rec.Body.Bytes(), &list)
+			return list
+		}
+
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/login", "", map[string]string{"email": "ivy.events@ufl.edu", "password": "wrong"}).Code)
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/login", "", map[string]string{"email": "ghost.events@ufl.edu", "password": "wrong"}).Code)
+		rec := do(http.MethodPost, "/login", "", map[string]string{"email": "ivy.events@ufl.edu", "password": raw})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var login map[string]interface{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &login)
+		token, _ := login["token"].(string)
+		assert.NotEmpty(t, token)
+
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/me/auth-events", "", nil).Code)
+		mine := events("/me/auth-events", token)
+		assert.Len(t, mine, 2)
+		assert.Equal(t, models.OutcomeSuccess, mine[0].Outcome)
+		assert.Equal(t, models.OutcomeFailure, mine[1].Outcome)
+		assert.Equal(t, "wrong_password", mine[1].Reason)
+		assert.Equal(t, "198.51.100.23", mine[0].IP)
+		assert.Equal(t, "events-test/1.0", mine[0].UserAgent)
+		assert.Len(t, events("/me/auth-events?outcome=failure&user=933", token), 1, "users only see their own events")
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/me/auth-events?limit=0", token, nil).Code)
+
+		assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/admin/auth-events", token, nil).Code)
+		ghost := events("/admin/auth-events?email=GHOST.events@ufl.edu", adminToken)
+		assert.Len(t, ghost, 1)
+		assert.Nil(t, ghost[0].UserID)
+		assert.Equal(t, "unknown_account", ghost[0].Reason)
+		assert.Len(t, events("/admin/auth-events?user=932&type=login&outcome=success", adminToken), 1)
+		assert.Len(t, events("/admin/auth-events?ip=198.51.100.23&since="+time.Now().Add(-time.Minute).Format(time.RFC3339), adminToken), 3)
+
+		assert.Equal(t, http.StatusOK, do(http.MethodPost, "/logout", token, nil).Code)
+		rec = do(http.MethodGet, "/admin/users/932", adminToken, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var detail struct {
+			AuthEvents []models.AuthEvent `json:"auth_events"`
+		}
+		_ = json.Unmarshal(rec.Body.Bytes(), &detail)
+		assert.Len(t, detail.AuthEvents, 3)
+		assert.Equal(t, models.AuthEventLogout, detail.AuthEvents[0].Type)
+	})
+
+	t.Run("BreachedPassword", func(t *testing.T) {
+		raw := "Breached-Passw0rd-2019"
+		hash, _ := argon2id.CreateHash(raw, &argon2id.Params{Memory: 65536, Iterations: 2, Parallelism: 2, SaltLength: 16, KeyLength: 32})
+		db.Create(&models.User{UserID: 934, Name: "Bree Breach", Email: "bree.breach@ufl.edu", Password: hash, Verified: true})
+		models.SetBreachedPasswords(breachList{raw: true})
+		defer models.SetBreachedPasswords(nil)
+
+		post := func(path string, body interface{}) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodPost, path, toJSON(body))
+			req.RemoteAddr = "198.51.100.34:443"
+			rec := httptest.NewRecorder()
+			app.Routes().ServeHTTP(rec, req)
+			return rec
+		}
+
+		rec := post("/signup", map[string]string{"name": "Copy Cat", "email": "copy.cat@ufl.edu", "password": raw})
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "data breach")
+
+		rec = post("/login", map[string]string{"email": "bree.breach@ufl.edu", "password": raw})
+		assert.Equal(t, http.StatusOK, rec.Code, "a breached password still logs in")
+		var login map[string]interface{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &login)
+		assert.Equal(t, true, login["password_breached"])
+
+		req, _ := http.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+login["token"].(string))
+		rec = httptest.NewRecorder()
+		app.Routes().ServeHTTP(rec, req)
+		assert.Contains(t, rec.Body.String(), `"password_breached":true`)
+
+		assert.NoError(t, app.Models.UserModel.Update("bree.breach@ufl.edu", "Fresh-Passw0rd-2025"))
+		var changed models.User
+		db.First(&changed, 934)
+		assert.False(t, changed.PasswordBreached, "changing the password clears the flag")
+	})
+
+	t.Run("RehashOnLogin", func(t *testing.T) {
+		raw := "Upgrade-Passw0rd-2025"
+		weak := argon2id.Params{Memory: 8 * 1024, Iterations: 1, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+		hash, _ := argon2id.CreateHash(raw, &weak)
+		db.Create(&models.User{UserID: 935, Name: "Reed Rehash", Email: "reed.rehash@ufl.edu", Password: hash, Verified: true})
+		target := argon2id.Params{Memory: 16 * 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+		assert.NoError(t, models.SetPasswordParams(target))
+		defer func() { _ = models.SetPasswordParams(models.DefaultPasswordParams) }()
+
+		login := func(password string) int {
+			req, _ := http.NewRequest(http.MethodPost, "/login", toJSON(map[string]string{"email": "reed.rehash@ufl.edu", "password": password}))
+			req.RemoteAddr = "198.51.100.35:443"
+			rec := httptest.NewRecorder()
+			app.Routes().ServeHTTP(rec, req)
+			return rec.Code
+		}
+		stored := func() string {
+			var user models.User
+			db.First(&user, 935)
+			return user.Password
+		}
+
+		assert.Equal(t, http.StatusUnauthorized, login("wrong"))
+		assert.Equal(t, hash, stored(), "a failed login does not rehash")
+		assert.Equal(t, http.StatusOK, login(raw))
+		upgraded, _, _, err := argon2id.DecodeHash(stored())
+		assert.NoError(t, err)
+		assert.Equal(t, target, *upgraded)
+		assert.Equal(t, http.StatusOK, login(raw), "the upgraded hash still matches")
+	})
+
+	t.Run("ResendDoesNotResetWrongCodes", func(t *testing.T) {
+		db.Create(&models.User{UserID: 936, Name: "Rex Resend", Email: "rex.resend@ufl.edu", Status: models.StatusPending})
+		post := func(path string, body interface{}) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodPost, path, toJSON(body))
+			req.RemoteAddr = "198.51.100.36:443"
+			rec := httptest.NewRecorder()
+			app.Routes().ServeHTTP(rec, req)
+			return rec
+		}
+
+		wrong := 0
+		for cycle := 0; cycle < 5 && wrong < models.MaxFailedCodeAttempts; cycle++ {
+			assert.Equal(t, http.StatusOK, post("/resendOtp", map[string]string{"email": "rex.resend@ufl.edu"}).Code)
+			code := otpRegex.FindStringSubmatch(lastEmail(t, outbox))[1]
+			guess := "000000"
+			if code == guess {
+				guess = "111111"
+			}
+			for i := 0; i < 2 && wrong < models.MaxFailedCodeAttempts; i++ {
+				rec := post("/verifyEmail", map[string]string{"email": "rex.resend@ufl.edu", "code": guess})
+				assert.Equal(t, http.StatusUnauthorized, rec.Code)
+				wrong++
+			}
+		}
+		var locked models.User
+		db.First(&locked, 936)
+		assert.Equal(t, models.StatusLocked, locked.CurrentStatus(time.Now()), "resending codes does not forgive wrong guesses")
+		assert.Equal(t, http.StatusBadRequest, post("/resendOtp", map[string]string{"email": "rex.resend@ufl.edu"}).Code)
+		req, _ := http.NewRequest(http.MethodGet, "/forgotPassword?email=rex.resend@ufl.edu", nil)
+		rec := httptest.NewRecorder()
+		app.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "a reset code cannot be requested while locked")
+
+		var alerts int64
+		db.Model(&models.AuthEvent{}).Where("userid = ? AND type = ?", 936, models.AuthEventSecurityAlert).Count(&alerts)
+		assert.Equal(t, int64(2), alerts, "one alert when the code is revoked, one when the account locks")
+	})
+
+	t.Run("TokenExchangeHandler", func(t *testing.T) {
+		params := &argon2id.Params{Memory: 65536, Iterations: 2, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+		secretHash, _ := argon2id.CreateHash("products-secret", params)
+		exchange := handler.Application{Models: app.Models}
+		exchange.Models.ServiceAccounts = models.ServiceAccounts{
+			"products":  {ClientID: "products", SecretHash: secretHash, Scopes: []string{models.ScopeTokenExchange}},
+			"reporting": {ClientID: "reporting", SecretHash: secretHash},
+		}
+		db.Create(&models.User{UserID: 911, Name: "Abby Anderson", Email: "abby@ufl.edu", Verified: true})
+		db.Create(&models.User{UserID: 912, Name: "Lev Unverified", Email: "lev2@ufl.edu"})
+		lockedUntil := time.Now().Add(time.Hour)
+		db.Create(&models.User{UserID: 937, Name: "Lola Locked", Email: "lola.locked@ufl.edu", Verified: true, Status: models.StatusLocked, LockedUntil: &lockedUntil})
+		db.Create(&models.User{UserID: 938, Name: "Dev Deactivated", Email: "dev.deactivated@ufl.edu", Verified: true, Status: models.StatusDeactivated})
+
+		do := func(clientID, secret string, body map[string]interface{}) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodPost, "/token/exchange", toJSON(body))
+			if clientID != "" {
+				req.SetBasicAuth(clientID, secret)
+			}
+			rec := httptest.NewRecorder()
+			exchange.Routes().ServeHTTP(rec, req)
+			return rec
+		}
+
+		rec := do("products", "products-secret", map[string]interface{}{"user_id": 911})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var resp map[string]interface{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		token, err := utils.ParseJWT(resp["token"].(string))
+		assert.NoError(t, err)
+		claims := token.Claims.(jwt.MapClaims)
+		assert.Equal(t, "911", claims["sub"])
+		assert.Equal(t, map[string]interface{}{"sub": "products"}, claims["act"])
+
+		assert.Equal(t, http.StatusOK, do("products", "products-secret", map[string]interface{}{"email": "abby@ufl.edu"}).Code)
+		assert.Equal(t, http.StatusUnauthorized, do("", "", map[string]interface{}{"user_id": 911}).Code)
+		assert.Equal(t, http.StatusUnauthorized, do("products", "wrong", map[string]interface{}{"user_id": 911}).Code)
+		assert.Equal(t, http.StatusForbidden, do("reporting", "products-secret", map[string]interface{}{"user_id": 911}).Code)
+		assert.Equal(t, http.StatusNotFound, do("products", "products-secret", map[string]interface{}{"email": "nobody@ufl.edu"}).Code)
+		assert.Equal(t, http.StatusForbidden, do("products", "products-secret", map[string]interface{}{"user_id": 912}).Code)
+		rec = do("products", "products-secret", map[string]interface{}{"user_id": 937})
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), "user is locked")
+		rec = do("products", "products-secret", map[string]interface{}{"email": "dev.deactivated@ufl.edu"})
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), "user is deactivated")
+	})
+
+	t.Run("LoginLockoutAndUnlock", func(t *testing.T) {
+		raw := "LockoutPassword@2025"
+		hash, _ := argon2id.CreateHash(raw, &argon2id.Params{Memory: 65536, Iterations: 2, Parallelism: 2, SaltLength: 16, KeyLength: 32})
+		db.Create(&models.User{UserID: 913, Name: "Manny Alvarez", Email: "manny@ufl.edu", Password: hash, Verified: true})
+		secretHash, _ := argon2id.CreateHash("support-secret", argon2id.DefaultParams)
+
+		locking := handler.Application{Models: app.Models}
+		locking.Models.LoginThrottle.Policy = models.ThrottlePolicy{
+			FreeAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond,
+			EmailLockoutAfter: 3, IPLockoutAfter: 100, LockoutDuration: time.Hour, ResetAfter: time.Hour,
+		}
+		locking.Models.ServiceAccounts = models.ServiceAccounts{
+			"support": {ClientID: "support", SecretHash: secretHash, Scopes: []string{models.ScopeAccountUnlock}},
+		}
+		login := func(password string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(http.MethodPost, "/login", toJSON(map[string]string{"email": "manny@ufl.edu", "password": password}))
+			rec := httptest.NewRecorder()
+			locking.Routes().ServeHTTP(rec, req)
+			return rec
+		}
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusUnauthorized, login("wrong").Code)
+		}
+		sent := lastEmail(t, outbox)
+		assert.Contains(t, sent, "To: <manny@ufl.edu>")
+		assert.Contains(t, sent, "Subject: UniBazaar Security Alert")
+
+		rec := login(raw)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code, "correct password is refused while locked")
+		assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+		req, _ := http.NewRequest(http.MethodPost, "/admin/unlock", toJSON(map[string]string{"email": "manny@ufl.edu"}))
+		rec = httptest.NewRecorder()
+		locking.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		req, _ = http.NewRequest(http.MethodPost, "/admin/unlock", toJSON(map[string]string{"email": "manny@ufl.edu"}))
+		req.SetBasicAuth("support", "support-secret")
+		rec = httptest.NewRecorder()
+		locking.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		assert.Equal(t, http.StatusOK, login(raw).Code)
+	})
+
+	t.Run("UniversityAdmin", func(t *testing.T) {
+		secretHash, _ := argon2id.CreateHash("registry-secret", argon2id.DefaultParams)
+		admin := handler.Application{Models: app.Models}
+		admin.Models.ServiceAccounts = models.ServiceAccounts{
+			"registry": {ClientID: "registry", SecretHash: secretHash, Scopes: []string{models.ScopeUniversitiesWrite}},
+		}
+		models.SetUniversityLookup(admin.Models.Universities)
+		defer models.SetUniversityLookup(nil)
+		do := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(method, path, toJSON(body))
+			req.SetBasicAuth("registry", "registry-secret")
+			rec := httptest.NewRecorder()
+			admin.Routes().ServeHTTP(rec, req)
+			return rec
+		}
+
+		req, _ := http.NewRequest(http.MethodPost, "/admin/universities", toJSON(map[string]string{"domain": "gatech.edu", "name": "Georgia Tech"}))
+		rec := httptest.NewRecorder()
+		admin.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		rec = do(http.MethodPost, "/admin/universities", map[string]interface{}{
+			"domain": "gatech.edu", "name": "Georgia Tech", "campuses": []string{"Atlanta"},
+		})
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		var created models.University
+		_ = json.Unmarshal(rec.Body.Bytes(), &created)
+		assert.True(t, created.Enabled)
+		assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/admin/universities", map[string]string{"domain": "gatech.edu", "name": "Dup"}).Code)
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/admin/universities", map[string]string{"domain": "gatech.com", "name": "Nope"}).Code)
+
+		// A newly registered campus accepts sign-ups, including from subdomains.
+		assert.NoError(t, models.ValidateEduEmail("buzz@cc.gatech.edu"))
+
+		req, _ = http.NewRequest(http.MethodGet, "/universities", nil)
+		rec = httptest.NewRecorder()
+		admin.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Atlanta")
+
+		path := "/admin/universities/" + strconv.Itoa(int(created.ID))
+		disabled := false
+		rec = do(http.MethodPut, path, map[string]interface{}{"domain": "gatech.edu", "name": "Georgia Institute of Technology", "enabled": &disabled})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Error(t, models.ValidateEduEmail("buzz@gatech.edu"), "disabled campus rejects sign-ups")
+
+		assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, path, nil).Code)
+		assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, path, nil).Code)
+	})
+
+	t.Run("GetJWTHandlerOnlyInTestMode", func(t *testing.T) {
+		body := map[string]string{"email": "abby@ufl.edu"}
+		req, _ := http.NewRequest(http.MethodPost, "/getjwt", toJSON(body))
+		rec := httptest.NewRecorder()
+		app.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		testApp := handler.Application{Models: app.Models, TestMode: true}
+		req, _ = http.NewRequest(http.MethodPost, "/getjwt", toJSON(body))
+		rec = httptest.NewRecorder()
+		testApp.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get("Authorization"))
+
+		// Even in test mode, tokens are only issued for real users.
+		req, _ = http.NewRequest(http.MethodPost, "/getjwt", toJSON(map[string]string{"email": "forged@ufl.edu"}))
+		rec = httptest.NewRecorder()
+		testApp.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("JWKSHandler", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+		rec := httptest.NewRecorder()
+		app.Routes().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var jwks utils.JWKS
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &jwks))
+		assert.NotEmpty(t, jwks.Keys)
+		assert.Equal(t, utils.CurrentKeySet().Active().ID, jwks.Keys[0].KeyID)
+		for _, k := range jwks.Keys {
+			assert.NotEmpty(t, k.N+k.X, "public key material must be present")
+		}
 	})
 
 	t.Log("All handler tests completed:", time.Now())
 }
 
+var otpRegex = regexp.MustCompile(`Your code is (\d{6})`)
+
+func lastEmail(t *testing.T, m *mailer.FileMailer) string {
+	t.Helper()
+	paths, err := m.Messages()
+	assert.NoError(t, err)
+	if len(paths) == 0 {
+		t.Fatal("expected an email to have been sent")
+	}
+	raw, err := os.ReadFile(paths[len(paths)-1])
+	assert.NoError(t, err)
+	return string(raw)
+}
+
+// breachList is a breached-password corpus of the listed passwords.
+type breachList map[string]bool
+
+func (b breachList) IsBreached(password string) (bool, error) {
+	return b[password], nil
+}
+
 func toJSON(v interface{}) *bytes.Reader {
 	b, _ := json.Marshal(v)
 	return bytes.NewReader(b)
@@ -1,28 +1,39 @@
 package handler
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 	"users/models"
 	"users/utils"
 
 	"github.com/alexedwards/argon2id"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
+	"gorm.io/gorm"
 )
 
-var revokedTokens = make(map[string]bool)
-
 type Application struct {
 	Models models.Models
+	// TestMode exposes /getjwt, which mints tokens without credentials.
+	TestMode bool
+	// TrustProxyHeaders takes the client IP from X-Forwarded-For.
+	TrustProxyHeaders bool
 }
 
 func (app *Application) SignUpHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Id       int    `json:"id"`
 		Name     string `json:"name"`
 		Email    string `json:"email"`
 		Password string `json:"password"`
@@ -37,12 +48,25 @@ func (app *Application) SignUpHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "please provide both first and last name", http.StatusBadRequest)
 		return
 	}
-	if err := app.Models.UserModel.Insert(input.Id, input.Name, input.Email, input.Password, input.Phone); err != nil {
-		http.Error(w, fmt.Sprintf("could not create user: %v", err), http.StatusBadRequest)
-		return
+	user, err := app.Models.UserModel.Insert(input.Name, input.Email, input.Password, input.Phone)
+	if err != nil {
+		if errors.Is(err, models.ErrEmailTaken) {
+			http.Error(w, "an account with this email already exists", http.StatusConflict)
+			return
+		}
+		if user == nil {
+			http.Error(w, fmt.Sprintf("could not create user: %v", err), http.StatusBadRequest)
+			return
+		}
+		// The account exists; the code can be resent with /resendOtp.
+		log.Println("failed to send verification code after sign-up:", err)
 	}
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintln(w, "Sign‑up successful. Check your email for OTP.")
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   "Sign‑up successful. Check your email for OTP.",
+		"userid":    user.UserID,
+		"public_id": user.PublicID,
+	})
 }
 
 func (app *Application) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
@@ -56,28 +80,44 @@ func (app *Application) VerifyEmailHandler(w http.ResponseWriter, r *http.Reques
 	}
 	user, err := app.Models.UserModel.Read(input.Email)
 	if err != nil {
+		app.recordAuthEvent(r, nil, models.AuthEvent{Type: models.AuthEventEmailVerification, Email: input.Email, Outcome: models.OutcomeFailure, Reason: "unknown_account"})
 		http.Error(w, "user not found", http.StatusNotFound)
 		return
 	}
-	if user.OTPCode != input.Code {
-		user.FailedResetAttempts++
-		switch {
-		case user.FailedResetAttempts >= 5:
-			_ = app.Models.UserModel.Delete(user.Email)
-		case user.FailedResetAttempts >= 3:
-			_ = app.Models.UserModel.SendSecurityAlert(user)
-			user.OTPCode = ""
-			_ = app.Models.UserModel.SaveUser(user)
+	if writeLocked(w, user) {
+		app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventEmailVerification, Outcome: models.OutcomeFailure, Reason: "account_locked"})
+		return
+	}
+	if err := app.Models.UserModel.ConsumeOTP(user.UserID, models.PurposeEmailVerification, input.Code); err != nil {
+		if !errors.Is(err, models.ErrOTPInvalid) && !errors.Is(err, models.ErrOTPExpired) {
+			http.Error(w, "failed to verify code", http.StatusInternalServerError)
+			return
 		}
+		locked := false
+		if errors.Is(err, models.ErrOTPInvalid) {
+			// Too many wrong codes put the account in a cooling-off period
+			// rather than deleting it, so guessing cannot remove accounts.
+			var recordErr error
+			locked, recordErr = app.Models.UserModel.RecordFailedCode(user, models.PurposeEmailVerification)
+			if recordErr != nil {
+				log.Println("failed to record wrong verification code:", recordErr)
+			}
+		}
+		app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventEmailVerification, Outcome: models.OutcomeFailure, Reason: codeFailureReason(err)})
 		w.WriteHeader(http.StatusUnauthorized)
-		_ = json.NewEncoder(w).Encode(map[string]bool{"verified": false})
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"verified": false,
+			"expired":  errors.Is(err, models.ErrOTPExpired),
+			"locked":   locked,
+		})
 		return
 	}
-	user.Verified, user.FailedResetAttempts, user.OTPCode = true, 0, ""
+	user.Verified, user.FailedResetAttempts = true, 0
 	if err := app.Models.UserModel.UpdateVerificationStatus(user); err != nil {
 		http.Error(w, "failed to update verification status", http.StatusInternalServerError)
 		return
 	}
+	app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventEmailVerification, Outcome: models.OutcomeSuccess})
 	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(map[string]bool{"verified": true})
 }
@@ -105,9 +145,11 @@ func (app *Application) ForgotPasswordHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 	if err := app.Models.UserModel.InitiatePasswordReset(email); err != nil {
+		app.recordAuthEvent(r, nil, models.AuthEvent{Type: models.AuthEventPasswordResetRequest, Email: email, Outcome: models.OutcomeFailure, Reason: "rejected"})
 		http.Error(w, fmt.Sprintf("failed to initiate reset: %v", err), http.StatusBadRequest)
 		return
 	}
+	app.recordAuthEvent(r, nil, models.AuthEvent{Type: models.AuthEventPasswordResetRequest, Email: email, Outcome: models.OutcomeSuccess})
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintln(w, "Reset code sent. Check your email.")
 }
@@ -123,37 +165,28 @@ func (app *Application) UpdatePasswordHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 	if err := app.Models.UserModel.VerifyResetCodeAndSetNewPassword(input.Email, input.OTPCode, input.NewPassword); err != nil {
+		app.recordAuthEvent(r, nil, models.AuthEvent{Type: models.AuthEventPasswordReset, Email: input.Email, Outcome: models.OutcomeFailure, Reason: codeFailureReason(err)})
 		http.Error(w, fmt.Sprintf("update password failed: %v", err), http.StatusBadRequest)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintln(w, "Password updated successfully.")
-}
-
-func (app *Application) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Email string `json:"email"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "invalid JSON input", http.StatusBadRequest)
-		return
+	// Whoever knew the old password may still be signed in.
+	user, err := app.Models.UserModel.Read(input.Email)
+	if err == nil {
+		app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventPasswordReset, Outcome: models.OutcomeSuccess})
+		err = app.revokeAllTokens(user)
 	}
-	if err := app.Models.UserModel.Delete(input.Email); err != nil {
-		http.Error(w, fmt.Sprintf("delete failed: %v", err), http.StatusBadRequest)
+	if err != nil {
+		http.Error(w, "password updated, but failed to sign out other sessions", http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintln(w, "User deleted.")
+	fmt.Fprintln(w, "Password updated successfully.")
 }
 
 func (app *Application) DisplayUserHandler(w http.ResponseWriter, r *http.Request) {
-	idStr := httprouter.ParamsFromContext(r.Context()).ByName("id")
-	userID, err := strconv.Atoi(idStr)
-	if err != nil || userID <= 0 {
-		http.Error(w, "invalid user ID", http.StatusBadRequest)
-		return
-	}
-	user, err := app.Models.UserModel.ReadByID(userID)
+	// :id is the public UUID only; sequential numeric IDs would let anyone
+	// walk the user table.
+	user, err := app.Models.UserModel.ReadByPublicID(httprouter.ParamsFromContext(r.Context()).ByName("id"))
 	if err != nil {
 		http.Error(w, "user not found", http.StatusNotFound)
 		return
@@ -171,169 +204,1989 @@ func (app *Application) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid JSON input", http.StatusBadRequest)
 		return
 	}
+	ip := app.clientIP(r)
+	if err := app.Models.LoginThrottle.Check(input.Email, ip); err != nil {
+		var throttled *models.ThrottledError
+		if errors.As(err, &throttled) {
+			app.recordAuthEvent(r, nil, models.AuthEvent{Type: models.AuthEventLogin, Email: input.Email, Outcome: models.OutcomeFailure, Reason: "throttled"})
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			http.Error(w, throttled.Error(), http.StatusTooManyRequests)
+			return
+		}
+		http.Error(w, "failed to check login attempts", http.StatusInternalServerError)
+		return
+	}
 	user, err := app.Models.UserModel.Read(input.Email)
 	if err != nil {
+		app.recordAuthEvent(r, nil, models.AuthEvent{Type: models.AuthEventLogin, Email: input.Email, Outcome: models.OutcomeFailure, Reason: "unknown_account"})
+		app.recordLoginFailure(r, input.Email, nil)
 		http.Error(w, "user not found", http.StatusUnauthorized)
 		return
 	}
-	if !user.Verified {
-		http.Error(w, "account not verified, please verify your email first", http.StatusUnauthorized)
+	if app.writeLoginBlocked(w, r, user, models.AuthEventLogin) {
 		return
 	}
 	match, err := argon2id.ComparePasswordAndHash(input.Password, user.Password)
 	if err != nil || !match {
+		app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventLogin, Outcome: models.OutcomeFailure, Reason: "wrong_password"})
+		app.recordLoginFailure(r, input.Email, user)
 		http.Error(w, "invalid credentials", http.StatusUnauthorized)
 		return
 	}
-	tokenString, err := utils.GenerateJWT(*user)
+	if app.writeDeactivated(w, r, user, models.AuthEventLogin) {
+		return
+	}
+	app.checkBreachedPassword(user, input.Password)
+	if models.NeedsRehash(user.Password) {
+		if err := app.Models.UserModel.RehashPassword(user, input.Password); err != nil {
+			log.Println("failed to upgrade password hash:", err)
+		}
+	}
+	if user.TOTPEnabled {
+		// The password was right; tokens are only issued once
+		// LoginTwoFactorHandler has seen the second factor.
+		challenge, err := app.Models.TwoFactor.IssueChallenge(user.UserID)
+		if err != nil {
+			http.Error(w, "failed to start two-factor login", http.StatusInternalServerError)
+			return
+		}
+		app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventLogin, Outcome: models.OutcomeSuccess, Reason: "two_factor_required"})
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_in":          int(models.LoginChallengeTTL.Seconds()),
+		})
+		return
+	}
+	app.completeLogin(w, r, user, models.AuthEventLogin)
+}
+
+// LoginTwoFactorHandler is the second step of a login with two-factor
+// authentication: the challenge token from /login together with a TOTP or
+// recovery code is exchanged for the tokens.
+func (app *Application) LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.ChallengeToken == "" || input.Code == "" {
+		http.Error(w, "challenge_token and code are required", http.StatusBadRequest)
+		return
+	}
+	challenge, err := app.Models.TwoFactor.Challenge(input.ChallengeToken)
+	if errors.Is(err, models.ErrLoginChallengeInvalid) {
+		app.recordAuthEvent(r, nil, models.AuthEvent{Type: models.AuthEventLoginTwoFactor, Outcome: models.OutcomeFailure, Reason: "invalid_challenge"})
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		http.Error(w, "failed to check login challenge", http.StatusInternalServerError)
+		return
+	}
+	user, err := app.Models.UserModel.ReadByID(challenge.UserID)
+	if err != nil {
+		http.Error(w, models.ErrLoginChallengeInvalid.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err := app.Models.LoginThrottle.Check(user.Email, app.clientIP(r)); err != nil {
+		var throttled *models.ThrottledError
+		if errors.As(err, &throttled) {
+			app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventLoginTwoFactor, Outcome: models.OutcomeFailure, Reason: "throttled"})
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			http.Error(w, throttled.Error(), http.StatusTooManyRequests)
+			return
+		}
+		http.Error(w, "failed to check login attempts", http.StatusInternalServerError)
+		return
+	}
+	if err := app.Models.TwoFactor.Verify(user, input.Code); err != nil {
+		if !errors.Is(err, models.ErrInvalidSecondFactor) {
+			http.Error(w, "failed to verify code", http.StatusInternalServerError)
+			return
+		}
+		if err := app.Models.TwoFactor.FailChallenge(challenge); err != nil {
+			log.Println("failed to count wrong two-factor code:", err)
+		}
+		app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventLoginTwoFactor, Outcome: models.OutcomeFailure, Reason: "wrong_code"})
+		app.recordLoginFailure(r, user.Email, user)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err := app.Models.TwoFactor.CompleteChallenge(challenge); err != nil {
+		http.Error(w, models.ErrLoginChallengeInvalid.Error(), http.StatusUnauthorized)
+		return
+	}
+	// The account may have been locked or deactivated since the password step.
+	if app.writeLoginBlocked(w, r, user, models.AuthEventLoginTwoFactor) || app.writeDeactivated(w, r, user, models.AuthEventLoginTwoFactor) {
+		return
+	}
+	app.completeLogin(w, r, user, models.AuthEventLoginTwoFactor)
+}
+
+// completeLogin resets the failed login count, records the successful login
+// as eventType and answers with the tokens of a new session.
+func (app *Application) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User, eventType string) {
+	if err := app.Models.LoginThrottle.RecordSuccess(user.Email); err != nil {
+		log.Println("failed to reset login attempts:", err)
+	}
+	tokens, err := app.issueTokens(r, user)
 	if err != nil {
 		http.Error(w, "failed to generate token", http.StatusInternalServerError)
 		return
 	}
-	userID, _ := app.Models.UserModel.GetUserIdByEmail(input.Email)
+	app.recordAuthEvent(r, user, models.AuthEvent{Type: eventType, Outcome: models.OutcomeSuccess})
 	resp := map[string]interface{}{
-		"userId": userID,
-		"token":  tokenString,
-		"name":   user.Name,
-		"email":  user.Email,
+		"userId":            user.UserID,
+		"public_id":         user.PublicID,
+		"token":             tokens.AccessToken,
+		"refresh_token":     tokens.RefreshToken,
+		"expires_in":        tokens.ExpiresIn,
+		"name":              user.Name,
+		"email":             user.Email,
+		"password_breached": user.PasswordBreached,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
-func (app *Application) UpdateNameHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-		NewName  string `json:"newName"`
+// checkBreachedPassword looks the password a user just logged in with up in the
+// breach corpus and remembers the result on the account until the password
+// changes. Only the password login sees the plain password, so two-factor and
+// passkey logins report what the last password login found.
+func (app *Application) checkBreachedPassword(user *models.User, password string) {
+	breached, err := models.IsBreachedPassword(password)
+	if err != nil {
+		log.Println("failed to check breached passwords:", err)
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "invalid JSON input", http.StatusBadRequest)
+	if breached == user.PasswordBreached {
 		return
 	}
-	user, err := app.Models.UserModel.Read(input.Email)
+	if err := app.Models.UserModel.SetPasswordBreached(user, breached); err != nil {
+		log.Println("failed to flag breached password:", err)
+	}
+}
+
+// writeLocked answers 429 with Retry-After if user is in a cooling-off period.
+func writeLocked(w http.ResponseWriter, user *models.User) bool {
+	now := time.Now()
+	if user.CurrentStatus(now) != models.StatusLocked {
+		return false
+	}
+	retryAfter := time.Duration(0)
+	if user.LockedUntil != nil {
+		retryAfter = user.LockedUntil.Sub(now)
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, models.ErrAccountLocked.Error(), http.StatusTooManyRequests)
+	return true
+}
+
+// recordLoginFailure counts a failed login and, when it locks the account,
+// records the lockout and alerts the owner. user is nil when the email is not
+// registered.
+func (app *Application) recordLoginFailure(r *http.Request, email string, user *models.User) {
+	locked, err := app.Models.LoginThrottle.RecordFailure(email, app.clientIP(r))
 	if err != nil {
-		http.Error(w, "user not found", http.StatusUnauthorized)
+		log.Println("failed to record login attempt:", err)
 		return
 	}
-	match, _ := argon2id.ComparePasswordAndHash(input.Password, user.Password)
-	if !match {
-		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+	if !locked {
 		return
 	}
-	if err := app.Models.UserModel.UpdateName(input.Email, input.NewName); err != nil {
-		http.Error(w, fmt.Sprintf("update name failed: %v", err), http.StatusBadRequest)
-		return
+	app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventLockout, Email: email, Outcome: models.OutcomeFailure, Reason: "too_many_failures"})
+	if user != nil {
+		if err := app.Models.UserModel.SendSecurityAlert(user, "login_lockout"); err != nil {
+			log.Println("failed to send lockout alert:", err)
+		}
 	}
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintln(w, "Name updated successfully.")
 }
 
-func (app *Application) UpdatePhoneHandler(w http.ResponseWriter, r *http.Request) {
+// writeLoginBlocked answers and records a login as eventType that must not
+// proceed because the account is locked or unverified.
+func (app *Application) writeLoginBlocked(w http.ResponseWriter, r *http.Request, user *models.User, eventType string) bool {
+	if writeLocked(w, user) {
+		app.recordAuthEvent(r, user, models.AuthEvent{Type: eventType, Outcome: models.OutcomeFailure, Reason: "account_locked"})
+		return true
+	}
+	if !user.Verified {
+		app.recordAuthEvent(r, user, models.AuthEvent{Type: eventType, Outcome: models.OutcomeFailure, Reason: "unverified"})
+		http.Error(w, "account not verified, please verify your email first", http.StatusUnauthorized)
+		return true
+	}
+	return false
+}
+
+// writeDeactivated answers and records a login as eventType that must not
+// proceed because an admin deactivated the account.
+func (app *Application) writeDeactivated(w http.ResponseWriter, r *http.Request, user *models.User, eventType string) bool {
+	if user.CurrentStatus(time.Now()) != models.StatusDeactivated {
+		return false
+	}
+	app.recordAuthEvent(r, user, models.AuthEvent{Type: eventType, Outcome: models.OutcomeFailure, Reason: "deactivated"})
+	http.Error(w, "account is deactivated", http.StatusForbidden)
+	return true
+}
+
+// recordAuthEvent appends event to the auth_events store with the client's
+// address and user agent. user is nil for attempts on unknown accounts, where
+// event.Email is the address that was tried. A failed write is logged rather
+// than failing the request.
+func (app *Application) recordAuthEvent(r *http.Request, user *models.User, event models.AuthEvent) {
+	if user != nil {
+		userID := user.UserID
+		event.UserID = &userID
+		if user.Email != "" {
+			event.Email = user.Email
+		}
+	}
+	event.IP, event.UserAgent = app.clientIP(r), r.UserAgent()
+	if err := app.Models.AuthEvents.Record(&event); err != nil {
+		log.Println("failed to record auth event:", err)
+	}
+}
+
+// codeFailureReason names why a one-time code was not accepted.
+func codeFailureReason(err error) string {
+	switch {
+	case errors.Is(err, models.ErrOTPExpired):
+		return "expired_code"
+	case errors.Is(err, models.ErrOTPInvalid):
+		return "wrong_code"
+	case errors.Is(err, models.ErrBreachedPassword):
+		return "breached_password"
+	case errors.Is(err, models.ErrAccountLocked):
+		return "account_locked"
+	}
+	return "rejected"
+}
+
+// clientIP returns the caller's address. X-Forwarded-For is only trusted when
+// the service runs behind a proxy that sets it (TrustProxyHeaders).
+func (app *Application) clientIP(r *http.Request) string {
+	if app.TrustProxyHeaders {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type tokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// issueTokens starts a session for user, recording the device the request
+// came from, and mints its access token and first refresh token.
+func (app *Application) issueTokens(r *http.Request, user *models.User) (tokenPair, error) {
+	sessionID := uuid.NewString()
+	refresh, err := app.Models.RefreshTokens.Issue(user.UserID, sessionID)
+	if err != nil {
+		return tokenPair{}, err
+	}
+	if err := app.Models.SessionModel.Start(sessionID, user.UserID, r.UserAgent(), app.clientIP(r)); err != nil {
+		return tokenPair{}, err
+	}
+	access, err := utils.GenerateSessionJWT(*user, sessionID)
+	if err != nil {
+		return tokenPair{}, err
+	}
+	return tokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int(utils.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+func (app *Application) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-		NewPhone string `json:"newPhone"`
+		RefreshToken string `json:"refresh_token"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "invalid JSON input", http.StatusBadRequest)
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
 		return
 	}
-	user, err := app.Models.UserModel.Read(input.Email)
+	refresh, rotated, err := app.Models.RefreshTokens.Rotate(input.RefreshToken)
+	switch {
+	case errors.Is(err, models.ErrRefreshTokenReused):
+		// A rotated token coming back means it leaked; the family is revoked.
+		app.recordAuthEvent(r, &models.User{UserID: rotated.UserID}, models.AuthEvent{Type: models.AuthEventTokenRefresh, Outcome: models.OutcomeFailure, Reason: "token_reused"})
+		http.Error(w, "refresh token reuse detected, please log in again", http.StatusUnauthorized)
+		return
+	case errors.Is(err, models.ErrRefreshTokenInvalid):
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	case err != nil:
+		http.Error(w, "failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+	user, err := app.Models.UserModel.ReadByID(rotated.UserID)
 	if err != nil {
 		http.Error(w, "user not found", http.StatusUnauthorized)
 		return
 	}
-	match, _ := argon2id.ComparePasswordAndHash(input.Password, user.Password)
-	if !match {
-		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+	// A session outlives a lock or deactivation only until its next refresh.
+	if app.writeLoginBlocked(w, r, user, models.AuthEventTokenRefresh) || app.writeDeactivated(w, r, user, models.AuthEventTokenRefresh) {
+		if err := app.revokeSession(rotated.FamilyID); err != nil {
+			log.Println("failed to revoke session of blocked user:", err)
+		}
 		return
 	}
-	if err := app.Models.UserModel.UpdatePhone(input.Email, input.NewPhone); err != nil {
-		http.Error(w, fmt.Sprintf("update phone failed: %v", err), http.StatusBadRequest)
+	if err := app.Models.SessionModel.Touch(rotated.FamilyID, app.clientIP(r)); err != nil {
+		log.Println("failed to update session:", err)
+	}
+	access, err := utils.GenerateSessionJWT(*user, rotated.FamilyID)
+	if err != nil {
+		http.Error(w, "failed to generate token", http.StatusInternalServerError)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintln(w, "Phone updated successfully.")
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(tokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int(utils.AccessTokenTTL().Seconds()),
+	})
 }
 
-func (app *Application) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+// tokenRevoked reports whether the token was revoked on its own, with its
+// session (logout), or together with every other token of its subject (e.g.
+// an email change).
+func (app *Application) tokenRevoked(claims jwt.MapClaims) (bool, error) {
+	if jti, ok := claims["jti"].(string); ok {
+		revoked, err := app.Models.TokenRevocations.IsRevoked(jti)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+	sub, _ := claims.GetSubject()
+	iat, ok := utils.IssuedAt(claims)
+	if sub == "" || !ok {
+		return false, nil
+	}
+	if sid, ok := claims["sid"].(string); ok {
+		revoked, err := app.Models.TokenRevocations.IsSubjectRevoked(sessionSubject(sid), iat)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+	return app.Models.TokenRevocations.IsSubjectRevoked(sub, iat)
+}
+
+// sessionSubject is the revocation subject that covers the access tokens of a session.
+func sessionSubject(sessionID string) string {
+	return "session:" + sessionID
+}
+
+// revokeSession ends a session: its refresh token family and the access
+// tokens issued for it so far.
+func (app *Application) revokeSession(sessionID string) error {
+	if err := app.Models.RefreshTokens.RevokeFamily(sessionID); err != nil {
+		return err
+	}
+	now := time.Now()
+	return app.Models.TokenRevocations.RevokeSubject(sessionSubject(sessionID), now, now.Add(utils.AccessTokenTTL()))
+}
+
+// revokeAllTokens signs user out everywhere: refresh token families and every
+// access token issued so far.
+func (app *Application) revokeAllTokens(user *models.User) error {
+	if err := app.Models.RefreshTokens.RevokeUser(user.UserID); err != nil {
+		return err
+	}
+	now := time.Now()
+	return app.Models.TokenRevocations.RevokeSubject(strconv.Itoa(user.UserID), now, now.Add(utils.AccessTokenTTL()))
+}
+
+// confirmPassword checks a password given again for a sensitive action,
+// counting wrong passwords like failed logins. It writes the error response
+// itself and reports whether the request may proceed.
+func (app *Application) confirmPassword(w http.ResponseWriter, r *http.Request, user *models.User, password string) bool {
+	ip := app.clientIP(r)
+	if err := app.Models.LoginThrottle.Check(user.Email, ip); err != nil {
+		var throttled *models.ThrottledError
+		if errors.As(err, &throttled) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			http.Error(w, throttled.Error(), http.StatusTooManyRequests)
+			return false
+		}
+		http.Error(w, "failed to check login attempts", http.StatusInternalServerError)
+		return false
+	}
+	match, err := argon2id.ComparePasswordAndHash(password, user.Password)
+	if err != nil || !match {
+		app.recordLoginFailure(r, user.Email, user)
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// authenticateUser resolves the user named by the bearer token's sub claim.
+// It writes the error response itself and reports whether the request may proceed.
+func (app *Application) authenticateUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	user, _, ok := app.authenticate(w, r)
+	return user, ok
+}
+
+// authenticate is authenticateUser that also returns the token's claims.
+func (app *Application) authenticate(w http.ResponseWriter, r *http.Request) (*models.User, jwt.MapClaims, bool) {
 	bearer := strings.Split(r.Header.Get("Authorization"), " ")
 	if len(bearer) != 2 || bearer[0] != "Bearer" {
-		http.Error(w, "invalid authorization header", http.StatusBadRequest)
-		return
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return nil, nil, false
 	}
 	jwtToken, err := utils.ParseJWT(bearer[1])
 	if err != nil || !jwtToken.Valid {
 		http.Error(w, "invalid token", http.StatusUnauthorized)
-		return
+		return nil, nil, false
 	}
 	claims := jwtToken.Claims.(jwt.MapClaims)
-	if jti, ok := claims["jti"].(string); ok {
-		revokedTokens[jti] = true
+	revoked, err := app.tokenRevoked(claims)
+	if err != nil {
+		http.Error(w, "failed to check token", http.StatusInternalServerError)
+		return nil, nil, false
 	}
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintln(w, "Logout successful, token revoked.")
+	if revoked {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+	sub, _ := claims.GetSubject()
+	userID, err := strconv.Atoi(sub)
+	if err != nil || userID <= 0 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+	user, err := app.Models.UserModel.ReadByID(userID)
+	if err != nil {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+	if user.CurrentStatus(time.Now()) == models.StatusDeactivated {
+		http.Error(w, "account is deactivated", http.StatusForbidden)
+		return nil, nil, false
+	}
+	return user, claims, true
 }
 
-func (app *Application) VerifyJWTHandler(w http.ResponseWriter, r *http.Request) {
-	bearer := strings.Split(r.Header.Get("Authorization"), " ")
-	if len(bearer) != 2 || bearer[0] != "Bearer" {
-		w.WriteHeader(http.StatusBadRequest)
+// MeHandler returns the profile of the authenticated user, including their role
+// and whether their password was found in a breach.
+func (app *Application) MeHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.authenticateUser(w, r)
+	if !ok {
 		return
 	}
-	jwtToken, err := utils.ParseJWT(bearer[1])
-	if err != nil || !jwtToken.Valid {
-		w.WriteHeader(http.StatusUnauthorized)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(struct {
+		*models.User
+		Role             models.Role `json:"role"`
+		PasswordBreached bool        `json:"password_breached"`
+	}{user, user.CurrentRole(), user.PasswordBreached})
+}
+
+// UpdateMeHandler changes the authenticated user's name and/or phone.
+func (app *Application) UpdateMeHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.authenticateUser(w, r)
+	if !ok {
 		return
 	}
-	claims := jwtToken.Claims.(jwt.MapClaims)
-	if jti, ok := claims["jti"].(string); ok && revokedTokens[jti] {
-		w.WriteHeader(http.StatusUnauthorized)
+	var input struct {
+		Name  *string `json:"name"`
+		Phone *string `json:"phone"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "invalid JSON input", http.StatusBadRequest)
 		return
 	}
-	userMap := claims["user"].(map[string]interface{})
-	userClaim := models.User{
-		Name:  fmt.Sprintf("%v", userMap["Name"]),
-		Email: fmt.Sprintf("%v", userMap["Email"]),
-		Phone: fmt.Sprintf("%v", userMap["Phone"]),
+	if input.Name != nil {
+		name := strings.Join(strings.Fields(*input.Name), " ")
+		if len(strings.Fields(name)) < 2 {
+			http.Error(w, "please provide both first and last name", http.StatusBadRequest)
+			return
+		}
+		input.Name = &name
 	}
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte(fmt.Sprintf("Token valid. User: %v", userClaim)))
+	if err := app.Models.UserModel.UpdateProfile(user, input.Name, input.Phone); err != nil {
+		http.Error(w, fmt.Sprintf("update failed: %v", err), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(user)
 }
 
-func (app *Application) GetJWTHandler(w http.ResponseWriter, r *http.Request) {
+// DeleteMeHandler deletes the authenticated user's account. The password must
+// be given again, so a stolen access token alone cannot delete an account.
+// Every session is signed out and the products and messaging services are
+// told through the outbox to remove the user's listings and anonymise their chats.
+func (app *Application) DeleteMeHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.authenticateUser(w, r)
+	if !ok {
+		return
+	}
 	var input struct {
-		Name  string `json:"name"`
-		Email string `json:"email"`
-		Phone string `json:"phone"`
+		Password string `json:"password"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Password == "" {
+		http.Error(w, "password is required", http.StatusBadRequest)
 		return
 	}
-	user := models.CreateUser(input.Name, input.Email, input.Phone)
-	token, _ := utils.GenerateJWT(*user)
-	w.Header().Set("Authorization", "Bearer "+token)
-	_, _ = w.Write([]byte("JWT generated successfully!"))
+	if !app.confirmPassword(w, r, user, input.Password) {
+		return
+	}
+
+	if err := app.Models.UserModel.Delete(user.Email); err != nil {
+		http.Error(w, "failed to delete account", http.StatusInternalServerError)
+		return
+	}
+	app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventAccountDelete, Outcome: models.OutcomeSuccess})
+	if err := app.revokeAllTokens(user); err != nil {
+		log.Println("failed to revoke tokens of deleted user:", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (app *Application) enableCORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
+// SendPhoneCodeHandler texts a verification code to the authenticated user's phone.
+func (app *Application) SendPhoneCodeHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+	if err := app.Models.UserModel.SendPhoneVerification(user); err != nil {
+		switch {
+		case errors.Is(err, models.ErrSMSUnavailable):
+			http.Error(w, models.ErrSMSUnavailable.Error(), http.StatusServiceUnavailable)
+		case errors.Is(err, models.ErrPhoneCodeTooSoon):
+			w.Header().Set("Retry-After", strconv.Itoa(int(models.PhoneCodeInterval.Seconds())))
+			http.Error(w, models.ErrPhoneCodeTooSoon.Error(), http.StatusTooManyRequests)
+		case errors.Is(err, models.ErrPhoneAlreadyVerified):
+			http.Error(w, models.ErrPhoneAlreadyVerified.Error(), http.StatusConflict)
+		case errors.Is(err, models.ErrNoPhone):
+			http.Error(w, models.ErrNoPhone.Error(), http.StatusBadRequest)
+		default:
+			log.Println("failed to send phone verification:", err)
+			http.Error(w, "failed to send verification code", http.StatusInternalServerError)
 		}
-		next.ServeHTTP(w, r)
-	})
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintln(w, "A verification code was sent to your phone.")
 }
 
-func (app *Application) Routes() http.Handler {
-	router := httprouter.New()
-	router.HandlerFunc("GET", "/", func(w http.ResponseWriter, _ *http.Request) { w.Write([]byte("OK")) })
+// VerifyPhoneHandler redeems the texted code and marks the phone as verified.
+func (app *Application) VerifyPhoneHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+	if err := app.Models.UserModel.VerifyPhone(user, input.Code); err != nil {
+		if errors.Is(err, models.ErrOTPInvalid) || errors.Is(err, models.ErrOTPExpired) {
+			http.Error(w, "invalid or expired code", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "failed to verify phone", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(user)
+}
+
+// EnrollTwoFactorHandler starts TOTP enrollment for the authenticated user.
+// The password must be given again. The response carries the otpauth URI and
+// the same as a QR code PNG, base64 encoded.
+func (app *Application) EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Password == "" {
+		http.Error(w, "password is required", http.StatusBadRequest)
+		return
+	}
+	if !app.confirmPassword(w, r, user, input.Password) {
+		return
+	}
+	enrollment, err := app.Models.TwoFactor.Enroll(user)
+	if errors.Is(err, models.ErrTwoFactorEnabled) {
+		http.Error(w, models.ErrTwoFactorEnabled.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "failed to start two-factor enrollment", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"secret":      enrollment.Secret,
+		"otpauth_uri": enrollment.URI,
+		"qr_png":      base64.StdEncoding.EncodeToString(enrollment.QRCode),
+	})
+}
+
+// ConfirmTwoFactorHandler enables two-factor authentication with a first code
+// from the authenticator app and returns the recovery codes, shown only once.
+func (app *Application) ConfirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+	codes, err := app.Models.TwoFactor.Confirm(user, strings.TrimSpace(input.Code))
+	switch {
+	case errors.Is(err, models.ErrTwoFactorEnabled):
+		http.Error(w, models.ErrTwoFactorEnabled.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, models.ErrTwoFactorNotEnrolled):
+		http.Error(w, models.ErrTwoFactorNotEnrolled.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, models.ErrInvalidSecondFactor):
+		app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventTwoFactorEnable, Outcome: models.OutcomeFailure, Reason: "wrong_code"})
+		http.Error(w, models.ErrInvalidSecondFactor.Error(), http.StatusUnauthorized)
+		return
+	case err != nil:
+		http.Error(w, "failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventTwoFactorEnable, Outcome: models.OutcomeSuccess})
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"recovery_codes": codes})
+}
+
+// DisableTwoFactorHandler turns two-factor authentication off. Both the
+// password and a current TOTP or recovery code are required.
+func (app *Application) DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Password == "" || input.Code == "" {
+		http.Error(w, "password and code are required", http.StatusBadRequest)
+		return
+	}
+	if !app.confirmPassword(w, r, user, input.Password) {
+		return
+	}
+	if err := app.Models.TwoFactor.Verify(user, input.Code); err != nil {
+		switch {
+		case errors.Is(err, models.ErrTwoFactorNotEnabled):
+			http.Error(w, models.ErrTwoFactorNotEnabled.Error(), http.StatusBadRequest)
+		case errors.Is(err, models.ErrInvalidSecondFactor):
+			app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventTwoFactorDisable, Outcome: models.OutcomeFailure, Reason: "wrong_code"})
+			app.recordLoginFailure(r, user.Email, user)
+			http.Error(w, models.ErrInvalidSecondFactor.Error(), http.StatusUnauthorized)
+		default:
+			http.Error(w, "failed to verify code", http.StatusInternalServerError)
+		}
+		return
+	}
+	if err := app.Models.TwoFactor.Disable(user); err != nil {
+		http.Error(w, "failed to disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventTwoFactorDisable, Outcome: models.OutcomeSuccess})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListSessionsHandler lists the authenticated user's sessions; the one the
+// request was made from is marked current.
+func (app *Application) ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, claims, ok := app.authenticate(w, r)
+	if !ok {
+		return
+	}
+	sessions, err := app.Models.SessionModel.List(user.UserID)
+	if err != nil {
+		http.Error(w, "failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+	current, _ := claims["sid"].(string)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(sessions)
+}
+
+// RevokeSessionHandler signs one of the authenticated user's sessions out.
+func (app *Application) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+	session, err := app.Models.SessionModel.Get(user.UserID, httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if errors.Is(err, models.ErrSessionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "failed to find session", http.StatusInternalServerError)
+		return
+	}
+	if err := app.revokeSession(session.ID); err != nil {
+		http.Error(w, "failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventSessionRevoke, Outcome: models.OutcomeSuccess})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeOtherSessionsHandler signs the authenticated user out everywhere
+// except the session the request was made from.
+func (app *Application) RevokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, claims, ok := app.authenticate(w, r)
+	if !ok {
+		return
+	}
+	current, _ := claims["sid"].(string)
+	sessions, err := app.Models.SessionModel.List(user.UserID)
+	if err != nil {
+		http.Error(w, "failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+	revoked := 0
+	for _, session := range sessions {
+		if session.ID == current {
+			continue
+		}
+		if err := app.revokeSession(session.ID); err != nil {
+			http.Error(w, "failed to revoke sessions", http.StatusInternalServerError)
+			return
+		}
+		revoked++
+	}
+	// Refresh tokens issued before sessions were recorded have no session row.
+	if err := app.Models.RefreshTokens.RevokeUserExcept(user.UserID, current); err != nil {
+		http.Error(w, "failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventSessionRevoke, Outcome: models.OutcomeSuccess, Reason: "all_other_sessions"})
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]int{"revoked": revoked})
+}
+
+// writePasskeyError answers with the status that fits a passkey model error.
+func writePasskeyError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrPasskeysUnavailable):
+		http.Error(w, models.ErrPasskeysUnavailable.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, models.ErrPasskeyExists):
+		http.Error(w, models.ErrPasskeyExists.Error(), http.StatusConflict)
+	case errors.Is(err, models.ErrPasskeyNotFound):
+		http.Error(w, models.ErrPasskeyNotFound.Error(), http.StatusNotFound)
+	case errors.Is(err, models.ErrCeremonyInvalid):
+		http.Error(w, models.ErrCeremonyInvalid.Error(), http.StatusBadRequest)
+	case errors.Is(err, models.ErrNoPasskeys), errors.Is(err, models.ErrPasskeyInvalid):
+		http.Error(w, models.ErrPasskeyInvalid.Error(), http.StatusUnauthorized)
+	default:
+		log.Println(fallback+":", err)
+		http.Error(w, fallback, http.StatusInternalServerError)
+	}
+}
+
+// BeginPasskeyRegistrationHandler returns the options for
+// navigator.credentials.create and a session token for the finish request.
+func (app *Application) BeginPasskeyRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+	if !user.Verified {
+		http.Error(w, "account not verified, please verify your email first", http.StatusForbidden)
+		return
+	}
+	options, token, err := app.Models.Passkeys.BeginRegistration(user)
+	if err != nil {
+		writePasskeyError(w, err, "failed to start passkey registration")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"session_token": token,
+		"options":       options,
+	})
+}
+
+// FinishPasskeyRegistrationHandler stores the passkey the browser created.
+// The body carries the session token, an optional name and the
+// PublicKeyCredential as JSON.
+func (app *Application) FinishPasskeyRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		SessionToken string          `json:"session_token"`
+		Name         string          `json:"name"`
+		Credential   json.RawMessage `json:"credential"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.SessionToken == "" || len(input.Credential) == 0 {
+		http.Error(w, "session_token and credential are required", http.StatusBadRequest)
+		return
+	}
+	passkey, err := app.Models.Passkeys.FinishRegistration(user, input.SessionToken, input.Name, bytes.NewReader(input.Credential))
+	if err != nil {
+		writePasskeyError(w, err, "failed to register passkey")
+		return
+	}
+	app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventPasskeyAdd, Outcome: models.OutcomeSuccess})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(passkey)
+}
+
+// ListPasskeysHandler lists the authenticated user's passkeys.
+func (app *Application) ListPasskeysHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+	passkeys, err := app.Models.Passkeys.List(user.UserID)
+	if err != nil {
+		http.Error(w, "failed to list passkeys", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(passkeys)
+}
+
+// DeletePasskeyHandler removes one of the authenticated user's passkeys.
+func (app *Application) DeletePasskeyHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(httprouter.ParamsFromContext(r.Context()).ByName("id"), 10, 32)
+	if err != nil {
+		http.Error(w, "invalid passkey id", http.StatusBadRequest)
+		return
+	}
+	if err := app.Models.Passkeys.Delete(user.UserID, uint(id)); err != nil {
+		writePasskeyError(w, err, "failed to delete passkey")
+		return
+	}
+	app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventPasskeyRemove, Outcome: models.OutcomeSuccess})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BeginPasskeyLoginHandler starts a passkey login. With an email only that
+// account's passkeys are offered; without one the browser lets the user pick
+// a discoverable passkey.
+func (app *Application) BeginPasskeyLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid JSON input", http.StatusBadRequest)
+		return
+	}
+	var user *models.User
+	if email := strings.TrimSpace(input.Email); email != "" {
+		var err error
+		if user, err = app.Models.UserModel.Read(email); err != nil {
+			http.Error(w, models.ErrPasskeyInvalid.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+	options, token, err := app.Models.Passkeys.BeginLogin(user)
+	if err != nil {
+		writePasskeyError(w, err, "failed to start passkey login")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"session_token": token,
+		"options":       options,
+	})
+}
+
+// FinishPasskeyLoginHandler verifies the browser's assertion and answers like
+// LoginHandler. Passkey ceremonies require user verification, so a passkey
+// proves both possession and the user and TOTP is not asked for on top.
+func (app *Application) FinishPasskeyLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		SessionToken string          `json:"session_token"`
+		Credential   json.RawMessage `json:"credential"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.SessionToken == "" || len(input.Credential) == 0 {
+		http.Error(w, "session_token and credential are required", http.StatusBadRequest)
+		return
+	}
+	user, err := app.Models.Passkeys.FinishLogin(input.SessionToken, bytes.NewReader(input.Credential))
+	if err != nil {
+		if errors.Is(err, models.ErrPasskeyInvalid) || errors.Is(err, models.ErrCeremonyInvalid) || errors.Is(err, models.ErrPasskeyNotFound) {
+			app.recordAuthEvent(r, nil, models.AuthEvent{Type: models.AuthEventLoginPasskey, Outcome: models.OutcomeFailure, Reason: "invalid_passkey"})
+		}
+		writePasskeyError(w, err, "failed to verify passkey")
+		return
+	}
+	if app.writeLoginBlocked(w, r, user, models.AuthEventLoginPasskey) {
+		return
+	}
+	if app.writeDeactivated(w, r, user, models.AuthEventLoginPasskey) {
+		return
+	}
+	app.completeLogin(w, r, user, models.AuthEventLoginPasskey)
+}
+
+// RequestEmailChangeHandler starts changing the authenticated user's email.
+// The password must be given again; a code is sent to the new address.
+func (app *Application) RequestEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		NewEmail string `json:"new_email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.NewEmail == "" || input.Password == "" {
+		http.Error(w, "new_email and password are required", http.StatusBadRequest)
+		return
+	}
+	if !app.confirmPassword(w, r, user, input.Password) {
+		return
+	}
+	if err := app.Models.UserModel.RequestEmailChange(user, input.NewEmail); err != nil {
+		if errors.Is(err, models.ErrEmailTaken) {
+			http.Error(w, models.ErrEmailTaken.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, fmt.Sprintf("email change failed: %v", err), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintln(w, "A confirmation code was sent to the new email address.")
+}
+
+// ConfirmEmailChangeHandler redeems the code sent to the new address and
+// switches the account to it. Every outstanding token is revoked, so the user
+// signs in again with the new email.
+func (app *Application) ConfirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+	if err := app.Models.UserModel.ConfirmEmailChange(user, input.Code); err != nil {
+		app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventEmailChange, Outcome: models.OutcomeFailure, Reason: codeFailureReason(err)})
+		switch {
+		case errors.Is(err, models.ErrNoEmailChange):
+			http.Error(w, models.ErrNoEmailChange.Error(), http.StatusBadRequest)
+		case errors.Is(err, models.ErrEmailTaken):
+			http.Error(w, models.ErrEmailTaken.Error(), http.StatusConflict)
+		case errors.Is(err, models.ErrEmailChangeCancelled):
+			http.Error(w, models.ErrEmailChangeCancelled.Error(), http.StatusUnauthorized)
+		case errors.Is(err, models.ErrOTPInvalid), errors.Is(err, models.ErrOTPExpired):
+			http.Error(w, "invalid or expired code", http.StatusUnauthorized)
+		default:
+			http.Error(w, "failed to change email", http.StatusInternalServerError)
+		}
+		return
+	}
+	app.recordAuthEvent(r, user, models.AuthEvent{Type: models.AuthEventEmailChange, Outcome: models.OutcomeSuccess})
+	if err := app.revokeAllTokens(user); err != nil {
+		log.Println("failed to revoke tokens after email change:", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(user)
+}
+
+func (app *Application) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	bearer := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(bearer) != 2 || bearer[0] != "Bearer" {
+		http.Error(w, "invalid authorization header", http.StatusBadRequest)
+		return
+	}
+	jwtToken, err := utils.ParseJWT(bearer[1])
+	if err != nil || !jwtToken.Valid {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	claims := jwtToken.Claims.(jwt.MapClaims)
+	if jti, ok := claims["jti"].(string); ok {
+		exp, err := claims.GetExpirationTime()
+		if err != nil || exp == nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		if err := app.Models.TokenRevocations.Revoke(jti, exp.Time); err != nil {
+			http.Error(w, "failed to revoke token", http.StatusInternalServerError)
+			return
+		}
+	}
+	if sid, ok := claims["sid"].(string); ok {
+		if err := app.revokeSession(sid); err != nil {
+			http.Error(w, "failed to end session", http.StatusInternalServerError)
+			return
+		}
+	}
+	if sub, _ := claims.GetSubject(); sub != "" {
+		if userID, err := strconv.Atoi(sub); err == nil {
+			app.recordAuthEvent(r, &models.User{UserID: userID}, models.AuthEvent{Type: models.AuthEventLogout, Outcome: models.OutcomeSuccess})
+		}
+	}
+	// The refresh token is optional; when present its whole family is revoked.
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if r.Body != nil && json.NewDecoder(r.Body).Decode(&input) == nil && input.RefreshToken != "" {
+		if err := app.Models.RefreshTokens.RevokeToken(input.RefreshToken); err != nil {
+			http.Error(w, "failed to revoke refresh token", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "Logout successful, token revoked.")
+}
+
+// VerifyJWTHandler tells other services whether a token issued here is still
+// valid: 200 if so, 401 if it is invalid or revoked or its user may no longer
+// sign in. Like authenticate, it identifies the user by the sub claim.
+func (app *Application) VerifyJWTHandler(w http.ResponseWriter, r *http.Request) {
+	bearer := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(bearer) != 2 || bearer[0] != "Bearer" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	jwtToken, err := utils.ParseJWT(bearer[1])
+	if err != nil || !jwtToken.Valid {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	claims := jwtToken.Claims.(jwt.MapClaims)
+	revoked, err := app.tokenRevoked(claims)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if revoked {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	sub, _ := claims.GetSubject()
+	if claims["token_use"] == "service" {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(fmt.Sprintf("Token valid. Service: %s", sub)))
+		return
+	}
+	userID, err := strconv.Atoi(sub)
+	if err != nil || userID <= 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	user, err := app.Models.UserModel.ReadByID(userID)
+	if err != nil || user.CurrentStatus(time.Now()) == models.StatusDeactivated {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	userClaim := models.User{Name: user.Name, Email: user.Email, Phone: user.Phone}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(fmt.Sprintf("Token valid. User: %v", userClaim)))
+}
+
+// requireServiceAccount authenticates the caller with HTTP Basic client
+// credentials and checks that the account has scope. It writes the error
+// response itself and reports whether the request may proceed.
+func (app *Application) requireServiceAccount(w http.ResponseWriter, r *http.Request, scope string) (*models.ServiceAccount, bool) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="users"`)
+		http.Error(w, "client credentials required", http.StatusUnauthorized)
+		return nil, false
+	}
+	account, err := app.Models.ServiceAccounts.Authenticate(clientID, secret)
+	if errors.Is(err, models.ErrInvalidClient) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="users"`)
+		http.Error(w, "invalid client credentials", http.StatusUnauthorized)
+		return nil, false
+	} else if err != nil {
+		http.Error(w, "failed to authenticate client", http.StatusInternalServerError)
+		return nil, false
+	}
+	if !account.HasScope(scope) {
+		http.Error(w, fmt.Sprintf("client lacks the %s scope", scope), http.StatusForbidden)
+		return nil, false
+	}
+	return account, true
+}
+
+// requirePermission authenticates the user like authenticateUser and checks
+// that their current role grants permission. The role is read from the
+// database, so a demotion applies here at once.
+func (app *Application) requirePermission(w http.ResponseWriter, r *http.Request, permission string) (*models.User, bool) {
+	user, ok := app.authenticateUser(w, r)
+	if !ok {
+		return nil, false
+	}
+	if !user.CurrentRole().Can(permission) {
+		http.Error(w, fmt.Sprintf("the %s permission is required", permission), http.StatusForbidden)
+		return nil, false
+	}
+	return user, true
+}
+
+// authorizeAdmin lets through a user whose role grants permission, when the
+// request has a bearer token, or else a service account with scope.
+func (app *Application) authorizeAdmin(w http.ResponseWriter, r *http.Request, scope, permission string) bool {
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		_, ok := app.requirePermission(w, r, permission)
+		return ok
+	}
+	_, ok := app.requireServiceAccount(w, r, scope)
+	return ok
+}
+
+// SetUserRoleHandler changes the role of a user. It needs the users:manage
+// permission; admins cannot change their own role, so the last admin cannot
+// demote themselves by accident. The user's tokens are revoked so that the
+// new role is in the claims from the next login on.
+func (app *Application) SetUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := app.requirePermission(w, r, models.PermManageUsers)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid user ID", http.StatusBadRequest)
+		return
+	}
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "invalid JSON input", http.StatusBadRequest)
+		return
+	}
+	role, err := models.ParseRole(input.Role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if id == admin.UserID {
+		http.Error(w, "admins cannot change their own role", http.StatusConflict)
+		return
+	}
+	user, err := app.Models.UserModel.ReadByID(id)
+	if err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if user.CurrentRole() != role {
+		if err := app.Models.UserModel.SetRole(user, role, app.auditActor(r, admin)); err != nil {
+			http.Error(w, "failed to change role", http.StatusInternalServerError)
+			return
+		}
+		if err := app.revokeAllTokens(user); err != nil {
+			log.Println("failed to revoke tokens after role change:", err)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"userid":      user.UserID,
+		"role":        role,
+		"permissions": role.Permissions(),
+	})
+}
+
+// adminUser is the view of an account that admins get, including the state
+// that other endpoints keep private.
+type adminUser struct {
+	UserID           int                  `json:"userid"`
+	PublicID         string               `json:"public_id"`
+	Name             string               `json:"name"`
+	Email            string               `json:"email"`
+	Phone            string               `json:"phone"`
+	PhoneVerified    bool                 `json:"phone_verified"`
+	Verified         bool                 `json:"verified"`
+	Status           models.AccountStatus `json:"status"`
+	Role             models.Role          `json:"role"`
+	TwoFactorEnabled bool                 `json:"two_factor_enabled"`
+	PasswordBreached bool                 `json:"password_breached"`
+	LockedUntil      *time.Time           `json:"locked_until,omitempty"`
+	CreatedAt        time.Time            `json:"created_at"`
+	DeletedAt        *time.Time           `json:"deleted_at,omitempty"`
+}
+
+func newAdminUser(user *models.User) adminUser {
+	view := adminUser{
+		UserID:           user.UserID,
+		PublicID:         user.PublicID,
+		Name:             user.Name,
+		Email:            user.Email,
+		Phone:            user.Phone,
+		PhoneVerified:    user.PhoneVerified,
+		Verified:         user.Verified,
+		Status:           user.CurrentStatus(time.Now()),
+		Role:             user.CurrentRole(),
+		TwoFactorEnabled: user.TOTPEnabled,
+		PasswordBreached: user.PasswordBreached,
+		CreatedAt:        user.CreatedAt,
+	}
+	if view.Status == models.StatusLocked {
+		view.LockedUntil = user.LockedUntil
+	}
+	if user.DeletedAt.Valid {
+		view.Status, view.DeletedAt = models.StatusDeleted, &user.DeletedAt.Time
+	}
+	return view
+}
+
+func (app *Application) auditActor(r *http.Request, admin *models.User) models.AuditActor {
+	return models.AuditActor{UserID: admin.UserID, IP: app.clientIP(r)}
+}
+
+// adminTarget authorizes an admin with the users:manage permission and loads
+// the user named by the :id parameter. Soft-deleted users are only found with
+// allowDeleted. It writes the error response itself and reports whether the
+// request may proceed.
+func (app *Application) adminTarget(w http.ResponseWriter, r *http.Request, allowDeleted bool) (admin, user *models.User, ok bool) {
+	admin, ok = app.requirePermission(w, r, models.PermManageUsers)
+	if !ok {
+		return nil, nil, false
+	}
+	id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid user ID", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	user, err = app.Models.UserModel.ReadAnyByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return nil, nil, false
+	} else if err != nil {
+		http.Error(w, "failed to read user", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if user.DeletedAt.Valid && !allowDeleted {
+		http.Error(w, "account is deleted, restore it first", http.StatusConflict)
+		return nil, nil, false
+	}
+	return admin, user, true
+}
+
+// adminConflicts are the UserModel admin action errors caused by the
+// account's current state.
+var adminConflicts = []error{
+	models.ErrAlreadyVerified,
+	models.ErrTwoFactorNotEnabled,
+	models.ErrNotDeleted,
+	models.ErrEmailTaken,
+	models.ErrInvalidStatusTransition,
+}
+
+func writeAdminError(w http.ResponseWriter, err error, fallback string) {
+	for _, conflict := range adminConflicts {
+		if errors.Is(err, conflict) {
+			http.Error(w, conflict.Error(), http.StatusConflict)
+			return
+		}
+	}
+	log.Println(fallback+":", err)
+	http.Error(w, fallback, http.StatusInternalServerError)
+}
+
+// parseAdminDate accepts an RFC 3339 timestamp or a plain date.
+func parseAdminDate(value string) (*time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListUsersHandler searches accounts for admins. Query parameters: q (part of
+// the name or email), verified, university (registry ID), created_after,
+// created_before, deleted, page and per_page.
+func (app *Application) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := app.requirePermission(w, r, models.PermManageUsers); !ok {
+		return
+	}
+	query := r.URL.Query()
+	filter := models.UserFilter{Query: query.Get("q"), Page: 1, PerPage: 50}
+	for name, value := range query {
+		var err error
+		switch name {
+		case "verified":
+			var verified bool
+			verified, err = strconv.ParseBool(value[0])
+			filter.Verified = &verified
+		case "deleted":
+			filter.Deleted, err = strconv.ParseBool(value[0])
+		case "university":
+			id, parseErr := strconv.ParseUint(value[0], 10, 32)
+			if parseErr != nil {
+				err = parseErr
+				break
+			}
+			university, getErr := app.Models.Universities.Get(uint(id))
+			if getErr != nil {
+				http.Error(w, "university not found", http.StatusBadRequest)
+				return
+			}
+			filter.EmailDomain = university.Domain
+		case "created_after":
+			filter.CreatedAfter, err = parseAdminDate(value[0])
+		case "created_before":
+			filter.CreatedBefore, err = parseAdminDate(value[0])
+		case "page":
+			filter.Page, err = strconv.Atoi(value[0])
+			if err == nil && filter.Page < 1 {
+				err = errors.New("page must be at least 1")
+			}
+		case "per_page":
+			filter.PerPage, err = strconv.Atoi(value[0])
+			if err == nil && (filter.PerPage < 1 || filter.PerPage > 100) {
+				err = errors.New("per_page must be between 1 and 100")
+			}
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid %s", name), http.StatusBadRequest)
+			return
+		}
+	}
+	users, total, err := app.Models.UserModel.Search(filter)
+	if err != nil {
+		http.Error(w, "failed to list users", http.StatusInternalServerError)
+		return
+	}
+	views := make([]adminUser, len(users))
+	for i := range users {
+		views[i] = newAdminUser(&users[i])
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"users":    views,
+		"total":    total,
+		"page":     filter.Page,
+		"per_page": filter.PerPage,
+	})
+}
+
+// GetUserHandler shows an account to admins together with its security state:
+// sessions, passkeys, two-factor recovery codes, failed logins, its latest
+// auth events and the admin actions taken on it.
+func (app *Application) GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	_, user, ok := app.adminTarget(w, r, true)
+	if !ok {
+		return
+	}
+	sessions, err := app.Models.SessionModel.List(user.UserID)
+	if err != nil {
+		http.Error(w, "failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+	passkeys, err := app.Models.Passkeys.List(user.UserID)
+	if err != nil {
+		http.Error(w, "failed to list passkeys", http.StatusInternalServerError)
+		return
+	}
+	recoveryCodes, err := app.Models.TwoFactor.RemainingRecoveryCodes(user.UserID)
+	if err != nil {
+		http.Error(w, "failed to count recovery codes", http.StatusInternalServerError)
+		return
+	}
+	attempts, err := app.Models.LoginThrottle.State(user.Email)
+	if err != nil {
+		http.Error(w, "failed to read login attempts", http.StatusInternalServerError)
+		return
+	}
+	var failedLogins interface{}
+	if attempts != nil {
+		failedLogins = map[string]interface{}{
+			"failures":        attempts.Failures,
+			"last_failure_at": attempts.LastFailureAt,
+			"locked_until":    attempts.LockedUntil,
+		}
+	}
+	audit, err := app.Models.AuditLog.List(models.AuditFilter{TargetID: user.UserID, Limit: 50})
+	if err != nil {
+		http.Error(w, "failed to read audit log", http.StatusInternalServerError)
+		return
+	}
+	events, err := app.Models.AuthEvents.List(models.AuthEventFilter{UserID: user.UserID, Limit: 50})
+	if err != nil {
+		http.Error(w, "failed to read auth events", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"user":                newAdminUser(user),
+		"sessions":            sessions,
+		"passkeys":            passkeys,
+		"recovery_codes_left": recoveryCodes,
+		"failed_logins":       failedLogins,
+		"auth_events":         events,
+		"audit":               audit,
+	})
+}
+
+// VerifyUserHandler marks an account's email as verified without a code.
+func (app *Application) VerifyUserHandler(w http.ResponseWriter, r *http.Request) {
+	admin, user, ok := app.adminTarget(w, r, false)
+	if !ok {
+		return
+	}
+	if err := app.Models.UserModel.ForceVerify(user, app.auditActor(r, admin)); err != nil {
+		writeAdminError(w, err, "failed to verify user")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(newAdminUser(user))
+}
+
+// LockUserHandler locks an account for a duration and signs it out everywhere.
+func (app *Application) LockUserHandler(w http.ResponseWriter, r *http.Request) {
+	admin, user, ok := app.adminTarget(w, r, false)
+	if !ok {
+		return
+	}
+	var input struct {
+		Duration string `json:"duration"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "invalid JSON input", http.StatusBadRequest)
+		return
+	}
+	duration, err := time.ParseDuration(input.Duration)
+	if err != nil || duration <= 0 {
+		http.Error(w, "duration must be a positive duration such as 72h", http.StatusBadRequest)
+		return
+	}
+	if user.UserID == admin.UserID {
+		http.Error(w, "admins cannot lock their own account", http.StatusConflict)
+		return
+	}
+	if err := app.Models.UserModel.Lock(user, time.Now().Add(duration), input.Reason, app.auditActor(r, admin)); err != nil {
+		writeAdminError(w, err, "failed to lock user")
+		return
+	}
+	if err := app.revokeAllTokens(user); err != nil {
+		log.Println("failed to revoke tokens of locked user:", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(newAdminUser(user))
+}
+
+// UnlockUserHandler lifts an account lock and any login lockout.
+func (app *Application) UnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	admin, user, ok := app.adminTarget(w, r, false)
+	if !ok {
+		return
+	}
+	if err := app.Models.UserModel.Unlock(user, app.auditActor(r, admin)); err != nil {
+		writeAdminError(w, err, "failed to unlock user")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(newAdminUser(user))
+}
+
+// DeactivateUserHandler suspends an active account until an admin reactivates
+// it and signs it out everywhere.
+func (app *Application) DeactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	admin, user, ok := app.adminTarget(w, r, false)
+	if !ok {
+		return
+	}
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "invalid JSON input", http.StatusBadRequest)
+			return
+		}
+	}
+	if user.UserID == admin.UserID {
+		http.Error(w, "admins cannot deactivate their own account", http.StatusConflict)
+		return
+	}
+	if err := app.Models.UserModel.Deactivate(user, input.Reason, app.auditActor(r, admin)); err != nil {
+		writeAdminError(w, err, "failed to deactivate user")
+		return
+	}
+	if err := app.revokeAllTokens(user); err != nil {
+		log.Println("failed to revoke tokens of deactivated user:", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(newAdminUser(user))
+}
+
+// ReactivateUserHandler lets a deactivated account sign in again.
+func (app *Application) ReactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	admin, user, ok := app.adminTarget(w, r, false)
+	if !ok {
+		return
+	}
+	if err := app.Models.UserModel.Reactivate(user, app.auditActor(r, admin)); err != nil {
+		writeAdminError(w, err, "failed to reactivate user")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(newAdminUser(user))
+}
+
+// ResetTwoFactorHandler turns off two-factor authentication for a user who
+// lost their authenticator and recovery codes.
+func (app *Application) ResetTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	admin, user, ok := app.adminTarget(w, r, false)
+	if !ok {
+		return
+	}
+	if err := app.Models.UserModel.ResetTwoFactor(user, app.auditActor(r, admin)); err != nil {
+		writeAdminError(w, err, "failed to reset two-factor authentication")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminDeleteUserHandler soft-deletes an account and signs it out everywhere.
+// Like DELETE /me, the other services remove the user's data.
+func (app *Application) AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	admin, user, ok := app.adminTarget(w, r, true)
+	if !ok {
+		return
+	}
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "invalid JSON input", http.StatusBadRequest)
+			return
+		}
+	}
+	if user.UserID == admin.UserID {
+		http.Error(w, "admins cannot delete their own account here", http.StatusConflict)
+		return
+	}
+	if user.DeletedAt.Valid {
+		http.Error(w, "account is already deleted", http.StatusConflict)
+		return
+	}
+	if err := app.Models.UserModel.SoftDelete(user, input.Reason, app.auditActor(r, admin)); err != nil {
+		writeAdminError(w, err, "failed to delete user")
+		return
+	}
+	if err := app.revokeAllTokens(user); err != nil {
+		log.Println("failed to revoke tokens of deleted user:", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RestoreUserHandler brings back a soft-deleted account.
+func (app *Application) RestoreUserHandler(w http.ResponseWriter, r *http.Request) {
+	admin, user, ok := app.adminTarget(w, r, true)
+	if !ok {
+		return
+	}
+	if err := app.Models.UserModel.Restore(user, app.auditActor(r, admin)); err != nil {
+		writeAdminError(w, err, "failed to restore user")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(newAdminUser(user))
+}
+
+// ListAuditHandler pages through the audit log, newest first. Query
+// parameters: actor and target (user IDs), before (an entry ID) and limit.
+func (app *Application) ListAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := app.requirePermission(w, r, models.PermManageUsers); !ok {
+		return
+	}
+	query := r.URL.Query()
+	filter := models.AuditFilter{Limit: 50}
+	for name, value := range query {
+		var err error
+		switch name {
+		case "actor":
+			filter.ActorID, err = strconv.Atoi(value[0])
+		case "target":
+			filter.TargetID, err = strconv.Atoi(value[0])
+		case "before":
+			filter.Before, err = strconv.ParseInt(value[0], 10, 64)
+		case "limit":
+			filter.Limit, err = strconv.Atoi(value[0])
+			if err == nil && (filter.Limit < 1 || filter.Limit > 200) {
+				err = errors.New("limit must be between 1 and 200")
+			}
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid %s", name), http.StatusBadRequest)
+			return
+		}
+	}
+	entries, err := app.Models.AuditLog.List(filter)
+	if err != nil {
+		http.Error(w, "failed to read audit log", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+// UnlockAccountHandler lifts a login lockout. It requires a service account
+// with the accounts:unlock scope.
+func (app *Application) UnlockAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := app.requireServiceAccount(w, r, models.ScopeAccountUnlock); !ok {
+		return
+	}
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+	if err := app.Models.LoginThrottle.Unlock(input.Email); err != nil {
+		http.Error(w, "failed to unlock account", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "Account unlocked.")
+}
+
+// TokenExchangeHandler lets a service account obtain an access token for an
+// existing, verified user. The client authenticates with HTTP Basic auth
+// (client ID and secret) and needs the token:exchange scope.
+func (app *Application) TokenExchangeHandler(w http.ResponseWriter, r *http.Request) {
+	account, ok := app.requireServiceAccount(w, r, models.ScopeTokenExchange)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		UserID int    `json:"user_id"`
+		Email  string `json:"email"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil || (input.UserID == 0 && input.Email == "") {
+		http.Error(w, "user_id or email is required", http.StatusBadRequest)
+		return
+	}
+	var user *models.User
+	if input.UserID != 0 {
+		user, err = app.Models.UserModel.ReadByID(input.UserID)
+	} else {
+		user, err = app.Models.UserModel.Read(input.Email)
+	}
+	if err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if !user.Verified {
+		http.Error(w, "user is not verified", http.StatusForbidden)
+		return
+	}
+	// A service acts for the user only while the user could log in themselves.
+	switch user.CurrentStatus(time.Now()) {
+	case models.StatusLocked:
+		http.Error(w, "user is locked", http.StatusForbidden)
+		return
+	case models.StatusDeactivated:
+		http.Error(w, "user is deactivated", http.StatusForbidden)
+		return
+	}
+	token, err := utils.GenerateDelegatedJWT(*user, account.ClientID)
+	if err != nil {
+		http.Error(w, "failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":      token,
+		"expires_in": int(utils.AccessTokenTTL().Seconds()),
+	})
+}
+
+// GetJWTHandler issues a token for an existing user without credentials. It is
+// only routed when TestMode is enabled, for integration tests.
+func (app *Application) GetJWTHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	user, err := app.Models.UserModel.Read(input.Email)
+	if err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	token, err := utils.GenerateJWT(*user)
+	if err != nil {
+		http.Error(w, "failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Authorization", "Bearer "+token)
+	_, _ = w.Write([]byte("JWT generated successfully!"))
+}
+
+// ListUniversitiesHandler returns the enabled universities and their campuses,
+// for sign-up hints and product locations.
+func (app *Application) ListUniversitiesHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := app.Models.Universities.List(false)
+	if err != nil {
+		http.Error(w, "failed to list universities", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+// universityInput is the body of the admin create and update endpoints.
+// Enabled defaults to true when omitted.
+type universityInput struct {
+	Domain   string   `json:"domain"`
+	Name     string   `json:"name"`
+	Campuses []string `json:"campuses"`
+	Enabled  *bool    `json:"enabled"`
+}
+
+func (in universityInput) university() models.University {
+	u := models.University{Domain: in.Domain, Name: in.Name, Campuses: in.Campuses, Enabled: true}
+	if in.Enabled != nil {
+		u.Enabled = *in.Enabled
+	}
+	return u
+}
+
+func universityID(r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(httprouter.ParamsFromContext(r.Context()).ByName("id"), 10, 32)
+	return uint(id), err == nil && id > 0
+}
+
+func (app *Application) AdminListUniversitiesHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.authorizeAdmin(w, r, models.ScopeUniversitiesWrite, models.PermManageUniversities) {
+		return
+	}
+	list, err := app.Models.Universities.List(true)
+	if err != nil {
+		http.Error(w, "failed to list universities", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+func (app *Application) CreateUniversityHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.authorizeAdmin(w, r, models.ScopeUniversitiesWrite, models.PermManageUniversities) {
+		return
+	}
+	var input universityInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "invalid JSON input", http.StatusBadRequest)
+		return
+	}
+	university := input.university()
+	if err := app.Models.Universities.Create(&university); err != nil {
+		status := http.StatusConflict
+		if errors.Is(err, models.ErrInvalidUniversity) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, fmt.Sprintf("could not create university: %v", err), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(university)
+}
+
+func (app *Application) UpdateUniversityHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.authorizeAdmin(w, r, models.ScopeUniversitiesWrite, models.PermManageUniversities) {
+		return
+	}
+	id, ok := universityID(r)
+	if !ok {
+		http.Error(w, "invalid university ID", http.StatusBadRequest)
+		return
+	}
+	existing, err := app.Models.Universities.Get(id)
+	if err != nil {
+		http.Error(w, "university not found", http.StatusNotFound)
+		return
+	}
+	var input universityInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "invalid JSON input", http.StatusBadRequest)
+		return
+	}
+	university := input.university()
+	university.ID, university.CreatedAt = existing.ID, existing.CreatedAt
+	if err := app.Models.Universities.Update(&university); err != nil {
+		status := http.StatusConflict
+		if errors.Is(err, models.ErrInvalidUniversity) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, fmt.Sprintf("could not update university: %v", err), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(university)
+}
+
+func (app *Application) DeleteUniversityHandler(w http.ResponseWriter, r *http.Request) {
+	if !app.authorizeAdmin(w, r, models.ScopeUniversitiesWrite, models.PermManageUniversities) {
+		return
+	}
+	id, ok := universityID(r)
+	if !ok {
+		http.Error(w, "invalid university ID", http.StatusBadRequest)
+		return
+	}
+	if err := app.Models.Universities.Delete(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "university not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to delete university", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authEventFilter reads the auth event query parameters: type, outcome,
+// since, until, before (an event ID) and limit, and for admins also user,
+// email and ip. It writes the error response itself and reports whether the
+// request may proceed.
+func authEventFilter(w http.ResponseWriter, r *http.Request, admin bool) (models.AuthEventFilter, bool) {
+	filter := models.AuthEventFilter{Limit: 50}
+	for name, value := range r.URL.Query() {
+		var err error
+		switch name {
+		case "type":
+			filter.Type = value[0]
+		case "outcome":
+			filter.Outcome = value[0]
+		case "since":
+			filter.Since, err = parseAdminDate(value[0])
+		case "until":
+			filter.Until, err = parseAdminDate(value[0])
+		case "before":
+			filter.Before, err = strconv.ParseInt(value[0], 10, 64)
+		case "limit":
+			filter.Limit, err = strconv.Atoi(value[0])
+			if err == nil && (filter.Limit < 1 || filter.Limit > 200) {
+				err = errors.New("limit must be between 1 and 200")
+			}
+		case "user":
+			if admin {
+				filter.UserID, err = strconv.Atoi(value[0])
+			}
+		case "email":
+			if admin {
+				filter.Email = value[0]
+			}
+		case "ip":
+			if admin {
+				filter.IP = value[0]
+			}
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid %s", name), http.StatusBadRequest)
+			return models.AuthEventFilter{}, false
+		}
+	}
+	return filter, true
+}
+
+// MyAuthEventsHandler lists the authentication events of the authenticated
+// user, newest first, so they can spot sign-ins they do not recognise.
+func (app *Application) MyAuthEventsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.authenticateUser(w, r)
+	if !ok {
+		return
+	}
+	filter, ok := authEventFilter(w, r, false)
+	if !ok {
+		return
+	}
+	filter.UserID = user.UserID
+	events, err := app.Models.AuthEvents.List(filter)
+	if err != nil {
+		http.Error(w, "failed to read auth events", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(events)
+}
+
+// ListAuthEventsHandler lets admins query the authentication events of every
+// account, including attempts on emails that have no account.
+func (app *Application) ListAuthEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := app.requirePermission(w, r, models.PermManageUsers); !ok {
+		return
+	}
+	filter, ok := authEventFilter(w, r, true)
+	if !ok {
+		return
+	}
+	events, err := app.Models.AuthEvents.List(filter)
+	if err != nil {
+		http.Error(w, "failed to read auth events", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(events)
+}
+
+// JWKSHandler publishes the public keys other services use to verify access tokens.
+func (app *Application) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	_ = json.NewEncoder(w).Encode(utils.CurrentKeySet().JWKS())
+}
+
+func (app *Application) enableCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *Application) Routes() http.Handler {
+	router := httprouter.New()
+	router.HandlerFunc("GET", "/", func(w http.ResponseWriter, _ *http.Request) { w.Write([]byte("OK")) })
 
 	router.HandlerFunc("POST", "/signup", app.SignUpHandler)
 	router.HandlerFunc("POST", "/verifyEmail", app.VerifyEmailHandler)
@@ -342,15 +2195,59 @@ func (app *Application) Routes() http.Handler {
 	router.HandlerFunc("GET", "/forgotPassword", app.ForgotPasswordHandler)
 	router.HandlerFunc("POST", "/updatePassword", app.UpdatePasswordHandler)
 
-	router.HandlerFunc("POST", "/deleteUser", app.DeleteUserHandler)
 	router.HandlerFunc("GET", "/displayUser/:id", app.DisplayUserHandler)
-	router.HandlerFunc("POST", "/updateName", app.UpdateNameHandler)
-	router.HandlerFunc("POST", "/updatePhone", app.UpdatePhoneHandler)
+
+	router.HandlerFunc("GET", "/me", app.MeHandler)
+	router.HandlerFunc("PATCH", "/me", app.UpdateMeHandler)
+	router.HandlerFunc("DELETE", "/me", app.DeleteMeHandler)
+	router.HandlerFunc("POST", "/me/email", app.RequestEmailChangeHandler)
+	router.HandlerFunc("POST", "/me/email/confirm", app.ConfirmEmailChangeHandler)
+	router.HandlerFunc("POST", "/me/phone/verify", app.SendPhoneCodeHandler)
+	router.HandlerFunc("POST", "/me/phone/confirm", app.VerifyPhoneHandler)
+	router.HandlerFunc("POST", "/me/2fa/enroll", app.EnrollTwoFactorHandler)
+	router.HandlerFunc("POST", "/me/2fa/confirm", app.ConfirmTwoFactorHandler)
+	router.HandlerFunc("DELETE", "/me/2fa", app.DisableTwoFactorHandler)
+	router.HandlerFunc("GET", "/me/auth-events", app.MyAuthEventsHandler)
+	router.HandlerFunc("GET", "/me/passkeys", app.ListPasskeysHandler)
+	router.HandlerFunc("POST", "/me/passkeys", app.BeginPasskeyRegistrationHandler)
+	router.HandlerFunc("POST", "/me/passkeys/finish", app.FinishPasskeyRegistrationHandler)
+	router.HandlerFunc("DELETE", "/me/passkeys/:id", app.DeletePasskeyHandler)
+	router.HandlerFunc("GET", "/sessions", app.ListSessionsHandler)
+	router.HandlerFunc("DELETE", "/sessions", app.RevokeOtherSessionsHandler)
+	router.HandlerFunc("DELETE", "/sessions/:id", app.RevokeSessionHandler)
 
 	router.HandlerFunc("POST", "/login", app.LoginHandler)
+	router.HandlerFunc("POST", "/login/2fa", app.LoginTwoFactorHandler)
+	router.HandlerFunc("POST", "/login/passkey", app.BeginPasskeyLoginHandler)
+	router.HandlerFunc("POST", "/login/passkey/finish", app.FinishPasskeyLoginHandler)
 	router.HandlerFunc("POST", "/logout", app.LogoutHandler)
-	router.HandlerFunc("POST", "/getjwt", app.GetJWTHandler)
+	router.HandlerFunc("POST", "/token/refresh", app.RefreshTokenHandler)
+	router.HandlerFunc("POST", "/token/exchange", app.TokenExchangeHandler)
+	router.HandlerFunc("POST", "/admin/unlock", app.UnlockAccountHandler)
+
+	router.HandlerFunc("GET", "/universities", app.ListUniversitiesHandler)
+	router.HandlerFunc("GET", "/admin/universities", app.AdminListUniversitiesHandler)
+	router.HandlerFunc("POST", "/admin/universities", app.CreateUniversityHandler)
+	router.HandlerFunc("PUT", "/admin/universities/:id", app.UpdateUniversityHandler)
+	router.HandlerFunc("DELETE", "/admin/universities/:id", app.DeleteUniversityHandler)
+	router.HandlerFunc("GET", "/admin/users", app.ListUsersHandler)
+	router.HandlerFunc("GET", "/admin/users/:id", app.GetUserHandler)
+	router.HandlerFunc("DELETE", "/admin/users/:id", app.AdminDeleteUserHandler)
+	router.HandlerFunc("PUT", "/admin/users/:id/role", app.SetUserRoleHandler)
+	router.HandlerFunc("POST", "/admin/users/:id/verify", app.VerifyUserHandler)
+	router.HandlerFunc("POST", "/admin/users/:id/lock", app.LockUserHandler)
+	router.HandlerFunc("POST", "/admin/users/:id/unlock", app.UnlockUserHandler)
+	router.HandlerFunc("POST", "/admin/users/:id/deactivate", app.DeactivateUserHandler)
+	router.HandlerFunc("POST", "/admin/users/:id/reactivate", app.ReactivateUserHandler)
+	router.HandlerFunc("DELETE", "/admin/users/:id/2fa", app.ResetTwoFactorHandler)
+	router.HandlerFunc("POST", "/admin/users/:id/restore", app.RestoreUserHandler)
+	router.HandlerFunc("GET", "/admin/audit", app.ListAuditHandler)
+	router.HandlerFunc("GET", "/admin/auth-events", app.ListAuthEventsHandler)
+	if app.TestMode {
+		router.HandlerFunc("POST", "/getjwt", app.GetJWTHandler)
+	}
 	router.HandlerFunc("GET", "/verifyjwt", app.VerifyJWTHandler)
+	router.HandlerFunc("GET", "/.well-known/jwks.json", app.JWKSHandler)
 
 	return app.enableCORS(router)
 }
@@ -0,0 +1,63 @@
+package mailer
+
+import (
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FileMailer writes every message as an .eml file into Dir instead of
+// delivering it, so local and CI runs can inspect what would have been sent.
+type FileMailer struct {
+	Dir  string
+	From mail.Address
+}
+
+// NewFileMailer returns a FileMailer using the default sender address.
+func NewFileMailer(dir string) *FileMailer {
+	cfg := ConfigFromEnv()
+	return &FileMailer{Dir: dir, From: mail.Address{Name: cfg.FromName, Address: cfg.FromAddress}}
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	now := time.Now()
+	body, err := buildMIME(m.From, msg, now)
+	if err != nil {
+		return fmt.Errorf("FileMailer: %w", err)
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return fmt.Errorf("FileMailer (creating dir): %w", err)
+	}
+	suffix, err := randomHex(4)
+	if err != nil {
+		return fmt.Errorf("FileMailer: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), suffix)
+	if err := os.WriteFile(filepath.Join(m.Dir, name), body, 0o644); err != nil {
+		return fmt.Errorf("FileMailer (writing file): %w", err)
+	}
+	return nil
+}
+
+// Messages returns the paths of all .eml files in Dir, oldest first.
+func (m *FileMailer) Messages() ([]string, error) {
+	entries, err := os.ReadDir(m.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("FileMailer (reading dir): %w", err)
+	}
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".eml") {
+			paths = append(paths, filepath.Join(m.Dir, entry.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
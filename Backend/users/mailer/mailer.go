@@ -0,0 +1,150 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+)
+
+// Message is a single transactional email with a plain-text and an HTML body.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers transactional email. UserModel only depends on this
+// interface so sign-up and reset flows can run without a live provider.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Config selects and configures a Mailer backend.
+type Config struct {
+	Backend     string // "sendgrid", "smtp" or "file"
+	FromName    string
+	FromAddress string
+
+	SendGridAPIKey string
+
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+
+	DropDir string
+}
+
+// ConfigFromEnv reads the mailer configuration from environment variables.
+// MAILER_BACKEND defaults to "sendgrid" to match the production setup.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Backend:        strings.ToLower(strings.TrimSpace(os.Getenv("MAILER_BACKEND"))),
+		FromName:       os.Getenv("MAIL_FROM_NAME"),
+		FromAddress:    os.Getenv("MAIL_FROM_ADDRESS"),
+		SendGridAPIKey: os.Getenv("SENDGRID_API_KEY"),
+		SMTPHost:       os.Getenv("SMTP_HOST"),
+		SMTPPort:       os.Getenv("SMTP_PORT"),
+		SMTPUsername:   os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:   os.Getenv("SMTP_PASSWORD"),
+		DropDir:        os.Getenv("MAIL_DROP_DIR"),
+	}
+	if cfg.Backend == "" {
+		cfg.Backend = "sendgrid"
+	}
+	if cfg.FromName == "" {
+		cfg.FromName = "UniBazaar Support"
+	}
+	if cfg.FromAddress == "" {
+		cfg.FromAddress = "unibazaar.marketplace@gmail.com"
+	}
+	if cfg.SMTPPort == "" {
+		cfg.SMTPPort = "25"
+	}
+	return cfg
+}
+
+// New builds the Mailer selected by cfg.Backend.
+func New(cfg Config) (Mailer, error) {
+	from := mail.Address{Name: cfg.FromName, Address: cfg.FromAddress}
+	switch cfg.Backend {
+	case "sendgrid":
+		if cfg.SendGridAPIKey == "" {
+			return nil, fmt.Errorf("mailer: SENDGRID_API_KEY is required for the sendgrid backend")
+		}
+		return &SendGridMailer{APIKey: cfg.SendGridAPIKey, From: from}, nil
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("mailer: SMTP_HOST is required for the smtp backend")
+		}
+		return &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     from,
+		}, nil
+	case "file":
+		if cfg.DropDir == "" {
+			return nil, fmt.Errorf("mailer: MAIL_DROP_DIR is required for the file backend")
+		}
+		return &FileMailer{Dir: cfg.DropDir, From: from}, nil
+	default:
+		return nil, fmt.Errorf("mailer: unknown backend %q", cfg.Backend)
+	}
+}
+
+// buildMIME renders msg as an RFC 5322 multipart/alternative message.
+func buildMIME(from mail.Address, msg Message, now time.Time) ([]byte, error) {
+	boundary, err := randomHex(12)
+	if err != nil {
+		return nil, fmt.Errorf("buildMIME (boundary): %w", err)
+	}
+	to := mail.Address{Address: msg.To}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain", msg.Text},
+		{"text/html", msg.HTML},
+	}
+	for _, part := range parts {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s; charset=\"utf-8\"\r\n", part.contentType)
+		fmt.Fprintf(&buf, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		qp := quotedprintable.NewWriter(&buf)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, fmt.Errorf("buildMIME (encoding body): %w", err)
+		}
+		if err := qp.Close(); err != nil {
+			return nil, fmt.Errorf("buildMIME (encoding body): %w", err)
+		}
+		fmt.Fprintf(&buf, "\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes(), nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"net/mail"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildMIME(t *testing.T) {
+	from := mail.Address{Name: "UniBazaar Support", Address: "support@example.com"}
+	msg := Message{To: "ellie@ufl.edu", Subject: "Hello", Text: "plain body", HTML: "<b>html body</b>"}
+
+	raw, err := buildMIME(from, msg, time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello", parsed.Header.Get("Subject"))
+	assert.Equal(t, "<ellie@ufl.edu>", parsed.Header.Get("To"))
+	assert.Contains(t, parsed.Header.Get("Content-Type"), "multipart/alternative")
+	assert.Contains(t, string(raw), "plain body")
+	assert.Contains(t, string(raw), "<b>html body</b>")
+}
+
+func TestFileMailerWritesEML(t *testing.T) {
+	dir := t.TempDir()
+	m := NewFileMailer(dir)
+
+	assert.NoError(t, m.Send(Message{To: "joel@ufl.edu", Subject: "First", Text: "one"}))
+	assert.NoError(t, m.Send(Message{To: "joel@ufl.edu", Subject: "Second", Text: "two"}))
+
+	paths, err := m.Messages()
+	assert.NoError(t, err)
+	assert.Len(t, paths, 2)
+
+	raw, err := os.ReadFile(paths[1])
+	assert.NoError(t, err)
+	assert.Contains(t, string(raw), "Subject: Second")
+}
+
+func TestNewSelectsBackend(t *testing.T) {
+	m, err := New(Config{Backend: "file", DropDir: t.TempDir()})
+	assert.NoError(t, err)
+	assert.IsType(t, &FileMailer{}, m)
+
+	m, err = New(Config{Backend: "smtp", SMTPHost: "localhost", SMTPPort: "1025"})
+	assert.NoError(t, err)
+	assert.IsType(t, &SMTPMailer{}, m)
+
+	_, err = New(Config{Backend: "sendgrid"})
+	assert.Error(t, err)
+
+	_, err = New(Config{Backend: "carrier-pigeon"})
+	assert.Error(t, err)
+}
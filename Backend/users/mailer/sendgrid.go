@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/mail"
+
+	"github.com/sendgrid/sendgrid-go"
+	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// SendGridMailer sends email through the SendGrid v3 API.
+type SendGridMailer struct {
+	APIKey string
+	From   mail.Address
+}
+
+func (m *SendGridMailer) Send(msg Message) error {
+	from := sgmail.NewEmail(m.From.Name, m.From.Address)
+	to := sgmail.NewEmail("User", msg.To)
+	message := sgmail.NewSingleEmail(from, msg.Subject, to, msg.Text, msg.HTML)
+
+	client := sendgrid.NewSendClient(m.APIKey)
+	response, err := client.Send(message)
+	if err != nil {
+		log.Println("Failed to send email:", err)
+		return fmt.Errorf("SendGridMailer: %w", err)
+	}
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("SendGridMailer: unexpected status %d", response.StatusCode)
+	}
+	log.Printf("Email sent. Status Code: %d\n", response.StatusCode)
+	return nil
+}
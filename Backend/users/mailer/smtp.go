@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+// SMTPMailer sends email through a plain SMTP relay such as MailHog or
+// Mailpit. Authentication is only attempted when Username is set.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     mail.Address
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	body, err := buildMIME(m.From, msg, time.Now())
+	if err != nil {
+		return fmt.Errorf("SMTPMailer: %w", err)
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	addr := net.JoinHostPort(m.Host, m.Port)
+	if err := smtp.SendMail(addr, auth, m.From.Address, []string{msg.To}, body); err != nil {
+		return fmt.Errorf("SMTPMailer: %w", err)
+	}
+	return nil
+}
@@ -1,35 +1,115 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+	"users/config"
+	"users/migrations"
+	"users/models"
 	"users/server"
 
 	"github.com/joho/godotenv"
 )
 
-type User2 struct {
-	FirstName string
-	LastName  string
-	Email     string
-	Password  string
+func main() {
+
+	err := godotenv.Load()
+	if err != nil {
+		fmt.Println(err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "argon2-benchmark" {
+		runArgon2Benchmark(os.Args[2:])
+		return
+	}
+	server.InitServer()
 }
 
-func CreateUser(firstName string, lastName string, email string, password string) *User2 {
-	user := User2{
-		FirstName: firstName,
-		LastName:  lastName,
-		Email:     email,
-		Password:  password,
+// runMigrate implements `users migrate up|down [n]|status`.
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		log.Fatal("usage: users migrate up|down [n]|status")
+	}
+	conn := config.Connect(os.Getenv("DSN"))
+	if conn == nil {
+		log.Fatal("could not connect to database, check DSN")
+	}
+	db, err := conn.DB()
+	if err != nil {
+		log.Fatal(err)
+	}
+	m, err := migrations.New(db)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	return &user
+	switch args[0] {
+	case "up":
+		applied, err := m.Up()
+		for _, mig := range applied {
+			fmt.Printf("applied %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				log.Fatalf("invalid step count %q", args[1])
+			}
+		}
+		reverted, err := m.Down(steps)
+		for _, mig := range reverted {
+			fmt.Printf("reverted %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		status, err := m.Status()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-24s %s\n", s.Version, s.Name, applied)
+		}
+	default:
+		log.Fatalf("unknown migrate command %q, expected up, down or status", args[0])
+	}
 }
 
-func main() {
+// runArgon2Benchmark implements `users argon2-benchmark [-target d]
+// [-parallelism n] [-max-memory MiB]`: it times password hashing on this host
+// and prints the ARGON2_* settings that fit the target login latency.
+func runArgon2Benchmark(args []string) {
+	flags := flag.NewFlagSet("argon2-benchmark", flag.ExitOnError)
+	target := flags.Duration("target", 500*time.Millisecond, "longest a password hash may take")
+	parallelism := flags.Uint("parallelism", uint(models.DefaultPasswordParams.Parallelism), "lanes per hash")
+	maxMemory := flags.Uint("max-memory", 1024, "largest memory to try, in MiB")
+	_ = flags.Parse(args)
+	if *parallelism < 1 || *parallelism > 255 {
+		log.Fatalf("invalid parallelism %d", *parallelism)
+	}
 
-	err := godotenv.Load()
-	if err != nil {
-		fmt.Println(err)
+	recommended, results := models.BenchmarkPasswordParams(*target, uint8(*parallelism), uint32(*maxMemory)*1024)
+	for _, r := range results {
+		fmt.Printf("memory %4d MiB  iterations %2d  %v\n", r.Params.Memory/1024, r.Params.Iterations, r.Duration.Round(time.Millisecond))
 	}
-	server.InitServer()
+	if len(results) == 0 {
+		fmt.Printf("no setting with at least 64 MiB hashes within %v on this host\n", *target)
+	}
+	fmt.Printf("ARGON2_MEMORY_KIB=%d\nARGON2_ITERATIONS=%d\nARGON2_PARALLELISM=%d\n",
+		recommended.Memory, recommended.Iterations, recommended.Parallelism)
 }
@@ -0,0 +1,104 @@
+package migrations
+
+import (
+	"database/sql"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/glebarez/go-sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMigrator(t *testing.T, fsys fstest.MapFS) *Migrator {
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	list, err := Load(fsys)
+	require.NoError(t, err)
+	return &Migrator{DB: db, Migrations: list}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	m, err := New(nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, m.Migrations)
+	for i, mig := range m.Migrations {
+		assert.Equal(t, i+1, mig.Version, "migration versions must be contiguous")
+		assert.NotEmpty(t, mig.Name)
+	}
+	assert.Equal(t, "baseline", m.Migrations[0].Name)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	_, err := Load(fstest.MapFS{"0001_a.up.sql": {Data: []byte("SELECT 1;")}})
+	assert.Error(t, err, "missing down file")
+
+	_, err = Load(fstest.MapFS{"first.up.sql": {Data: []byte("SELECT 1;")}})
+	assert.Error(t, err, "missing version")
+
+	_, err = Load(fstest.MapFS{
+		"0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+		"0001_b.down.sql": {Data: []byte("SELECT 1;")},
+	})
+	assert.Error(t, err, "version reused by another name")
+}
+
+func TestMigrator_UpDownStatus(t *testing.T) {
+	m := testMigrator(t, fstest.MapFS{
+		"0001_widgets.up.sql":   {Data: []byte("CREATE TABLE widgets (id INTEGER PRIMARY KEY);")},
+		"0001_widgets.down.sql": {Data: []byte("DROP TABLE widgets;")},
+		"0002_colour.up.sql":    {Data: []byte("ALTER TABLE widgets ADD COLUMN colour TEXT;")},
+		"0002_colour.down.sql":  {Data: []byte("ALTER TABLE widgets DROP COLUMN colour;")},
+		"README.md":             {Data: []byte("ignored")},
+		"0003_gadgets.up.sql":   {Data: []byte("CREATE TABLE gadgets (id INTEGER PRIMARY KEY);")},
+		"0003_gadgets.down.sql": {Data: []byte("DROP TABLE gadgets;")},
+	})
+
+	applied, err := m.Up()
+	require.NoError(t, err)
+	assert.Len(t, applied, 3)
+	_, err = m.DB.Exec(`INSERT INTO widgets (id, colour) VALUES (1, 'red')`)
+	assert.NoError(t, err)
+
+	applied, err = m.Up()
+	require.NoError(t, err)
+	assert.Empty(t, applied, "Up is idempotent")
+
+	reverted, err := m.Down(2)
+	require.NoError(t, err)
+	require.Len(t, reverted, 2)
+	assert.Equal(t, 3, reverted[0].Version)
+	assert.Equal(t, 2, reverted[1].Version)
+	_, err = m.DB.Exec(`INSERT INTO gadgets (id) VALUES (1)`)
+	assert.Error(t, err)
+
+	status, err := m.Status()
+	require.NoError(t, err)
+	require.Len(t, status, 3)
+	assert.NotNil(t, status[0].AppliedAt)
+	assert.Nil(t, status[1].AppliedAt)
+	assert.Nil(t, status[2].AppliedAt)
+}
+
+func TestMigrator_FailedMigrationRollsBack(t *testing.T) {
+	m := testMigrator(t, fstest.MapFS{
+		"0001_ok.up.sql":    {Data: []byte("CREATE TABLE ok (id INTEGER);")},
+		"0001_ok.down.sql":  {Data: []byte("DROP TABLE ok;")},
+		"0002_bad.up.sql":   {Data: []byte("CREATE TABLE half (id INTEGER); NOT VALID SQL;")},
+		"0002_bad.down.sql": {Data: []byte("DROP TABLE half;")},
+	})
+
+	applied, err := m.Up()
+	assert.Error(t, err)
+	assert.Len(t, applied, 1)
+
+	_, err = m.DB.Exec(`SELECT * FROM half`)
+	assert.Error(t, err, "a failed migration must not leave partial changes")
+
+	status, err := m.Status()
+	require.NoError(t, err)
+	assert.NotNil(t, status[0].AppliedAt)
+	assert.Nil(t, status[1].AppliedAt)
+}
@@ -0,0 +1,12 @@
+-- The users table as it existed before migrations were introduced. IF NOT
+-- EXISTS lets this run against databases created before this file.
+CREATE TABLE IF NOT EXISTS users (
+    userid                BIGSERIAL PRIMARY KEY,
+    name                  TEXT,
+    email                 TEXT,
+    password              TEXT,
+    otp_code              TEXT,
+    failed_reset_attempts BIGINT,
+    verified              BOOLEAN,
+    phone                 TEXT
+);
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS otp_code TEXT;
+DROP TABLE IF EXISTS otps;
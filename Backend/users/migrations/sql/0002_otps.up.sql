@@ -0,0 +1,12 @@
+-- One-time codes are stored hashed, one row per user and purpose.
+CREATE TABLE IF NOT EXISTS otps (
+    id        BIGSERIAL PRIMARY KEY,
+    userid    BIGINT NOT NULL,
+    purpose   TEXT NOT NULL,
+    code_hash TEXT NOT NULL,
+    issued_at TIMESTAMPTZ NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_otps_user_purpose ON otps (userid, purpose);
+
+-- Plaintext codes are no longer kept on the user row.
+ALTER TABLE users DROP COLUMN IF EXISTS otp_code;
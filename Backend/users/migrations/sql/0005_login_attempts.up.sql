@@ -0,0 +1,9 @@
+-- Failed login counters, keyed by "email:<address>" or "ip:<address>".
+CREATE TABLE IF NOT EXISTS login_attempts (
+    throttle_key    TEXT PRIMARY KEY,
+    failures        BIGINT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    locked_until    TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_last_failure_at ON login_attempts (last_failure_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_locked_until ON login_attempts (locked_until);
@@ -0,0 +1,10 @@
+-- Account lifecycle. Existing rows get a status derived from verified.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_users_status ON users (status);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+UPDATE users SET status = CASE WHEN verified THEN 'active' ELSE 'pending' END
+WHERE status IS NULL OR status = '';
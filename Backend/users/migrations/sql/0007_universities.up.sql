@@ -0,0 +1,11 @@
+-- The university registry. Rows are seeded by the service on first start.
+CREATE TABLE IF NOT EXISTS universities (
+    id         BIGSERIAL PRIMARY KEY,
+    domain     TEXT NOT NULL,
+    name       TEXT NOT NULL,
+    campuses   TEXT,
+    enabled    BOOLEAN NOT NULL,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_universities_domain ON universities (domain);
@@ -0,0 +1,10 @@
+-- User IDs are assigned by the users_userid_seq sequence instead of the
+-- sign-up request. IDs chosen by clients may be ahead of the sequence.
+SELECT setval(pg_get_serial_sequence('users', 'userid'), COALESCE(MAX(userid), 0) + 1, false) FROM users;
+
+-- A random public ID for every account (gen_random_uuid needs PostgreSQL 13+).
+ALTER TABLE users ADD COLUMN IF NOT EXISTS public_id UUID;
+UPDATE users SET public_id = gen_random_uuid() WHERE public_id IS NULL;
+ALTER TABLE users ALTER COLUMN public_id SET DEFAULT gen_random_uuid();
+ALTER TABLE users ALTER COLUMN public_id SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_public_id ON users (public_id);
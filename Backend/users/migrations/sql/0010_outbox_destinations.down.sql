@@ -0,0 +1,4 @@
+DELETE FROM outbox_events WHERE destination <> 'messaging';
+DROP INDEX IF EXISTS idx_outbox_events_destination_event;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_outbox_events_event_id ON outbox_events (event_id);
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS destination;
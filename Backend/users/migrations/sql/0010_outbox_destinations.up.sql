@@ -0,0 +1,6 @@
+-- Every user event is queued once per receiving service. Events queued before
+-- this migration were meant for the messaging service.
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS destination TEXT NOT NULL DEFAULT 'messaging';
+ALTER TABLE outbox_events ALTER COLUMN destination DROP DEFAULT;
+DROP INDEX IF EXISTS idx_outbox_events_event_id;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_outbox_events_destination_event ON outbox_events (event_id, destination);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS revoked_subjects;
+ALTER TABLE users DROP COLUMN IF EXISTS pending_email;
@@ -0,0 +1,11 @@
+-- The address a user asked to move to, kept until the emailed code confirms it.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email TEXT;
+
+-- Revokes every access token of a subject issued up to issued_before, e.g.
+-- after an email change. Rows can be pruned once expires_at has passed.
+CREATE TABLE IF NOT EXISTS revoked_subjects (
+    subject       TEXT PRIMARY KEY,
+    issued_before TIMESTAMPTZ NOT NULL,
+    expires_at    TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_subjects_expires_at ON revoked_subjects (expires_at);
@@ -0,0 +1,2 @@
+-- Set once the number received and returned an SMS code; cleared when it changes.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_verified BOOLEAN NOT NULL DEFAULT FALSE;
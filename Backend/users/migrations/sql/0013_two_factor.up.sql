@@ -0,0 +1,26 @@
+-- TOTP two-factor authentication. totp_secret is set by enrollment and only
+-- used for logins once totp_enabled; totp_last_step stops code replays.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id         BIGSERIAL PRIMARY KEY,
+    userid     BIGINT NOT NULL,
+    code_hash  TEXT NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_userid ON recovery_codes (userid);
+
+-- Password logins waiting for their second factor.
+CREATE TABLE IF NOT EXISTS login_challenges (
+    id         BIGSERIAL PRIMARY KEY,
+    userid     BIGINT NOT NULL,
+    token_hash TEXT NOT NULL,
+    attempts   BIGINT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_login_challenges_token_hash ON login_challenges (token_hash);
+CREATE INDEX IF NOT EXISTS idx_login_challenges_userid ON login_challenges (userid);
+CREATE INDEX IF NOT EXISTS idx_login_challenges_expires_at ON login_challenges (expires_at);
@@ -0,0 +1,30 @@
+-- WebAuthn credentials. Authenticators know the user by public_id.
+CREATE TABLE IF NOT EXISTS passkeys (
+    id               BIGSERIAL PRIMARY KEY,
+    userid           BIGINT NOT NULL,
+    credential_id    BYTEA NOT NULL,
+    public_key       BYTEA NOT NULL,
+    attestation_type TEXT,
+    transports       TEXT,
+    aaguid           BYTEA,
+    sign_count       BIGINT NOT NULL DEFAULT 0,
+    backup_eligible  BOOLEAN NOT NULL DEFAULT FALSE,
+    backup_state     BOOLEAN NOT NULL DEFAULT FALSE,
+    name             TEXT,
+    created_at       TIMESTAMPTZ,
+    last_used_at     TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_passkeys_credential_id ON passkeys (credential_id);
+CREATE INDEX IF NOT EXISTS idx_passkeys_userid ON passkeys (userid);
+
+-- Session data of registration and login ceremonies between begin and finish.
+CREATE TABLE IF NOT EXISTS passkey_ceremonies (
+    id         BIGSERIAL PRIMARY KEY,
+    token_hash TEXT NOT NULL,
+    kind       TEXT NOT NULL,
+    userid     BIGINT,
+    data       TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_passkey_ceremonies_token_hash ON passkey_ceremonies (token_hash);
+CREATE INDEX IF NOT EXISTS idx_passkey_ceremonies_expires_at ON passkey_ceremonies (expires_at);
@@ -0,0 +1,11 @@
+-- One row per refresh token family: where and when the user signed in.
+CREATE TABLE IF NOT EXISTS sessions (
+    id           TEXT PRIMARY KEY,
+    userid       BIGINT NOT NULL,
+    device       TEXT,
+    user_agent   TEXT,
+    ip           TEXT,
+    created_at   TIMESTAMPTZ NOT NULL,
+    last_seen_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_userid ON sessions (userid);
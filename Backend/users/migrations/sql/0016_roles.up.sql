@@ -0,0 +1,2 @@
+-- Roles: student (everyone), moderator, admin.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'student';
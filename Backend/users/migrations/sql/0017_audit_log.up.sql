@@ -0,0 +1,13 @@
+-- Admin actions on user accounts. Rows are only ever inserted.
+CREATE TABLE IF NOT EXISTS audit_entries (
+    id         BIGSERIAL PRIMARY KEY,
+    actor_id   BIGINT NOT NULL,
+    action     TEXT NOT NULL,
+    target_id  BIGINT NOT NULL,
+    details    TEXT,
+    ip         TEXT,
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_actor_id ON audit_entries (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_target_id ON audit_entries (target_id);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_created_at ON audit_entries (created_at);
@@ -0,0 +1,20 @@
+-- Authentication events: logins, logouts, code failures, password resets and
+-- security alerts. The rules below make the table append-only.
+CREATE TABLE IF NOT EXISTS auth_events (
+    id         BIGSERIAL PRIMARY KEY,
+    type       TEXT NOT NULL,
+    userid     BIGINT,
+    email      TEXT,
+    ip         TEXT,
+    user_agent TEXT,
+    outcome    TEXT NOT NULL,
+    reason     TEXT,
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_auth_events_type ON auth_events (type);
+CREATE INDEX IF NOT EXISTS idx_auth_events_userid ON auth_events (userid);
+CREATE INDEX IF NOT EXISTS idx_auth_events_email ON auth_events (email);
+CREATE INDEX IF NOT EXISTS idx_auth_events_created_at ON auth_events (created_at);
+
+CREATE OR REPLACE RULE auth_events_no_update AS ON UPDATE TO auth_events DO INSTEAD NOTHING;
+CREATE OR REPLACE RULE auth_events_no_delete AS ON DELETE TO auth_events DO INSTEAD NOTHING;
@@ -0,0 +1,3 @@
+-- Set when a login finds the password in the breached-password corpus, so the
+-- user is asked to change it; cleared when the password changes.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_breached BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,20 @@
+-- Sign-ups only counted matching emails before inserting, so two racing
+-- requests could both create an account. Keep one live account per address,
+-- compared case-insensitively: the verified one if any, else the oldest. The
+-- others are soft-deleted like any deleted account.
+UPDATE users SET status = 'deleted', deleted_at = NOW()
+WHERE userid IN (
+    SELECT userid FROM (
+        SELECT userid, ROW_NUMBER() OVER (
+            PARTITION BY lower(email)
+            ORDER BY COALESCE(verified, FALSE) DESC, userid
+        ) AS position
+        FROM users
+        WHERE deleted_at IS NULL AND email IS NOT NULL
+    ) ranked
+    WHERE position > 1
+);
+
+-- Deleted accounts keep their address so they can be restored; only live
+-- accounts must have distinct ones.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (lower(email)) WHERE deleted_at IS NULL;
@@ -0,0 +1,3 @@
+-- Set while a relay is delivering an event, so relays on other replicas skip
+-- it; an event whose relay died becomes claimable again once it has passed.
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ;
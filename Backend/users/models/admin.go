@@ -0,0 +1,261 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAlreadyVerified = errors.New("account is already verified")
+	ErrNotDeleted      = errors.New("account is not deleted")
+)
+
+// UserFilter narrows UserModel.Search. Zero fields match everything.
+type UserFilter struct {
+	// Query matches part of the name or email, ignoring case.
+	Query    string
+	Verified *bool
+	// EmailDomain matches addresses at the domain or one of its subdomains,
+	// which is how accounts belong to a university.
+	EmailDomain   string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Deleted lists soft-deleted accounts instead of live ones.
+	Deleted bool
+	Page    int
+	PerPage int
+}
+
+// escapeLike quotes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Search returns one page of the users matching filter, newest first, and how
+// many match in total. Page counts from 1.
+func (e UserModel) Search(filter UserFilter) ([]User, int64, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PerPage < 1 {
+		filter.PerPage = 50
+	}
+	query := e.DB.Model(&User{})
+	if filter.Deleted {
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	if q := strings.ToLower(strings.TrimSpace(filter.Query)); q != "" {
+		pattern := "%" + escapeLike(q) + "%"
+		query = query.Where(`(LOWER(name) LIKE ? ESCAPE '\' OR LOWER(email) LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+	if filter.Verified != nil {
+		query = query.Where("verified = ?", *filter.Verified)
+	}
+	if domain := strings.ToLower(filter.EmailDomain); domain != "" {
+		query = query.Where(`(LOWER(email) LIKE ? ESCAPE '\' OR LOWER(email) LIKE ? ESCAPE '\')`,
+			"%@"+escapeLike(domain), "%."+escapeLike(domain))
+	}
+	if filter.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		query = query.Where("created_at < ?", *filter.CreatedBefore)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("Search (counting): %w", err)
+	}
+	users := []User{}
+	err := query.Order("created_at DESC, userid DESC").
+		Offset((filter.Page - 1) * filter.PerPage).Limit(filter.PerPage).Find(&users).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("Search: %w", err)
+	}
+	return users, total, nil
+}
+
+// ReadAnyByID is ReadByID that also finds soft-deleted accounts.
+func (e UserModel) ReadAnyByID(id int) (*User, error) {
+	var user User
+	if err := e.DB.Unscoped().First(&user, id).Error; err != nil {
+		return nil, fmt.Errorf("ReadAnyByID: %w", err)
+	}
+	return &user, nil
+}
+
+// audited runs change in a transaction together with its audit entry.
+func (e UserModel) audited(actor AuditActor, action string, user *User, details string, change func(tx *gorm.DB) error) error {
+	return e.DB.Transaction(func(tx *gorm.DB) error {
+		if err := change(tx); err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, action, user, details)
+	})
+}
+
+// ForceVerify marks user's email as verified without a code and discards the
+// outstanding verification codes.
+func (e UserModel) ForceVerify(user *User, actor AuditActor) error {
+	if user.Verified {
+		return fmt.Errorf("ForceVerify: %w", ErrAlreadyVerified)
+	}
+	err := e.audited(actor, AuditVerify, user, "", func(tx *gorm.DB) error {
+		user.Verified, user.FailedResetAttempts = true, 0
+		if err := (UserModel{DB: tx}).UpdateVerificationStatus(user); err != nil {
+			return err
+		}
+		return UserModel{DB: tx}.RevokeOTP(user.UserID, PurposeEmailVerification)
+	})
+	if err != nil {
+		return fmt.Errorf("ForceVerify: %w", err)
+	}
+	return nil
+}
+
+// Lock locks user out until the given time. An existing lock is replaced.
+func (e UserModel) Lock(user *User, until time.Time, reason string, actor AuditActor) error {
+	details := "until " + until.UTC().Format(time.RFC3339)
+	if reason != "" {
+		details += ": " + reason
+	}
+	err := e.audited(actor, AuditLock, user, details, func(tx *gorm.DB) error {
+		if from := user.CurrentStatus(time.Now()); from != StatusLocked && !CanTransition(from, StatusLocked) {
+			return fmt.Errorf("%s -> %s: %w", from, StatusLocked, ErrInvalidStatusTransition)
+		}
+		user.Status, user.LockedUntil = StatusLocked, &until
+		return tx.Model(user).Updates(map[string]interface{}{
+			"status":       user.Status,
+			"locked_until": user.LockedUntil,
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("Lock: %w", err)
+	}
+	return nil
+}
+
+// Unlock lifts both an account lock and a login lockout of user.
+func (e UserModel) Unlock(user *User, actor AuditActor) error {
+	err := e.audited(actor, AuditUnlock, user, "", func(tx *gorm.DB) error {
+		if user.CurrentStatus(time.Now()) == StatusLocked {
+			user.Status = StatusPending
+			if user.Verified {
+				user.Status = StatusActive
+			}
+			user.LockedUntil = nil
+			if err := tx.Model(user).Updates(map[string]interface{}{
+				"status":       user.Status,
+				"locked_until": nil,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return LoginThrottle{DB: tx}.Unlock(user.Email)
+	})
+	if err != nil {
+		return fmt.Errorf("Unlock: %w", err)
+	}
+	return nil
+}
+
+// Deactivate suspends an active account until an admin reactivates it. Unlike
+// a lock it does not lift on its own.
+func (e UserModel) Deactivate(user *User, reason string, actor AuditActor) error {
+	err := e.audited(actor, AuditDeactivate, user, reason, func(tx *gorm.DB) error {
+		return UserModel{DB: tx}.SetStatus(user, StatusDeactivated)
+	})
+	if err != nil {
+		return fmt.Errorf("Deactivate: %w", err)
+	}
+	return nil
+}
+
+// Reactivate returns a deactivated account to active.
+func (e UserModel) Reactivate(user *User, actor AuditActor) error {
+	if from := user.CurrentStatus(time.Now()); from != StatusDeactivated {
+		return fmt.Errorf("Reactivate (%s -> %s): %w", from, StatusActive, ErrInvalidStatusTransition)
+	}
+	err := e.audited(actor, AuditReactivate, user, "", func(tx *gorm.DB) error {
+		return UserModel{DB: tx}.SetStatus(user, StatusActive)
+	})
+	if err != nil {
+		return fmt.Errorf("Reactivate: %w", err)
+	}
+	return nil
+}
+
+// ResetTwoFactor turns off two-factor authentication for a user who lost
+// their authenticator and recovery codes.
+func (e UserModel) ResetTwoFactor(user *User, actor AuditActor) error {
+	if !user.TOTPEnabled {
+		return fmt.Errorf("ResetTwoFactor: %w", ErrTwoFactorNotEnabled)
+	}
+	err := e.audited(actor, AuditResetTwoFactor, user, "", func(tx *gorm.DB) error {
+		return TwoFactorModel{DB: tx}.Disable(user)
+	})
+	if err != nil {
+		return fmt.Errorf("ResetTwoFactor: %w", err)
+	}
+	user.TOTPEnabled, user.TOTPSecret, user.TOTPLastStep = false, "", 0
+	return nil
+}
+
+// SoftDelete deletes user like Delete, keeping the row so it can be restored.
+func (e UserModel) SoftDelete(user *User, reason string, actor AuditActor) error {
+	err := e.audited(actor, AuditDelete, user, reason, func(tx *gorm.DB) error {
+		return deleteUser(tx, user)
+	})
+	if err != nil {
+		return fmt.Errorf("SoftDelete: %w", err)
+	}
+	return nil
+}
+
+func deleteUser(tx *gorm.DB, user *User) error {
+	if err := tx.Model(user).Update("status", StatusDeleted).Error; err != nil {
+		return err
+	}
+	if err := tx.Delete(user).Error; err != nil {
+		return err
+	}
+	return enqueueUserEvent(tx, EventUserDeleted, user)
+}
+
+// Restore brings back a soft-deleted account, unless another account has
+// taken its email since. The other services learn of it as a created user;
+// what they removed on deletion, such as listings, is not brought back.
+func (e UserModel) Restore(user *User, actor AuditActor) error {
+	if !user.DeletedAt.Valid {
+		return fmt.Errorf("Restore: %w", ErrNotDeleted)
+	}
+	err := e.audited(actor, AuditRestore, user, "", func(tx *gorm.DB) error {
+		var taken int64
+		if err := tx.Model(&User{}).Where("lower(email) = lower(?)", user.Email).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrEmailTaken
+		}
+		user.Status = StatusPending
+		if user.Verified {
+			user.Status = StatusActive
+		}
+		user.LockedUntil, user.DeletedAt = nil, gorm.DeletedAt{}
+		if err := tx.Unscoped().Model(user).Updates(map[string]interface{}{
+			"status":       user.Status,
+			"locked_until": nil,
+			"deleted_at":   nil,
+		}).Error; err != nil {
+			return emailTaken(err)
+		}
+		return enqueueUserEvent(tx, EventUserCreated, user)
+	})
+	if err != nil {
+		return fmt.Errorf("Restore: %w", err)
+	}
+	return nil
+}
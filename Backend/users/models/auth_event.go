@@ -0,0 +1,127 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Authentication event types recorded in the auth_events table.
+const (
+	AuthEventLogin                = "login"
+	AuthEventLoginTwoFactor       = "login.2fa"
+	AuthEventLoginPasskey         = "login.passkey"
+	AuthEventLockout              = "login.lockout"
+	AuthEventLogout               = "logout"
+	AuthEventTokenRefresh         = "token.refresh"
+	AuthEventEmailVerification    = "email.verify"
+	AuthEventEmailChange          = "email.change"
+	AuthEventPasswordResetRequest = "password.reset_request"
+	AuthEventPasswordReset        = "password.reset"
+	AuthEventSecurityAlert        = "security.alert"
+	AuthEventTwoFactorEnable      = "2fa.enable"
+	AuthEventTwoFactorDisable     = "2fa.disable"
+	AuthEventPasskeyAdd           = "passkey.add"
+	AuthEventPasskeyRemove        = "passkey.remove"
+	AuthEventSessionRevoke        = "session.revoke"
+	AuthEventAccountDelete        = "account.delete"
+)
+
+// Outcomes of an authentication event.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// AuthEvent is a row in the append-only auth_events table. UserID is nil for
+// attempts on accounts that do not exist; Email is then the address that was
+// tried.
+type AuthEvent struct {
+	ID        int64     `gorm:"primaryKey" json:"id"`
+	Type      string    `gorm:"not null;index" json:"type"`
+	UserID    *int      `gorm:"column:userid;index" json:"userid,omitempty"`
+	Email     string    `gorm:"index" json:"email,omitempty"`
+	IP        string    `gorm:"column:ip" json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Outcome   string    `gorm:"not null" json:"outcome"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `gorm:"not null;index" json:"created_at"`
+}
+
+// AuthEventFilter narrows AuthEventModel.List. Zero fields match everything;
+// Before pages backwards from an event ID.
+type AuthEventFilter struct {
+	UserID  int
+	Email   string
+	IP      string
+	Type    string
+	Outcome string
+	Since   *time.Time
+	Until   *time.Time
+	Before  int64
+	Limit   int
+}
+
+// AuthEventModel appends to and reads the auth_events table. It has no way to
+// change or remove an event.
+type AuthEventModel struct {
+	DB *gorm.DB
+}
+
+// Record appends event, stamping its time.
+func (m AuthEventModel) Record(event *AuthEvent) error {
+	event.CreatedAt = time.Now()
+	if err := m.DB.Create(event).Error; err != nil {
+		return fmt.Errorf("Record: %w", err)
+	}
+	return nil
+}
+
+// List returns matching events, newest first.
+func (m AuthEventModel) List(filter AuthEventFilter) ([]AuthEvent, error) {
+	query := m.DB.Order("id DESC").Limit(filter.Limit)
+	if filter.UserID > 0 {
+		query = query.Where("userid = ?", filter.UserID)
+	}
+	if filter.Email != "" {
+		query = query.Where("LOWER(email) = LOWER(?)", filter.Email)
+	}
+	if filter.IP != "" {
+		query = query.Where("ip = ?", filter.IP)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.Since != nil {
+		query = query.Where("created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("created_at < ?", *filter.Until)
+	}
+	if filter.Before > 0 {
+		query = query.Where("id < ?", filter.Before)
+	}
+	events := []AuthEvent{}
+	if err := query.Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("List: %w", err)
+	}
+	return events, nil
+}
+
+// recordSecurityAlert notes that user was sent a security alert, or that
+// sending it failed. The request that caused it is recorded separately.
+func (e UserModel) recordSecurityAlert(user *User, reason string, sendErr error) {
+	userID := user.UserID
+	event := AuthEvent{Type: AuthEventSecurityAlert, UserID: &userID, Email: user.Email, Outcome: OutcomeSuccess, Reason: reason}
+	if sendErr != nil {
+		event.Outcome = OutcomeFailure
+	}
+	if err := (AuthEventModel{DB: e.DB}).Record(&event); err != nil {
+		log.Println("failed to record security alert:", err)
+	}
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrBreachedPassword = errors.New("password appears in a known data breach; choose a different one")
+
+// BreachedPasswords reports whether a password is known from a data breach.
+type BreachedPasswords interface {
+	IsBreached(password string) (bool, error)
+}
+
+// BreachCorpus is an offline breached-password corpus in the Have I Been Pwned
+// range layout: the uppercase hex SHA-1 of each password is split into a
+// five-character prefix, which names the partition file PREFIX.txt, and the
+// remaining 35 characters, listed in that file as SUFFIX:COUNT lines. A lookup
+// only reads the partition of the password's prefix, so the corpus never has
+// to fit in memory. Missing partitions count as empty.
+type BreachCorpus struct {
+	Dir string
+}
+
+// OpenBreachCorpus checks that dir holds a corpus and returns it.
+func OpenBreachCorpus(dir string) (*BreachCorpus, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("OpenBreachCorpus: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("OpenBreachCorpus: %s is not a directory", dir)
+	}
+	return &BreachCorpus{Dir: dir}, nil
+}
+
+// IsBreached reports whether password's hash is listed in the corpus. Lines
+// with a count of 0 are the padding range files may carry and do not match.
+func (c BreachCorpus) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(c.Dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("IsBreached: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		candidate, count, _ := strings.Cut(line, ":")
+		if !strings.EqualFold(candidate, suffix) {
+			continue
+		}
+		if n, err := strconv.Atoi(count); err == nil && n == 0 {
+			return false, nil
+		}
+		return true, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("IsBreached: %w", err)
+	}
+	return false, nil
+}
+
+var (
+	breachedMu sync.RWMutex
+	breached   BreachedPasswords
+)
+
+// SetBreachedPasswords installs the corpus ValidatePassword and logins check
+// passwords against. nil turns the check off, which is the default.
+func SetBreachedPasswords(b BreachedPasswords) {
+	breachedMu.Lock()
+	defer breachedMu.Unlock()
+	breached = b
+}
+
+// IsBreachedPassword reports whether password is in the installed corpus. It
+// is always false when no corpus is installed.
+func IsBreachedPassword(password string) (bool, error) {
+	breachedMu.RLock()
+	b := breached
+	breachedMu.RUnlock()
+	if b == nil {
+		return false, nil
+	}
+	return b.IsBreached(password)
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeBreachCorpus writes a range file for each password into a new corpus
+// directory, listing it with count, after a padding line of count 0.
+func writeBreachCorpus(t *testing.T, count string, passwords ...string) string {
+	dir := t.TempDir()
+	for _, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+		lines := "00000000000000000000000000000000000:0\r\n" + strings.ToLower(hash[5:]) + ":" + count + "\r\n"
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(lines), 0o600))
+	}
+	return dir
+}
+
+func TestBreachCorpus(t *testing.T) {
+	_, err := OpenBreachCorpus(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+
+	corpus, err := OpenBreachCorpus(writeBreachCorpus(t, "42", "Tr0ub4dor&3-horse-staple"))
+	assert.NoError(t, err)
+	found, err := corpus.IsBreached("Tr0ub4dor&3-horse-staple")
+	assert.NoError(t, err)
+	assert.True(t, found, "suffixes match regardless of case and line endings")
+	found, err = corpus.IsBreached("Tr0ub4dor&3-horse-stable")
+	assert.NoError(t, err)
+	assert.False(t, found, "a missing partition is empty")
+
+	padded, err := OpenBreachCorpus(writeBreachCorpus(t, "0", "Tr0ub4dor&3-horse-staple"))
+	assert.NoError(t, err)
+	found, err = padded.IsBreached("Tr0ub4dor&3-horse-staple")
+	assert.NoError(t, err)
+	assert.False(t, found, "padding entries do not match")
+}
+
+func TestValidatePasswordRejectsBreached(t *testing.T) {
+	corpus, err := OpenBreachCorpus(writeBreachCorpus(t, "7", "Correct-Horse-Battery-42"))
+	assert.NoError(t, err)
+	assert.NoError(t, ValidatePassword("Correct-Horse-Battery-42"), "no corpus installed")
+
+	SetBreachedPasswords(corpus)
+	defer SetBreachedPasswords(nil)
+	assert.True(t, errors.Is(ValidatePassword("Correct-Horse-Battery-42"), ErrBreachedPassword))
+	assert.NoError(t, ValidatePassword("Correct-Horse-Battery-43"))
+}
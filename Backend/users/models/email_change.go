@@ -0,0 +1,119 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"users/mailer"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNoEmailChange        = errors.New("no email change is pending")
+	ErrSameEmail            = errors.New("new email is the same as the current one")
+	ErrEmailChangeCancelled = errors.New("too many wrong codes, the email change was cancelled")
+)
+
+// RequestEmailChange starts moving user to newEmail. A confirmation code is
+// sent to the new address and a notice to the current one; the email, which
+// is also the login, only changes once ConfirmEmailChange redeems the code.
+// A new request replaces one still pending.
+func (e UserModel) RequestEmailChange(user *User, newEmail string) error {
+	newEmail = strings.TrimSpace(newEmail)
+	if err := ValidateEduEmail(newEmail); err != nil {
+		return fmt.Errorf("RequestEmailChange: %w", err)
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		return fmt.Errorf("RequestEmailChange: %w", ErrSameEmail)
+	}
+	if err := e.checkEmailFree(e.DB, newEmail, user.UserID); err != nil {
+		return fmt.Errorf("RequestEmailChange: %w", err)
+	}
+	user.PendingEmail, user.FailedResetAttempts = newEmail, 0
+	if err := e.DB.Model(user).Updates(map[string]interface{}{
+		"pending_email":         user.PendingEmail,
+		"failed_reset_attempts": 0,
+	}).Error; err != nil {
+		return fmt.Errorf("RequestEmailChange (saving pending email): %w", err)
+	}
+	code, err := e.IssueOTP(user.UserID, PurposeEmailChange)
+	if err != nil {
+		return fmt.Errorf("RequestEmailChange (issuing OTP): %w", err)
+	}
+	if err := e.sendOTPEmail(newEmail, code, "Confirm your new UniBazaar email"); err != nil {
+		return fmt.Errorf("RequestEmailChange (sending code): %w", err)
+	}
+	if err := e.sendEmailChangeNotice(user.Email, newEmail); err != nil {
+		return fmt.Errorf("RequestEmailChange (sending notice): %w", err)
+	}
+	return nil
+}
+
+// ConfirmEmailChange redeems code and moves user to the pending email. Other
+// services are notified of the new address. After MaxFailedCodeAttempts wrong
+// codes the change is cancelled and ErrEmailChangeCancelled is returned.
+func (e UserModel) ConfirmEmailChange(user *User, code string) error {
+	if user.PendingEmail == "" {
+		return fmt.Errorf("ConfirmEmailChange: %w", ErrNoEmailChange)
+	}
+	if err := e.ConsumeOTP(user.UserID, PurposeEmailChange, code); err != nil {
+		if errors.Is(err, ErrOTPInvalid) {
+			if cancelled, recordErr := e.recordFailedProfileCode(user, PurposeEmailChange); recordErr != nil {
+				log.Println("failed to record wrong email change code:", recordErr)
+			} else if cancelled {
+				return fmt.Errorf("ConfirmEmailChange: %w", ErrEmailChangeCancelled)
+			}
+		}
+		return fmt.Errorf("ConfirmEmailChange: %w", err)
+	}
+	newEmail := user.PendingEmail
+	err := e.DB.Transaction(func(tx *gorm.DB) error {
+		// The address may have been registered since the change was requested.
+		if err := e.checkEmailFree(tx, newEmail, user.UserID); err != nil {
+			return err
+		}
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"email":                 newEmail,
+			"pending_email":         "",
+			"failed_reset_attempts": 0,
+		}).Error; err != nil {
+			return emailTaken(err)
+		}
+		user.Email, user.PendingEmail, user.FailedResetAttempts = newEmail, "", 0
+		return enqueueUserEvent(tx, EventUserUpdated, user)
+	})
+	if err != nil {
+		return fmt.Errorf("ConfirmEmailChange: %w", err)
+	}
+	return nil
+}
+
+// checkEmailFree returns ErrEmailTaken when an account other than userID uses email.
+func (e UserModel) checkEmailFree(db *gorm.DB, email string, userID int) error {
+	var existing int64
+	if err := db.Model(&User{}).Where("lower(email) = lower(?) AND userid <> ?", email, userID).Count(&existing).Error; err != nil {
+		return fmt.Errorf("checking email: %w", err)
+	}
+	if existing > 0 {
+		return ErrEmailTaken
+	}
+	return nil
+}
+
+// sendEmailChangeNotice tells the current address that a change to newEmail was requested.
+func (e UserModel) sendEmailChangeNotice(toEmail, newEmail string) error {
+	msg := mailer.Message{
+		To:      toEmail,
+		Subject: "UniBazaar Email Change Requested",
+		Text:    fmt.Sprintf("A request was made to change your UniBazaar email to %s.\nIf this wasn't you, please reset your password.", newEmail),
+		HTML:    fmt.Sprintf("A request was made to change your UniBazaar email to <strong>%s</strong>.<br>If this wasn't you, please reset your password.", html.EscapeString(newEmail)),
+	}
+	if err := e.Mailer.Send(msg); err != nil {
+		log.Println("Failed to send email:", err)
+		return fmt.Errorf("sendEmailChangeNotice: %w", err)
+	}
+	return nil
+}
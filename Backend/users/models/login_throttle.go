@@ -0,0 +1,185 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginAttempt is a row in the login_attempts table. Key is "email:<address>"
+// or "ip:<address>", so both kinds of counter share one table.
+type LoginAttempt struct {
+	Key           string     `gorm:"column:throttle_key;primaryKey"`
+	Failures      int        `gorm:"not null;default:0"`
+	LastFailureAt time.Time  `gorm:"not null;index"`
+	LockedUntil   *time.Time `gorm:"index"`
+}
+
+// ThrottlePolicy controls login backoff and lockout. After FreeAttempts
+// failures each further attempt must wait BaseDelay, doubling per failure up
+// to MaxDelay. Reaching a lockout threshold blocks the key for LockoutDuration.
+// Counters are forgotten ResetAfter the last failure.
+type ThrottlePolicy struct {
+	FreeAttempts      int
+	BaseDelay         time.Duration
+	MaxDelay          time.Duration
+	EmailLockoutAfter int
+	IPLockoutAfter    int
+	LockoutDuration   time.Duration
+	ResetAfter        time.Duration
+}
+
+var DefaultThrottlePolicy = ThrottlePolicy{
+	FreeAttempts:      3,
+	BaseDelay:         time.Second,
+	MaxDelay:          5 * time.Minute,
+	EmailLockoutAfter: 10,
+	IPLockoutAfter:    50,
+	LockoutDuration:   15 * time.Minute,
+	ResetAfter:        time.Hour,
+}
+
+// ThrottledError is returned by LoginThrottle.Check when a login must wait.
+type ThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *ThrottledError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("too many failed login attempts, locked for %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many failed login attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// LoginThrottle counts failed logins per email and per client IP in the
+// database so every replica sees the same counters.
+type LoginThrottle struct {
+	DB     *gorm.DB
+	Policy ThrottlePolicy
+}
+
+func emailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns a *ThrottledError if a login for email from ip must not be
+// attempted yet.
+func (t LoginThrottle) Check(email, ip string) error {
+	now := time.Now()
+	var rows []LoginAttempt
+	if err := t.DB.Where("throttle_key IN ?", []string{emailKey(email), ipKey(ip)}).Find(&rows).Error; err != nil {
+		return fmt.Errorf("Check: %w", err)
+	}
+	var worst *ThrottledError
+	for _, row := range rows {
+		if e := t.throttled(row, now); e != nil && (worst == nil || e.RetryAfter > worst.RetryAfter) {
+			worst = e
+		}
+	}
+	if worst != nil {
+		return worst
+	}
+	return nil
+}
+
+func (t LoginThrottle) throttled(row LoginAttempt, now time.Time) *ThrottledError {
+	if row.LockedUntil != nil && row.LockedUntil.After(now) {
+		return &ThrottledError{RetryAfter: row.LockedUntil.Sub(now), Locked: true}
+	}
+	if now.Sub(row.LastFailureAt) > t.Policy.ResetAfter || row.Failures < t.Policy.FreeAttempts {
+		return nil
+	}
+	delay := t.Policy.BaseDelay << (row.Failures - t.Policy.FreeAttempts)
+	if delay <= 0 || delay > t.Policy.MaxDelay {
+		delay = t.Policy.MaxDelay
+	}
+	if wait := row.LastFailureAt.Add(delay).Sub(now); wait > 0 {
+		return &ThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed login. It reports whether this failure locked
+// the email's account, so the caller can alert the owner exactly once even
+// when several replicas race.
+func (t LoginThrottle) RecordFailure(email, ip string) (bool, error) {
+	if _, err := t.increment(ipKey(ip), t.Policy.IPLockoutAfter); err != nil {
+		return false, fmt.Errorf("RecordFailure: %w", err)
+	}
+	locked, err := t.increment(emailKey(email), t.Policy.EmailLockoutAfter)
+	if err != nil {
+		return false, fmt.Errorf("RecordFailure: %w", err)
+	}
+	return locked, nil
+}
+
+func (t LoginThrottle) increment(key string, lockoutAfter int) (bool, error) {
+	now := time.Now()
+	staleBefore := now.Add(-t.Policy.ResetAfter)
+	err := t.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "throttle_key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"failures":        gorm.Expr("CASE WHEN login_attempts.last_failure_at < ? THEN 1 ELSE login_attempts.failures + 1 END", staleBefore),
+			"last_failure_at": now,
+		}),
+	}).Create(&LoginAttempt{Key: key, Failures: 1, LastFailureAt: now}).Error
+	if err != nil {
+		return false, err
+	}
+
+	res := t.DB.Model(&LoginAttempt{}).
+		Where("throttle_key = ? AND failures >= ? AND (locked_until IS NULL OR locked_until <= ?)", key, lockoutAfter, now).
+		Updates(map[string]interface{}{"locked_until": now.Add(t.Policy.LockoutDuration), "failures": 0})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// RecordSuccess clears the email's counter. The IP counter is left to decay so
+// that one valid account cannot be used to reset it.
+func (t LoginThrottle) RecordSuccess(email string) error {
+	if err := t.DB.Where("throttle_key = ?", emailKey(email)).Delete(&LoginAttempt{}).Error; err != nil {
+		return fmt.Errorf("RecordSuccess: %w", err)
+	}
+	return nil
+}
+
+// Unlock lifts a lockout on an email before it expires.
+func (t LoginThrottle) Unlock(email string) error {
+	if err := t.DB.Where("throttle_key = ?", emailKey(email)).Delete(&LoginAttempt{}).Error; err != nil {
+		return fmt.Errorf("Unlock: %w", err)
+	}
+	return nil
+}
+
+// State returns the failure counter of email, or nil when it has none.
+func (t LoginThrottle) State(email string) (*LoginAttempt, error) {
+	var rows []LoginAttempt
+	if err := t.DB.Where("throttle_key = ?", emailKey(email)).Limit(1).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("State: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+// Prune deletes counters that have decayed and are not locked.
+func (t LoginThrottle) Prune() (int64, error) {
+	now := time.Now()
+	res := t.DB.Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until <= ?)", now.Add(-t.Policy.ResetAfter), now).
+		Delete(&LoginAttempt{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("Prune: %w", res.Error)
+	}
+	return res.RowsAffected, nil
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func newTestThrottle(t *testing.T) LoginThrottle {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&LoginAttempt{}))
+	return LoginThrottle{DB: db, Policy: ThrottlePolicy{
+		FreeAttempts:      2,
+		BaseDelay:         time.Minute,
+		MaxDelay:          10 * time.Minute,
+		EmailLockoutAfter: 4,
+		IPLockoutAfter:    6,
+		LockoutDuration:   time.Hour,
+		ResetAfter:        24 * time.Hour,
+	}}
+}
+
+func TestLoginThrottleBackoffAndLockout(t *testing.T) {
+	throttle := newTestThrottle(t)
+	const ip = "10.0.0.1"
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, throttle.Check("ellie@ufl.edu", ip), "free attempts are not delayed")
+		locked, err := throttle.RecordFailure("Ellie@ufl.edu", ip)
+		assert.NoError(t, err)
+		assert.False(t, locked)
+	}
+
+	var throttled *ThrottledError
+	assert.True(t, errors.As(throttle.Check("ellie@ufl.edu", ip), &throttled))
+	assert.False(t, throttled.Locked)
+	assert.InDelta(t, time.Minute.Seconds(), throttled.RetryAfter.Seconds(), 2)
+
+	_, _ = throttle.RecordFailure("ellie@ufl.edu", ip)
+	assert.True(t, errors.As(throttle.Check("ellie@ufl.edu", ip), &throttled))
+	assert.InDelta(t, (2 * time.Minute).Seconds(), throttled.RetryAfter.Seconds(), 2, "delay doubles")
+
+	locked, err := throttle.RecordFailure("ellie@ufl.edu", ip)
+	assert.NoError(t, err)
+	assert.True(t, locked, "fourth failure locks the account")
+	assert.True(t, errors.As(throttle.Check("ellie@ufl.edu", "10.0.0.2"), &throttled))
+	assert.True(t, throttled.Locked, "lockout applies from any IP")
+
+	assert.NoError(t, throttle.Unlock("ellie@ufl.edu"))
+	assert.NoError(t, throttle.Check("ellie@ufl.edu", "10.0.0.2"))
+}
+
+func TestLoginThrottlePerIP(t *testing.T) {
+	throttle := newTestThrottle(t)
+	const ip = "10.0.0.9"
+
+	// Spraying many accounts from one IP eventually locks the IP.
+	for i, email := range []string{"a@ufl.edu", "b@ufl.edu", "c@ufl.edu", "d@ufl.edu", "e@ufl.edu", "f@ufl.edu"} {
+		locked, err := throttle.RecordFailure(email, ip)
+		assert.NoError(t, err)
+		assert.False(t, locked, "attempt %d", i)
+	}
+	var throttled *ThrottledError
+	assert.True(t, errors.As(throttle.Check("g@ufl.edu", ip), &throttled))
+	assert.True(t, throttled.Locked)
+	assert.NoError(t, throttle.Check("g@ufl.edu", "10.0.0.10"))
+
+	// A successful login clears the email counter but not the IP counter.
+	assert.NoError(t, throttle.RecordSuccess("a@ufl.edu"))
+	assert.Error(t, throttle.Check("a@ufl.edu", ip))
+}
+
+func TestLoginThrottleDecay(t *testing.T) {
+	throttle := newTestThrottle(t)
+	for i := 0; i < 3; i++ {
+		_, _ = throttle.RecordFailure("joel@ufl.edu", "10.0.0.3")
+	}
+	assert.Error(t, throttle.Check("joel@ufl.edu", "10.0.0.3"))
+
+	old := time.Now().Add(-25 * time.Hour)
+	throttle.DB.Model(&LoginAttempt{}).Where("1 = 1").Update("last_failure_at", old)
+	assert.NoError(t, throttle.Check("joel@ufl.edu", "10.0.0.3"))
+
+	// The next failure starts counting from one again.
+	_, _ = throttle.RecordFailure("joel@ufl.edu", "10.0.0.3")
+	var row LoginAttempt
+	assert.NoError(t, throttle.DB.First(&row, "throttle_key = ?", "email:joel@ufl.edu").Error)
+	assert.Equal(t, 1, row.Failures)
+
+	throttle.DB.Model(&LoginAttempt{}).Where("1 = 1").Update("last_failure_at", old)
+	removed, err := throttle.Prune()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), removed)
+}
@@ -1,15 +1,38 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"users/mailer"
+
+	"gorm.io/gorm"
+)
 
 type Models struct {
-	UserModel UserModel
-	//SessionModel SessionModel
+	UserModel        UserModel
+	RefreshTokens    RefreshTokenModel
+	TokenRevocations TokenRevocationStore
+	ServiceAccounts  ServiceAccounts
+	LoginThrottle    LoginThrottle
+	Universities     UniversityModel
+	Outbox           OutboxModel
+	TwoFactor        TwoFactorModel
+	Passkeys         PasskeyModel
+	SessionModel     SessionModel
+	AuditLog         AuditLogModel
+	AuthEvents       AuthEventModel
 }
 
-func NewModels(db *gorm.DB) Models {
+func NewModels(db *gorm.DB, m mailer.Mailer) Models {
 	return Models{
-		UserModel: UserModel{DB: db},
-		//SessionModel: SessionModel{db: db},
+		UserModel:        UserModel{DB: db, Mailer: m},
+		RefreshTokens:    RefreshTokenModel{DB: db},
+		TokenRevocations: PostgresRevocationStore{DB: db},
+		LoginThrottle:    LoginThrottle{DB: db, Policy: DefaultThrottlePolicy},
+		Universities:     NewUniversityModel(db),
+		Outbox:           OutboxModel{DB: db},
+		TwoFactor:        TwoFactorModel{DB: db},
+		Passkeys:         PasskeyModel{DB: db},
+		SessionModel:     SessionModel{DB: db},
+		AuditLog:         AuditLogModel{DB: db},
+		AuthEvents:       AuthEventModel{DB: db},
 	}
 }
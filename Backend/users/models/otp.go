@@ -0,0 +1,138 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alexedwards/argon2id"
+	"gorm.io/gorm"
+)
+
+// DefaultOTPTTL is how long an issued code stays valid when UserModel.OTPTTL is unset.
+const DefaultOTPTTL = 5 * time.Minute
+
+// OTPPurpose scopes a one-time code so that a code issued for one flow
+// cannot be redeemed in another.
+type OTPPurpose string
+
+const (
+	PurposeEmailVerification OTPPurpose = "email_verification"
+	PurposePasswordReset     OTPPurpose = "password_reset"
+	PurposeEmailChange       OTPPurpose = "email_change"
+	PurposePhoneVerification OTPPurpose = "phone_verification"
+)
+
+var (
+	ErrOTPInvalid = errors.New("invalid OTP code")
+	ErrOTPExpired = errors.New("OTP code expired")
+)
+
+// OTP is an outstanding one-time code. Only the argon2id hash of the code is
+// stored, and at most one code per user and purpose exists at a time.
+type OTP struct {
+	ID       uint       `gorm:"primaryKey"`
+	UserID   int        `gorm:"column:userid;not null;uniqueIndex:idx_otps_user_purpose"`
+	Purpose  OTPPurpose `gorm:"not null;uniqueIndex:idx_otps_user_purpose"`
+	CodeHash string     `gorm:"not null"`
+	IssuedAt time.Time  `gorm:"not null"`
+}
+
+func (e UserModel) otpTTL() time.Duration {
+	if e.OTPTTL <= 0 {
+		return DefaultOTPTTL
+	}
+	return e.OTPTTL
+}
+
+// IssueOTP generates a fresh code for the given purpose, replacing any code
+// still outstanding for it, and returns the plaintext code for delivery.
+func (e UserModel) IssueOTP(userID int, purpose OTPPurpose) (string, error) {
+	code := generateOTPCode()
+	p := PasswordParams()
+	hash, err := argon2id.CreateHash(code, &p)
+	if err != nil {
+		return "", fmt.Errorf("IssueOTP (hashing code): %w", err)
+	}
+	err = e.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("userid = ? AND purpose = ?", userID, purpose).Delete(&OTP{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OTP{UserID: userID, Purpose: purpose, CodeHash: hash, IssuedAt: time.Now()}).Error
+	})
+	if err != nil {
+		return "", fmt.Errorf("IssueOTP (saving code): %w", err)
+	}
+	return code, nil
+}
+
+// ConsumeOTP checks code against the outstanding code for purpose. A matching
+// code is deleted so it cannot be used twice; an expired code is deleted and
+// reported as ErrOTPExpired.
+func (e UserModel) ConsumeOTP(userID int, purpose OTPPurpose, code string) error {
+	var otp OTP
+	err := e.DB.Where("userid = ? AND purpose = ?", userID, purpose).First(&otp).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrOTPInvalid
+	}
+	if err != nil {
+		return fmt.Errorf("ConsumeOTP (finding code): %w", err)
+	}
+	if time.Since(otp.IssuedAt) > e.otpTTL() {
+		_ = e.DB.Delete(&otp).Error
+		return ErrOTPExpired
+	}
+	match, err := argon2id.ComparePasswordAndHash(code, otp.CodeHash)
+	if err != nil {
+		return fmt.Errorf("ConsumeOTP (comparing code): %w", err)
+	}
+	if !match {
+		return ErrOTPInvalid
+	}
+	// Delete with a row count check so two concurrent requests cannot both redeem it.
+	res := e.DB.Where("id = ?", otp.ID).Delete(&OTP{})
+	if res.Error != nil {
+		return fmt.Errorf("ConsumeOTP (invalidating code): %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrOTPInvalid
+	}
+	return nil
+}
+
+// RevokeOTP discards any outstanding code for purpose.
+func (e UserModel) RevokeOTP(userID int, purpose OTPPurpose) error {
+	if err := e.DB.Where("userid = ? AND purpose = ?", userID, purpose).Delete(&OTP{}).Error; err != nil {
+		return fmt.Errorf("RevokeOTP: %w", err)
+	}
+	return nil
+}
+
+// recordFailedProfileCode counts a wrong code for a change the signed-in user
+// asked for and, after MaxFailedCodeAttempts, revokes the code and drops a
+// pending email change. Unlike sign-up codes this does not lock the account:
+// the caller has already proven who they are. It reports whether the code was revoked.
+func (e UserModel) recordFailedProfileCode(user *User, purpose OTPPurpose) (bool, error) {
+	if err := e.countFailedCode(user); err != nil {
+		return false, fmt.Errorf("recordFailedProfileCode: %w", err)
+	}
+	if user.FailedResetAttempts < MaxFailedCodeAttempts {
+		return false, nil
+	}
+	changes := map[string]interface{}{"failed_reset_attempts": 0}
+	if purpose == PurposeEmailChange {
+		changes["pending_email"] = ""
+	}
+	if err := e.DB.Model(&User{}).Where("userid = ?", user.UserID).Updates(changes).Error; err != nil {
+		return false, fmt.Errorf("recordFailedProfileCode: %w", err)
+	}
+	user.FailedResetAttempts = 0
+	if purpose == PurposeEmailChange {
+		user.PendingEmail = ""
+	}
+	if err := e.RevokeOTP(user.UserID, purpose); err != nil {
+		return true, err
+	}
+	_ = e.sendSecurityAlert(user, string(purpose))
+	return true, nil
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Services that receive user events. Every event is queued once per destination
+// and each destination's relay tracks delivery of its own copy.
+const (
+	DestinationMessaging = "messaging"
+	DestinationProducts  = "products"
+)
+
+var EventDestinations = []string{DestinationMessaging, DestinationProducts}
+
+// User event types published to other services through the outbox.
+const (
+	EventUserCreated = "user.created"
+	EventUserUpdated = "user.updated"
+	EventUserDeleted = "user.deleted"
+)
+
+// OutboxEvent is a row in the outbox_events table. Events are written in the
+// same transaction as the change they describe and delivered later by a
+// relay, so a change is never published without being committed or lost
+// after it was.
+type OutboxEvent struct {
+	ID            int64      `gorm:"primaryKey"`
+	EventID       string     `gorm:"not null;uniqueIndex:idx_outbox_events_destination_event"`
+	Destination   string     `gorm:"not null;uniqueIndex:idx_outbox_events_destination_event"`
+	Type          string     `gorm:"not null"`
+	UserID        int        `gorm:"column:userid;not null;index"`
+	Payload       string     `gorm:"type:text;not null"`
+	CreatedAt     time.Time  `gorm:"not null"`
+	Attempts      int        `gorm:"not null;default:0"`
+	NextAttemptAt time.Time  `gorm:"not null;index"`
+	DeliveredAt   *time.Time `gorm:"index"`
+	LastError     string
+	// LockedUntil is set while a relay holds the event; see Claim.
+	LockedUntil *time.Time
+}
+
+// UserEvent is the payload of a user event. Version increases with every
+// event a destination receives, so consumers can ignore redelivered or stale events.
+type UserEvent struct {
+	EventID  string `json:"event_id"`
+	Type     string `json:"type"`
+	Version  int64  `json:"version"`
+	UserID   int    `json:"user_id"`
+	PublicID string `json:"public_id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Email    string `json:"email,omitempty"`
+	// PhoneVerified lets listings show a verified-phone badge for the seller.
+	PhoneVerified bool      `json:"phone_verified"`
+	OccurredAt    time.Time `json:"occurred_at"`
+}
+
+// Event decodes the payload, taking the version from the outbox row ID.
+func (o OutboxEvent) Event() (UserEvent, error) {
+	var ev UserEvent
+	if err := json.Unmarshal([]byte(o.Payload), &ev); err != nil {
+		return UserEvent{}, fmt.Errorf("Event (%s): %w", o.EventID, err)
+	}
+	ev.Version = o.ID
+	return ev, nil
+}
+
+// enqueueUserEvent records an event about user in tx. Deleted events carry no
+// profile data.
+func enqueueUserEvent(tx *gorm.DB, eventType string, user *User) error {
+	ev := UserEvent{
+		EventID:    uuid.NewString(),
+		Type:       eventType,
+		UserID:     user.UserID,
+		OccurredAt: time.Now().UTC(),
+	}
+	if eventType != EventUserDeleted {
+		ev.PublicID, ev.Name, ev.Email, ev.PhoneVerified = user.PublicID, user.Name, user.Email, user.PhoneVerified
+	}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	rows := make([]OutboxEvent, 0, len(EventDestinations))
+	for _, destination := range EventDestinations {
+		rows = append(rows, OutboxEvent{
+			EventID:       ev.EventID,
+			Destination:   destination,
+			Type:          eventType,
+			UserID:        user.UserID,
+			Payload:       string(payload),
+			CreatedAt:     ev.OccurredAt,
+			NextAttemptAt: ev.OccurredAt,
+		})
+	}
+	return tx.Create(&rows).Error
+}
+
+// OutboxModel reads and updates the delivery state of outbox events.
+type OutboxModel struct {
+	DB *gorm.DB
+}
+
+// Claim leases up to limit undelivered events for destination whose next
+// attempt is due, oldest first. Until lease has passed they are not returned
+// to another caller, so relays on several replicas never send the same event
+// at once; an event whose relay died is claimed again once its lease runs out.
+func (m OutboxModel) Claim(destination string, limit int, lease time.Duration) ([]OutboxEvent, error) {
+	now := time.Now()
+	const claimable = "destination = ? AND delivered_at IS NULL AND next_attempt_at <= ? AND (locked_until IS NULL OR locked_until <= ?)"
+	// The outer condition is checked again against the locked row, so of two
+	// relays racing for an event only the first one's update matches it.
+	var events []OutboxEvent
+	err := m.DB.Model(&events).Clauses(clause.Returning{}).
+		Where("id IN (?)", m.DB.Model(&OutboxEvent{}).Select("id").
+			Where(claimable, destination, now, now).Order("id").Limit(limit)).
+		Where(claimable, destination, now, now).
+		Update("locked_until", now.Add(lease)).Error
+	if err != nil {
+		return nil, fmt.Errorf("Claim: %w", err)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+func (m OutboxModel) MarkDelivered(id int64) error {
+	if err := m.DB.Model(&OutboxEvent{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"delivered_at": time.Now(),
+		"last_error":   "",
+		"locked_until": nil,
+	}).Error; err != nil {
+		return fmt.Errorf("MarkDelivered: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed records a failed delivery and schedules the next attempt after retryIn.
+func (m OutboxModel) MarkFailed(id int64, deliveryErr error, retryIn time.Duration) error {
+	if err := m.DB.Model(&OutboxEvent{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"next_attempt_at": time.Now().Add(retryIn),
+		"last_error":      deliveryErr.Error(),
+		"locked_until":    nil,
+	}).Error; err != nil {
+		return fmt.Errorf("MarkFailed: %w", err)
+	}
+	return nil
+}
+
+// Prune deletes events delivered more than olderThan ago.
+func (m OutboxModel) Prune(olderThan time.Duration) (int64, error) {
+	res := m.DB.Where("delivered_at < ?", time.Now().Add(-olderThan)).Delete(&OutboxEvent{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("Prune: %w", res.Error)
+	}
+	return res.RowsAffected, nil
+}
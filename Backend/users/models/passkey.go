@@ -0,0 +1,370 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/gorm"
+)
+
+// PasskeyCeremonyTTL is how long a registration or login ceremony may take.
+const PasskeyCeremonyTTL = 5 * time.Minute
+
+const (
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+)
+
+var (
+	ErrPasskeysUnavailable = errors.New("passkeys are not configured")
+	ErrNoPasskeys          = errors.New("no passkeys registered for this account")
+	ErrPasskeyExists       = errors.New("this passkey is already registered")
+	ErrPasskeyNotFound     = errors.New("passkey not found")
+	ErrPasskeyInvalid      = errors.New("passkey could not be verified")
+	ErrCeremonyInvalid     = errors.New("invalid or expired passkey session")
+)
+
+// Passkey is a WebAuthn credential registered by a user. The user handle
+// given to authenticators is the user's public ID, never the sequential userid.
+type Passkey struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	UserID          int        `gorm:"column:userid;not null;index" json:"-"`
+	CredentialID    []byte     `gorm:"not null;uniqueIndex" json:"-"`
+	PublicKey       []byte     `gorm:"not null" json:"-"`
+	AttestationType string     `json:"-"`
+	Transports      string     `json:"-"` // comma separated
+	AAGUID          []byte     `gorm:"column:aaguid" json:"-"`
+	SignCount       int64      `gorm:"not null;default:0" json:"-"`
+	BackupEligible  bool       `gorm:"not null;default:false" json:"-"`
+	BackupState     bool       `gorm:"not null;default:false" json:"-"`
+	Name            string     `json:"name"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastUsedAt      *time.Time `json:"last_used_at"`
+}
+
+// PasskeyCeremony keeps the WebAuthn session data between the begin and
+// finish requests of a ceremony. The opaque token handed to the client is
+// stored as a SHA-256 hash. UserID is nil for a login that lets the
+// authenticator pick the account.
+type PasskeyCeremony struct {
+	ID        uint      `gorm:"primaryKey"`
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	Kind      string    `gorm:"not null"`
+	UserID    *int      `gorm:"column:userid"`
+	Data      string    `gorm:"type:text;not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+// PasskeyModel runs WebAuthn ceremonies. A nil WebAuthn disables passkeys.
+type PasskeyModel struct {
+	DB       *gorm.DB
+	WebAuthn *webauthn.WebAuthn
+}
+
+// webauthnUser adapts a User and its passkeys to webauthn.User.
+type webauthnUser struct {
+	user        *User
+	credentials []webauthn.Credential
+}
+
+func (u webauthnUser) WebAuthnID() []byte                         { return []byte(u.user.PublicID) }
+func (u webauthnUser) WebAuthnName() string                       { return u.user.Email }
+func (u webauthnUser) WebAuthnDisplayName() string                { return u.user.Name }
+func (u webauthnUser) WebAuthnIcon() string                       { return "" }
+func (u webauthnUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+func (p Passkey) credential() webauthn.Credential {
+	var transports []protocol.AuthenticatorTransport
+	for _, t := range strings.Split(p.Transports, ",") {
+		if t != "" {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+	}
+	return webauthn.Credential{
+		ID:              p.CredentialID,
+		PublicKey:       p.PublicKey,
+		AttestationType: p.AttestationType,
+		Transport:       transports,
+		Flags:           webauthn.CredentialFlags{BackupEligible: p.BackupEligible, BackupState: p.BackupState},
+		Authenticator:   webauthn.Authenticator{AAGUID: p.AAGUID, SignCount: uint32(p.SignCount)},
+	}
+}
+
+func (m PasskeyModel) webauthnUser(user *User) (webauthnUser, error) {
+	passkeys, err := m.List(user.UserID)
+	if err != nil {
+		return webauthnUser{}, err
+	}
+	credentials := make([]webauthn.Credential, 0, len(passkeys))
+	for _, p := range passkeys {
+		credentials = append(credentials, p.credential())
+	}
+	return webauthnUser{user: user, credentials: credentials}, nil
+}
+
+// List returns the passkeys of userID, oldest first.
+func (m PasskeyModel) List(userID int) ([]Passkey, error) {
+	var passkeys []Passkey
+	if err := m.DB.Where("userid = ?", userID).Order("id").Find(&passkeys).Error; err != nil {
+		return nil, fmt.Errorf("List: %w", err)
+	}
+	return passkeys, nil
+}
+
+// Delete removes passkey id of userID.
+func (m PasskeyModel) Delete(userID int, id uint) error {
+	res := m.DB.Where("id = ? AND userid = ?", id, userID).Delete(&Passkey{})
+	if res.Error != nil {
+		return fmt.Errorf("Delete: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// BeginRegistration starts registering a new passkey for user. It returns the
+// options for navigator.credentials.create and the ceremony token.
+func (m PasskeyModel) BeginRegistration(user *User) (*protocol.CredentialCreation, string, error) {
+	if m.WebAuthn == nil {
+		return nil, "", ErrPasskeysUnavailable
+	}
+	wu, err := m.webauthnUser(user)
+	if err != nil {
+		return nil, "", fmt.Errorf("BeginRegistration: %w", err)
+	}
+	exclude := make([]protocol.CredentialDescriptor, 0, len(wu.credentials))
+	for _, c := range wu.credentials {
+		exclude = append(exclude, c.Descriptor())
+	}
+	selection := m.WebAuthn.Config.AuthenticatorSelection
+	selection.UserVerification = protocol.VerificationRequired
+	options, session, err := m.WebAuthn.BeginRegistration(wu,
+		webauthn.WithExclusions(exclude),
+		webauthn.WithAuthenticatorSelection(selection),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("BeginRegistration: %w", err)
+	}
+	token, err := m.saveCeremony(ceremonyRegistration, &user.UserID, session)
+	if err != nil {
+		return nil, "", fmt.Errorf("BeginRegistration: %w", err)
+	}
+	return options, token, nil
+}
+
+// FinishRegistration verifies the authenticator's response to the ceremony
+// started with token and stores the new passkey under name.
+func (m PasskeyModel) FinishRegistration(user *User, token, name string, response io.Reader) (*Passkey, error) {
+	if m.WebAuthn == nil {
+		return nil, ErrPasskeysUnavailable
+	}
+	ceremony, session, err := m.takeCeremony(token, ceremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if ceremony.UserID == nil || *ceremony.UserID != user.UserID {
+		return nil, ErrCeremonyInvalid
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBody(response)
+	if err != nil {
+		return nil, fmt.Errorf("FinishRegistration: %w: %v", ErrPasskeyInvalid, err)
+	}
+	wu, err := m.webauthnUser(user)
+	if err != nil {
+		return nil, fmt.Errorf("FinishRegistration: %w", err)
+	}
+	credential, err := m.WebAuthn.CreateCredential(wu, *session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("FinishRegistration: %w: %v", ErrPasskeyInvalid, err)
+	}
+	var exists int64
+	if err := m.DB.Model(&Passkey{}).Where("credential_id = ?", credential.ID).Count(&exists).Error; err != nil {
+		return nil, fmt.Errorf("FinishRegistration: %w", err)
+	}
+	if exists > 0 {
+		return nil, ErrPasskeyExists
+	}
+	transports := make([]string, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		name = "Passkey"
+	}
+	passkey := Passkey{
+		UserID:          user.UserID,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      strings.Join(transports, ","),
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       int64(credential.Authenticator.SignCount),
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		Name:            name,
+	}
+	if err := m.DB.Create(&passkey).Error; err != nil {
+		return nil, fmt.Errorf("FinishRegistration (saving): %w", err)
+	}
+	return &passkey, nil
+}
+
+// BeginLogin starts a passkey login. With a user only that user's passkeys
+// are allowed; with nil the authenticator offers any discoverable passkey and
+// the account follows from the user handle. User verification (a PIN or
+// biometric) is required, because a passkey login stands in for both the
+// password and the second factor.
+func (m PasskeyModel) BeginLogin(user *User) (*protocol.CredentialAssertion, string, error) {
+	if m.WebAuthn == nil {
+		return nil, "", ErrPasskeysUnavailable
+	}
+	var (
+		options *protocol.CredentialAssertion
+		session *webauthn.SessionData
+		userID  *int
+		err     error
+	)
+	if user == nil {
+		options, session, err = m.WebAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	} else {
+		wu, listErr := m.webauthnUser(user)
+		if listErr != nil {
+			return nil, "", fmt.Errorf("BeginLogin: %w", listErr)
+		}
+		if len(wu.credentials) == 0 {
+			return nil, "", ErrNoPasskeys
+		}
+		options, session, err = m.WebAuthn.BeginLogin(wu, webauthn.WithUserVerification(protocol.VerificationRequired))
+		userID = &user.UserID
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("BeginLogin: %w", err)
+	}
+	token, err := m.saveCeremony(ceremonyLogin, userID, session)
+	if err != nil {
+		return nil, "", fmt.Errorf("BeginLogin: %w", err)
+	}
+	return options, token, nil
+}
+
+// FinishLogin verifies the authenticator's assertion for the ceremony started
+// with token and returns the user it signs in. A signature counter that went
+// backwards points to a cloned authenticator and is refused.
+func (m PasskeyModel) FinishLogin(token string, response io.Reader) (*User, error) {
+	if m.WebAuthn == nil {
+		return nil, ErrPasskeysUnavailable
+	}
+	ceremony, session, err := m.takeCeremony(token, ceremonyLogin)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(response)
+	if err != nil {
+		return nil, fmt.Errorf("FinishLogin: %w: %v", ErrPasskeyInvalid, err)
+	}
+
+	var user *User
+	var credential *webauthn.Credential
+	if ceremony.UserID == nil {
+		credential, err = m.WebAuthn.ValidateDiscoverableLogin(func(_, userHandle []byte) (webauthn.User, error) {
+			var found User
+			if err := m.DB.Where("public_id = ?", string(userHandle)).First(&found).Error; err != nil {
+				return nil, err
+			}
+			user = &found
+			return m.webauthnUser(user)
+		}, *session, parsed)
+	} else {
+		var found User
+		if err := m.DB.First(&found, *ceremony.UserID).Error; err != nil {
+			return nil, ErrPasskeyInvalid
+		}
+		user = &found
+		wu, listErr := m.webauthnUser(user)
+		if listErr != nil {
+			return nil, fmt.Errorf("FinishLogin: %w", listErr)
+		}
+		credential, err = m.WebAuthn.ValidateLogin(wu, *session, parsed)
+	}
+	if err != nil || user == nil {
+		return nil, fmt.Errorf("FinishLogin: %w: %v", ErrPasskeyInvalid, err)
+	}
+	if credential.Authenticator.CloneWarning {
+		return nil, fmt.Errorf("FinishLogin: %w: signature counter went backwards", ErrPasskeyInvalid)
+	}
+	err = m.DB.Model(&Passkey{}).
+		Where("userid = ? AND credential_id = ?", user.UserID, credential.ID).
+		Updates(map[string]interface{}{
+			"sign_count":   int64(credential.Authenticator.SignCount),
+			"backup_state": credential.Flags.BackupState,
+			"last_used_at": time.Now(),
+		}).Error
+	if err != nil {
+		return nil, fmt.Errorf("FinishLogin (updating passkey): %w", err)
+	}
+	return user, nil
+}
+
+// PruneCeremonies deletes ceremonies that were never finished.
+func (m PasskeyModel) PruneCeremonies() (int64, error) {
+	res := m.DB.Where("expires_at <= ?", time.Now()).Delete(&PasskeyCeremony{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("PruneCeremonies: %w", res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+func (m PasskeyModel) saveCeremony(kind string, userID *int, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	ceremony := PasskeyCeremony{
+		TokenHash: hashRefreshToken(token),
+		Kind:      kind,
+		UserID:    userID,
+		Data:      string(data),
+		ExpiresAt: time.Now().Add(PasskeyCeremonyTTL),
+	}
+	if err := m.DB.Create(&ceremony).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// takeCeremony looks up and deletes a ceremony, so each can be finished once.
+func (m PasskeyModel) takeCeremony(token, kind string) (*PasskeyCeremony, *webauthn.SessionData, error) {
+	var ceremony PasskeyCeremony
+	err := m.DB.Where("token_hash = ? AND kind = ?", hashRefreshToken(token), kind).First(&ceremony).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrCeremonyInvalid
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("takeCeremony: %w", err)
+	}
+	res := m.DB.Where("id = ?", ceremony.ID).Delete(&PasskeyCeremony{})
+	if res.Error != nil {
+		return nil, nil, fmt.Errorf("takeCeremony: %w", res.Error)
+	}
+	if res.RowsAffected == 0 || time.Now().After(ceremony.ExpiresAt) {
+		return nil, nil, ErrCeremonyInvalid
+	}
+	var session webauthn.SessionData
+	if err := json.NewDecoder(bytes.NewReader([]byte(ceremony.Data))).Decode(&session); err != nil {
+		return nil, nil, fmt.Errorf("takeCeremony: %w", err)
+	}
+	return &ceremony, &session, nil
+}
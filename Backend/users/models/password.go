@@ -0,0 +1,129 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alexedwards/argon2id"
+)
+
+// DefaultPasswordParams are the argon2id parameters new password hashes use
+// unless SetPasswordParams installs others. Parallelism is fixed so that every
+// replica produces the same hashes whatever its CPU count.
+var DefaultPasswordParams = argon2id.Params{
+	Memory:      128 * 1024,
+	Iterations:  4,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+var (
+	passwordParamsMu sync.RWMutex
+	passwordParams   = DefaultPasswordParams
+)
+
+// SetPasswordParams installs the target parameters for new password hashes.
+// Stored hashes made with weaker ones are upgraded as their users log in.
+func SetPasswordParams(p argon2id.Params) error {
+	if p.Iterations < 1 || p.Parallelism < 1 || p.SaltLength < 16 || p.KeyLength < 16 {
+		return fmt.Errorf("SetPasswordParams: iterations and parallelism must be at least 1, salt and key length at least 16")
+	}
+	if p.Memory < 8*uint32(p.Parallelism) {
+		return fmt.Errorf("SetPasswordParams: memory must be at least 8 KiB per lane")
+	}
+	passwordParamsMu.Lock()
+	defer passwordParamsMu.Unlock()
+	passwordParams = p
+	return nil
+}
+
+// PasswordParams returns the target parameters for new password hashes.
+func PasswordParams() argon2id.Params {
+	passwordParamsMu.RLock()
+	defer passwordParamsMu.RUnlock()
+	return passwordParams
+}
+
+// NeedsRehash reports whether hash was made with parameters weaker than the
+// target, or with a different parallelism. Hashes that cannot be decoded are
+// left alone.
+func NeedsRehash(hash string) bool {
+	stored, _, _, err := argon2id.DecodeHash(hash)
+	if err != nil {
+		return false
+	}
+	target := PasswordParams()
+	return stored.Memory < target.Memory ||
+		stored.Iterations < target.Iterations ||
+		stored.Parallelism != target.Parallelism ||
+		stored.SaltLength < target.SaltLength ||
+		stored.KeyLength < target.KeyLength
+}
+
+// RehashPassword replaces user's password hash with one made with the target
+// parameters. password must already have been checked against the stored
+// hash. Nothing is written if the password changed in the meantime.
+func (e UserModel) RehashPassword(user *User, password string) error {
+	hashed, err := HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("RehashPassword: %w", err)
+	}
+	res := e.DB.Model(&User{}).Where("userid = ? AND password = ?", user.UserID, user.Password).Update("password", hashed)
+	if res.Error != nil {
+		return fmt.Errorf("RehashPassword: %w", res.Error)
+	}
+	if res.RowsAffected == 1 {
+		user.Password = hashed
+	}
+	return nil
+}
+
+// PasswordParamsBenchmark is how long one hash took with Params.
+type PasswordParamsBenchmark struct {
+	Params   argon2id.Params
+	Duration time.Duration
+}
+
+// BenchmarkPasswordParams times hashing on this host with parallelism lanes,
+// doubling the memory from 64 MiB up to maxMemory KiB. For each memory size it
+// raises the iterations until a hash takes longer than target and keeps the
+// last setting that did not. The recommendation is the setting with the most
+// memory that still affords two iterations, or else the cheapest one tried.
+func BenchmarkPasswordParams(target time.Duration, parallelism uint8, maxMemory uint32) (argon2id.Params, []PasswordParamsBenchmark) {
+	var results []PasswordParamsBenchmark
+	recommended := -1
+	for memory := uint32(64 * 1024); memory <= maxMemory; memory *= 2 {
+		var fit *PasswordParamsBenchmark
+		for iterations := uint32(1); iterations <= 16; iterations++ {
+			p := DefaultPasswordParams
+			p.Memory, p.Iterations, p.Parallelism = memory, iterations, parallelism
+			start := time.Now()
+			if _, err := argon2id.CreateHash("benchmark password", &p); err != nil {
+				break
+			}
+			elapsed := time.Since(start)
+			if elapsed > target {
+				break
+			}
+			fit = &PasswordParamsBenchmark{Params: p, Duration: elapsed}
+		}
+		if fit == nil {
+			break
+		}
+		results = append(results, *fit)
+		if fit.Params.Iterations >= 2 {
+			recommended = len(results) - 1
+		}
+	}
+	if len(results) == 0 {
+		p := DefaultPasswordParams
+		p.Memory, p.Iterations, p.Parallelism = 64*1024, 1, parallelism
+		return p, nil
+	}
+	if recommended < 0 {
+		recommended = 0
+	}
+	return results[recommended].Params, results
+}
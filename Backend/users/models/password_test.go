@@ -0,0 +1,55 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/alexedwards/argon2id"
+	"github.com/stretchr/testify/assert"
+)
+
+// lightParams keep the tests fast; they stand in for a raised target.
+var lightParams = argon2id.Params{Memory: 8 * 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestNeedsRehash(t *testing.T) {
+	assert.Error(t, SetPasswordParams(argon2id.Params{Memory: 4, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}))
+	assert.NoError(t, SetPasswordParams(lightParams))
+	defer func() { _ = SetPasswordParams(DefaultPasswordParams) }()
+
+	current, _ := argon2id.CreateHash("secret", &lightParams)
+	assert.False(t, NeedsRehash(current))
+	for name, p := range map[string]argon2id.Params{
+		"memory":      {Memory: 4 * 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+		"iterations":  {Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+		"parallelism": {Memory: 8 * 1024, Iterations: 2, Parallelism: 2, SaltLength: 16, KeyLength: 32},
+	} {
+		hash, _ := argon2id.CreateHash("secret", &p)
+		assert.True(t, NeedsRehash(hash), name)
+	}
+	stronger := argon2id.Params{Memory: 16 * 1024, Iterations: 3, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	hash, _ := argon2id.CreateHash("secret", &stronger)
+	assert.False(t, NeedsRehash(hash), "stronger hashes are kept")
+	assert.False(t, NeedsRehash("not a hash"))
+}
+
+func TestRehashPassword(t *testing.T) {
+	assert.NoError(t, SetPasswordParams(lightParams))
+	defer func() { _ = SetPasswordParams(DefaultPasswordParams) }()
+	m := newTestUserModel(t)
+	old := argon2id.Params{Memory: 4 * 1024, Iterations: 1, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+	hash, _ := argon2id.CreateHash("Rehash-Me-2025", &old)
+	user := &User{UserID: 1, Email: "rhea@ufl.edu", Password: hash}
+	assert.NoError(t, m.DB.Create(user).Error)
+
+	assert.NoError(t, m.RehashPassword(user, "Rehash-Me-2025"))
+	var stored User
+	m.DB.First(&stored, 1)
+	assert.Equal(t, user.Password, stored.Password)
+	assert.False(t, NeedsRehash(stored.Password))
+	match, _ := argon2id.ComparePasswordAndHash("Rehash-Me-2025", stored.Password)
+	assert.True(t, match)
+
+	stale := &User{UserID: 1, Password: hash}
+	assert.NoError(t, m.RehashPassword(stale, "Rehash-Me-2025"))
+	m.DB.First(&stored, 1)
+	assert.Equal(t, user.Password, stored.Password, "a password changed meanwhile is not overwritten")
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"users/sms"
+
+	"gorm.io/gorm"
+)
+
+// PhoneCodeInterval is the minimum time between two verification texts to the same user.
+const PhoneCodeInterval = time.Minute
+
+var (
+	ErrSMSUnavailable       = errors.New("phone verification is not available")
+	ErrNoPhone              = errors.New("no phone number on the account")
+	ErrPhoneAlreadyVerified = errors.New("phone number is already verified")
+	ErrPhoneCodeTooSoon     = errors.New("a code was sent recently, please wait before requesting another")
+)
+
+// NormalizePhone returns a valid US number in E.164 form, e.g. +13525551234.
+func NormalizePhone(phone string) (string, error) {
+	if err := ValidatePhone(phone); err != nil {
+		return "", err
+	}
+	digits := strings.TrimPrefix(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(phone)), "+")
+	if digits == "" {
+		return "", ErrNoPhone
+	}
+	if len(digits) == 10 {
+		digits = "1" + digits
+	}
+	return "+" + digits, nil
+}
+
+// SendPhoneVerification texts a one-time code to the user's phone number.
+func (e UserModel) SendPhoneVerification(user *User) error {
+	if e.SMS == nil {
+		return fmt.Errorf("SendPhoneVerification: %w", ErrSMSUnavailable)
+	}
+	if user.PhoneVerified {
+		return fmt.Errorf("SendPhoneVerification: %w", ErrPhoneAlreadyVerified)
+	}
+	to, err := NormalizePhone(user.Phone)
+	if err != nil {
+		return fmt.Errorf("SendPhoneVerification: %w", err)
+	}
+	// Texts cost money, so a new code is only sent once the last one is a minute old.
+	var last OTP
+	err = e.DB.Where("userid = ? AND purpose = ?", user.UserID, PurposePhoneVerification).First(&last).Error
+	if err == nil && time.Since(last.IssuedAt) < PhoneCodeInterval {
+		return fmt.Errorf("SendPhoneVerification: %w", ErrPhoneCodeTooSoon)
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("SendPhoneVerification (finding code): %w", err)
+	}
+	code, err := e.IssueOTP(user.UserID, PurposePhoneVerification)
+	if err != nil {
+		return fmt.Errorf("SendPhoneVerification (issuing OTP): %w", err)
+	}
+	body := fmt.Sprintf("Your UniBazaar verification code is %s. It expires in %d minutes.", code, int(e.otpTTL().Minutes()))
+	if err := e.SMS.Send(sms.Message{To: to, Body: body}); err != nil {
+		return fmt.Errorf("SendPhoneVerification (sending SMS): %w", err)
+	}
+	return nil
+}
+
+// VerifyPhone redeems code and marks the user's phone as verified. Other
+// services are notified so listings can show the seller's verified phone.
+func (e UserModel) VerifyPhone(user *User, code string) error {
+	if err := e.ConsumeOTP(user.UserID, PurposePhoneVerification, code); err != nil {
+		if errors.Is(err, ErrOTPInvalid) {
+			if _, recordErr := e.recordFailedProfileCode(user, PurposePhoneVerification); recordErr != nil {
+				return fmt.Errorf("VerifyPhone (recording wrong code): %w", recordErr)
+			}
+		}
+		return fmt.Errorf("VerifyPhone: %w", err)
+	}
+	err := e.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"phone_verified":        true,
+			"failed_reset_attempts": 0,
+		}).Error; err != nil {
+			return err
+		}
+		user.PhoneVerified, user.FailedResetAttempts = true, 0
+		return enqueueUserEvent(tx, EventUserUpdated, user)
+	})
+	if err != nil {
+		return fmt.Errorf("VerifyPhone: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DefaultRefreshTokenTTL is used when RefreshTokenModel.TTL is unset.
+const DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// RefreshToken is a server-side record of an opaque refresh token. Only the
+// SHA-256 of the token is stored. Every rotation stays in the same family so
+// that replaying an already-rotated token can revoke the whole chain.
+type RefreshToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    int       `gorm:"column:userid;not null;index"`
+	FamilyID  string    `gorm:"not null;index"`
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	CreatedAt time.Time `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+type RefreshTokenModel struct {
+	DB  *gorm.DB
+	TTL time.Duration
+}
+
+func (m RefreshTokenModel) ttl() time.Duration {
+	if m.TTL <= 0 {
+		return DefaultRefreshTokenTTL
+	}
+	return m.TTL
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Issue creates a refresh token for userID. An empty familyID starts a new family.
+func (m RefreshTokenModel) Issue(userID int, familyID string) (string, error) {
+	return m.issue(m.DB, userID, familyID)
+}
+
+func (m RefreshTokenModel) issue(db *gorm.DB, userID int, familyID string) (string, error) {
+	if familyID == "" {
+		familyID = uuid.NewString()
+	}
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("Issue (generating token): %w", err)
+	}
+	now := time.Now()
+	record := RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashRefreshToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(m.ttl()),
+	}
+	if err := db.Create(&record).Error; err != nil {
+		return "", fmt.Errorf("Issue (saving token): %w", err)
+	}
+	return token, nil
+}
+
+// Rotate exchanges a refresh token for a new one in the same family and
+// returns the rotated record, which names the user and the family. Presenting
+// a token that was already rotated revokes the family and returns
+// ErrRefreshTokenReused along with the record, so the caller knows whose
+// family it was.
+func (m RefreshTokenModel) Rotate(token string) (string, *RefreshToken, error) {
+	var current RefreshToken
+	err := m.DB.Where("token_hash = ?", hashRefreshToken(token)).First(&current).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("Rotate (finding token): %w", err)
+	}
+	if current.RevokedAt != nil || time.Now().After(current.ExpiresAt) {
+		return "", nil, ErrRefreshTokenInvalid
+	}
+	if current.UsedAt != nil {
+		if err := m.RevokeFamily(current.FamilyID); err != nil {
+			return "", nil, fmt.Errorf("Rotate: %w", err)
+		}
+		return "", &current, ErrRefreshTokenReused
+	}
+
+	var next string
+	err = m.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", current.ID).
+			Update("used_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			// Another request rotated this token first.
+			return ErrRefreshTokenReused
+		}
+		var err error
+		next, err = m.issue(tx, current.UserID, current.FamilyID)
+		return err
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		if revokeErr := m.RevokeFamily(current.FamilyID); revokeErr != nil {
+			return "", nil, fmt.Errorf("Rotate: %w", revokeErr)
+		}
+		return "", &current, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("Rotate: %w", err)
+	}
+	return next, &current, nil
+}
+
+// RevokeFamily revokes every token in a family.
+func (m RefreshTokenModel) RevokeFamily(familyID string) error {
+	err := m.DB.Model(&RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("RevokeFamily: %w", err)
+	}
+	return nil
+}
+
+// RevokeUser revokes every refresh token of a user, signing out all devices.
+func (m RefreshTokenModel) RevokeUser(userID int) error {
+	err := m.DB.Model(&RefreshToken{}).
+		Where("userid = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("RevokeUser: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserExcept revokes the refresh tokens of a user outside familyID,
+// signing out every other device.
+func (m RefreshTokenModel) RevokeUserExcept(userID int, familyID string) error {
+	err := m.DB.Model(&RefreshToken{}).
+		Where("userid = ? AND family_id <> ? AND revoked_at IS NULL", userID, familyID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("RevokeUserExcept: %w", err)
+	}
+	return nil
+}
+
+// RevokeToken revokes the family that token belongs to. Unknown tokens are ignored.
+func (m RefreshTokenModel) RevokeToken(token string) error {
+	var record RefreshToken
+	err := m.DB.Where("token_hash = ?", hashRefreshToken(token)).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("RevokeToken: %w", err)
+	}
+	return m.RevokeFamily(record.FamilyID)
+}
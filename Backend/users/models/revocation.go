@@ -0,0 +1,164 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TokenRevocationStore records revoked JWT IDs until the token would have
+// expired anyway. Implementations must be safe for concurrent use.
+type TokenRevocationStore interface {
+	Revoke(jti string, expiresAt time.Time) error
+	IsRevoked(jti string) (bool, error)
+	// RevokeSubject revokes every token of subject issued before issuedBefore. expiresAt is when the last of those tokens expires.
+	RevokeSubject(subject string, issuedBefore, expiresAt time.Time) error
+	// IsSubjectRevoked reports whether a token of subject issued at issuedAt was
+	// revoked through RevokeSubject.
+	IsSubjectRevoked(subject string, issuedAt time.Time) (bool, error)
+	// Prune removes entries whose token has expired and reports how many were removed.
+	Prune() (int64, error)
+}
+
+// RevokedToken is a row in the revoked_tokens table.
+type RevokedToken struct {
+	JTI       string    `gorm:"column:jti;primaryKey"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+// RevokedSubject is a row in the revoked_subjects table. IssuedBefore is the
+// exact time of the revocation; tokens issued from then on stay valid.
+type RevokedSubject struct {
+	Subject      string    `gorm:"primaryKey"`
+	IssuedBefore time.Time `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+}
+
+// PostgresRevocationStore keeps revocations in the shared users database so
+// that a logout on one replica is honored by all of them.
+type PostgresRevocationStore struct {
+	DB *gorm.DB
+}
+
+func (s PostgresRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	err := s.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+	if err != nil {
+		return fmt.Errorf("Revoke: %w", err)
+	}
+	return nil
+}
+
+func (s PostgresRevocationStore) IsRevoked(jti string) (bool, error) {
+	var count int64
+	err := s.DB.Model(&RevokedToken{}).
+		Where("jti = ? AND expires_at > ?", jti, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("IsRevoked: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (s PostgresRevocationStore) RevokeSubject(subject string, issuedBefore, expiresAt time.Time) error {
+	err := s.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "subject"}},
+		DoUpdates: clause.AssignmentColumns([]string{"issued_before", "expires_at"}),
+	}).Create(&RevokedSubject{Subject: subject, IssuedBefore: issuedBefore, ExpiresAt: expiresAt}).Error
+	if err != nil {
+		return fmt.Errorf("RevokeSubject: %w", err)
+	}
+	return nil
+}
+
+func (s PostgresRevocationStore) IsSubjectRevoked(subject string, issuedAt time.Time) (bool, error) {
+	var count int64
+	err := s.DB.Model(&RevokedSubject{}).
+		Where("subject = ? AND issued_before > ? AND expires_at > ?", subject, issuedAt, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("IsSubjectRevoked: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (s PostgresRevocationStore) Prune() (int64, error) {
+	var removed int64
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Where("expires_at <= ?", now).Delete(&RevokedToken{})
+		if res.Error != nil {
+			return res.Error
+		}
+		removed = res.RowsAffected
+		res = tx.Where("expires_at <= ?", now).Delete(&RevokedSubject{})
+		removed += res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("Prune: %w", err)
+	}
+	return removed, nil
+}
+
+// MemoryRevocationStore is an in-process store for tests and single-instance runs.
+type MemoryRevocationStore struct {
+	mu       sync.RWMutex
+	tokens   map[string]time.Time
+	subjects map[string]RevokedSubject
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{tokens: make(map[string]time.Time), subjects: make(map[string]RevokedSubject)}
+}
+
+func (s *MemoryRevocationStore) Revoke(jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	expiresAt, ok := s.tokens[jti]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+func (s *MemoryRevocationStore) RevokeSubject(subject string, issuedBefore, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subjects[subject] = RevokedSubject{Subject: subject, IssuedBefore: issuedBefore, ExpiresAt: expiresAt}
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsSubjectRevoked(subject string, issuedAt time.Time) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	revoked, ok := s.subjects[subject]
+	return ok && issuedAt.Before(revoked.IssuedBefore) && time.Now().Before(revoked.ExpiresAt), nil
+}
+
+func (s *MemoryRevocationStore) Prune() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var removed int64
+	now := time.Now()
+	for jti, expiresAt := range s.tokens {
+		if !now.Before(expiresAt) {
+			delete(s.tokens, jti)
+			removed++
+		}
+	}
+	for subject, revoked := range s.subjects {
+		if !now.Before(revoked.ExpiresAt) {
+			delete(s.subjects, subject)
+			removed++
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func testRevocationStore(t *testing.T, store TokenRevocationStore) {
+	assert.NoError(t, store.Revoke("live", time.Now().Add(time.Hour)))
+	assert.NoError(t, store.Revoke("stale", time.Now().Add(-time.Minute)))
+	// Revoking twice is not an error.
+	assert.NoError(t, store.Revoke("live", time.Now().Add(time.Hour)))
+
+	revoked, err := store.IsRevoked("live")
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = store.IsRevoked("stale")
+	assert.NoError(t, err)
+	assert.False(t, revoked, "revocations stop applying once the token has expired")
+
+	revoked, err = store.IsRevoked("unknown")
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	now := time.Now()
+	assert.NoError(t, store.RevokeSubject("42", now, now.Add(time.Hour)))
+	assert.NoError(t, store.RevokeSubject("43", now, now.Add(-time.Minute)))
+
+	revoked, err = store.IsSubjectRevoked("42", now.Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, revoked, "tokens issued before the revocation are revoked")
+
+	revoked, err = store.IsSubjectRevoked("42", now.Add(-time.Millisecond))
+	assert.NoError(t, err)
+	assert.True(t, revoked, "earlier in the same second counts as before")
+
+	revoked, err = store.IsSubjectRevoked("42", now)
+	assert.NoError(t, err)
+	assert.False(t, revoked, "tokens issued from the revocation on stay valid")
+
+	revoked, err = store.IsSubjectRevoked("42", now.Add(time.Millisecond))
+	assert.NoError(t, err)
+	assert.False(t, revoked, "tokens issued afterwards stay valid")
+
+	revoked, err = store.IsSubjectRevoked("43", now.Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	removed, err := store.Prune()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), removed)
+}
+
+func TestPostgresRevocationStore(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&RevokedToken{}, &RevokedSubject{}))
+	testRevocationStore(t, PostgresRevocationStore{DB: db})
+}
+
+func TestMemoryRevocationStore(t *testing.T) {
+	testRevocationStore(t, NewMemoryRevocationStore())
+}
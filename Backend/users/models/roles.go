@@ -0,0 +1,80 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Role is what a user may do beyond managing their own account and listings.
+type Role string
+
+const (
+	RoleStudent   Role = "student"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Permissions granted by roles. Access tokens carry them in the perms claim so
+// the products and messaging services can check them without a role table.
+const (
+	PermModerateListings   = "listings:moderate"
+	PermManageUsers        = "users:manage"
+	PermManageUniversities = "universities:manage"
+)
+
+var rolePermissions = map[Role][]string{
+	RoleStudent:   nil,
+	RoleModerator: {PermModerateListings},
+	RoleAdmin:     {PermModerateListings, PermManageUsers, PermManageUniversities},
+}
+
+var ErrInvalidRole = errors.New("role must be student, moderator or admin")
+
+// ParseRole validates a role name.
+func ParseRole(name string) (Role, error) {
+	role := Role(name)
+	if _, ok := rolePermissions[role]; !ok {
+		return "", ErrInvalidRole
+	}
+	return role, nil
+}
+
+// Permissions lists what the role grants.
+func (r Role) Permissions() []string {
+	return append([]string{}, rolePermissions[r]...)
+}
+
+// Can reports whether the role grants permission.
+func (r Role) Can(permission string) bool {
+	for _, p := range rolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentRole is the user's role, treating accounts without one as students.
+func (u User) CurrentRole() Role {
+	if u.Role == "" {
+		return RoleStudent
+	}
+	return u.Role
+}
+
+// SetRole changes the role of user.
+func (e UserModel) SetRole(user *User, role Role, actor AuditActor) error {
+	if _, err := ParseRole(string(role)); err != nil {
+		return err
+	}
+	details := fmt.Sprintf("%s -> %s", user.CurrentRole(), role)
+	err := e.audited(actor, AuditSetRole, user, details, func(tx *gorm.DB) error {
+		return tx.Model(user).Update("role", role).Error
+	})
+	if err != nil {
+		return fmt.Errorf("SetRole: %w", err)
+	}
+	return nil
+}
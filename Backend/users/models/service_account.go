@@ -0,0 +1,80 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/alexedwards/argon2id"
+)
+
+// ScopeTokenExchange allows a service account to obtain access tokens on behalf of users.
+const ScopeTokenExchange = "token:exchange"
+
+// ScopeAccountUnlock allows a service account to lift login lockouts.
+const ScopeAccountUnlock = "accounts:unlock"
+
+// ScopeUniversitiesWrite allows a service account to manage the university registry.
+const ScopeUniversitiesWrite = "universities:write"
+
+var ErrInvalidClient = errors.New("invalid client credentials")
+
+// ServiceAccount is a backend client that authenticates with a client ID and
+// secret. Only the argon2id hash of the secret is configured.
+type ServiceAccount struct {
+	ClientID   string   `json:"client_id"`
+	SecretHash string   `json:"secret_hash"`
+	Scopes     []string `json:"scopes"`
+}
+
+func (a ServiceAccount) HasScope(scope string) bool {
+	for _, s := range a.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceAccounts holds the configured service accounts keyed by client ID.
+type ServiceAccounts map[string]ServiceAccount
+
+// LoadServiceAccounts reads a JSON array of service accounts from path.
+func LoadServiceAccounts(path string) (ServiceAccounts, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("LoadServiceAccounts (%s): %w", path, err)
+	}
+	var list []ServiceAccount
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("LoadServiceAccounts (%s): %w", path, err)
+	}
+	accounts := make(ServiceAccounts, len(list))
+	for _, a := range list {
+		if a.ClientID == "" || a.SecretHash == "" {
+			return nil, fmt.Errorf("LoadServiceAccounts (%s): client_id and secret_hash are required", path)
+		}
+		if _, dup := accounts[a.ClientID]; dup {
+			return nil, fmt.Errorf("LoadServiceAccounts (%s): duplicate client_id %q", path, a.ClientID)
+		}
+		accounts[a.ClientID] = a
+	}
+	return accounts, nil
+}
+
+// Authenticate checks a client ID and secret against the configured accounts.
+func (s ServiceAccounts) Authenticate(clientID, secret string) (*ServiceAccount, error) {
+	account, ok := s[clientID]
+	if !ok || secret == "" {
+		return nil, ErrInvalidClient
+	}
+	match, err := argon2id.ComparePasswordAndHash(secret, account.SecretHash)
+	if err != nil {
+		return nil, fmt.Errorf("Authenticate (%s): %w", clientID, err)
+	}
+	if !match {
+		return nil, ErrInvalidClient
+	}
+	return &account, nil
+}
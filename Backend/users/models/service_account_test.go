@@ -0,0 +1,35 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexedwards/argon2id"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadServiceAccounts(t *testing.T) {
+	hash, err := argon2id.CreateHash("s3cret", argon2id.DefaultParams)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	data := `[{"client_id":"messaging","secret_hash":"` + hash + `","scopes":["token:exchange"]}]`
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+
+	accounts, err := LoadServiceAccounts(path)
+	assert.NoError(t, err)
+
+	account, err := accounts.Authenticate("messaging", "s3cret")
+	assert.NoError(t, err)
+	assert.True(t, account.HasScope(ScopeTokenExchange))
+	assert.False(t, account.HasScope("admin"))
+
+	_, err = accounts.Authenticate("messaging", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+	_, err = accounts.Authenticate("unknown", "s3cret")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`[{"client_id":"messaging"}]`), 0o600))
+	_, err = LoadServiceAccounts(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session describes where a refresh token family was issued. Its ID is the
+// family ID, so a session lasts exactly as long as the family has a live
+// refresh token, and revoking a session revokes the family.
+type Session struct {
+	ID         string    `gorm:"primaryKey" json:"id"`
+	UserID     int       `gorm:"column:userid;not null;index" json:"-"`
+	Device     string    `json:"device"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `gorm:"column:ip" json:"ip"`
+	CreatedAt  time.Time `gorm:"not null" json:"created_at"`
+	LastSeenAt time.Time `gorm:"not null" json:"last_seen_at"`
+	Current    bool      `gorm:"-" json:"current"`
+}
+
+type SessionModel struct {
+	DB *gorm.DB
+}
+
+// liveFamily matches sessions whose family still has a refresh token that can be used.
+const liveFamily = `EXISTS (SELECT 1 FROM refresh_tokens rt WHERE rt.family_id = sessions.id
+	AND rt.revoked_at IS NULL AND rt.used_at IS NULL AND rt.expires_at > ?)`
+
+// Start records a new session for familyID.
+func (m SessionModel) Start(familyID string, userID int, userAgent, ip string) error {
+	now := time.Now()
+	session := Session{
+		ID:         familyID,
+		UserID:     userID,
+		Device:     DescribeDevice(userAgent),
+		UserAgent:  userAgent,
+		IP:         ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+	if err := m.DB.Create(&session).Error; err != nil {
+		return fmt.Errorf("Start: %w", err)
+	}
+	return nil
+}
+
+// Touch records that the session was used again, possibly from a new address.
+func (m SessionModel) Touch(familyID, ip string) error {
+	err := m.DB.Model(&Session{}).Where("id = ?", familyID).
+		Updates(map[string]interface{}{"last_seen_at": time.Now(), "ip": ip}).Error
+	if err != nil {
+		return fmt.Errorf("Touch: %w", err)
+	}
+	return nil
+}
+
+// List returns the live sessions of userID, most recently used first.
+func (m SessionModel) List(userID int) ([]Session, error) {
+	var sessions []Session
+	err := m.DB.Where("userid = ?", userID).Where(liveFamily, time.Now()).
+		Order("last_seen_at DESC").Find(&sessions).Error
+	if err != nil {
+		return nil, fmt.Errorf("List: %w", err)
+	}
+	return sessions, nil
+}
+
+// Get returns session id of userID if it is still live.
+func (m SessionModel) Get(userID int, id string) (*Session, error) {
+	var session Session
+	err := m.DB.Where("id = ? AND userid = ?", id, userID).Where(liveFamily, time.Now()).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Get: %w", err)
+	}
+	return &session, nil
+}
+
+// Prune deletes sessions whose family has no refresh token left to use.
+func (m SessionModel) Prune() (int64, error) {
+	res := m.DB.Where("NOT "+liveFamily, time.Now()).Delete(&Session{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("Prune: %w", res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+// DescribeDevice turns a User-Agent header into a short label such as
+// "Chrome on macOS" for the session list.
+func DescribeDevice(userAgent string) string {
+	browsers := []struct{ token, name string }{
+		// Order matters: Edge and Opera also claim to be Chrome, and Chrome claims to be Safari.
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"CriOS/", "Chrome"},
+		{"Safari/", "Safari"},
+	}
+	systems := []struct{ token, name string }{
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+	browser, system := "", ""
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, s := range systems {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	case userAgent != "":
+		return "Unknown device"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,194 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AccountStatus is the lifecycle state of a user account.
+//
+//	pending     -> active (email verified), locked, deleted
+//	active      -> locked, deactivated, deleted
+//	locked      -> pending or active once the cooling-off period ends, deleted
+//	deactivated -> active, deleted; admins deactivate and reactivate accounts
+//	deleted     -> active or pending, only when an admin restores the account
+type AccountStatus string
+
+const (
+	StatusPending     AccountStatus = "pending"
+	StatusActive      AccountStatus = "active"
+	StatusLocked      AccountStatus = "locked"
+	StatusDeactivated AccountStatus = "deactivated"
+	StatusDeleted     AccountStatus = "deleted"
+)
+
+// DefaultVerificationCooldown is how long an account stays locked after too
+// many wrong verification codes.
+const DefaultVerificationCooldown = 30 * time.Minute
+
+// MaxFailedCodeAttempts wrong codes in a row lock the account.
+const MaxFailedCodeAttempts = 5
+
+// FailedCodeAlertAfter wrong codes in a row revoke the outstanding code and
+// alert the owner, before the account is locked.
+const FailedCodeAlertAfter = 3
+
+var (
+	ErrInvalidStatusTransition = errors.New("invalid account status transition")
+	ErrAccountLocked           = errors.New("account is temporarily locked")
+)
+
+var statusTransitions = map[AccountStatus][]AccountStatus{
+	StatusPending:     {StatusActive, StatusLocked, StatusDeleted},
+	StatusActive:      {StatusLocked, StatusDeactivated, StatusDeleted},
+	StatusLocked:      {StatusPending, StatusActive, StatusDeleted},
+	StatusDeactivated: {StatusActive, StatusDeleted},
+}
+
+// CanTransition reports whether an account may move from one status to another.
+func CanTransition(from, to AccountStatus) bool {
+	for _, s := range statusTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentStatus returns the user's status at now. Rows written before the
+// status column existed are derived from Verified, and a lock whose
+// cooling-off period has passed reads as the status it will return to.
+func (u *User) CurrentStatus(now time.Time) AccountStatus {
+	switch {
+	case u.Status == "" && u.Verified, u.Status == StatusLocked && u.Verified && u.lockExpired(now):
+		return StatusActive
+	case u.Status == "", u.Status == StatusLocked && u.lockExpired(now):
+		return StatusPending
+	}
+	return u.Status
+}
+
+func (u *User) lockExpired(now time.Time) bool {
+	return u.LockedUntil == nil || !u.LockedUntil.After(now)
+}
+
+// SetStatus moves user to status, enforcing the allowed transitions.
+func (e UserModel) SetStatus(user *User, status AccountStatus) error {
+	from := user.CurrentStatus(time.Now())
+	if from == status {
+		return nil
+	}
+	if !CanTransition(from, status) {
+		return fmt.Errorf("SetStatus (%s -> %s): %w", from, status, ErrInvalidStatusTransition)
+	}
+	user.Status = status
+	if status != StatusLocked {
+		user.LockedUntil = nil
+	}
+	if err := e.DB.Model(user).Updates(map[string]interface{}{
+		"status":       user.Status,
+		"locked_until": user.LockedUntil,
+	}).Error; err != nil {
+		return fmt.Errorf("SetStatus: %w", err)
+	}
+	return nil
+}
+
+func (e UserModel) verificationCooldown() time.Duration {
+	if e.VerificationCooldown > 0 {
+		return e.VerificationCooldown
+	}
+	return DefaultVerificationCooldown
+}
+
+// RecordFailedCode counts a wrong one-time code. After FailedCodeAlertAfter
+// the outstanding code of purpose is revoked and the owner alerted; after
+// MaxFailedCodeAttempts the account is locked for the cooling-off period,
+// instead of being removed. Requesting a new code does not reset the count, so
+// resending cannot be used to guess forever. It reports whether the account
+// was locked.
+func (e UserModel) RecordFailedCode(user *User, purpose OTPPurpose) (bool, error) {
+	if err := e.countFailedCode(user); err != nil {
+		return false, fmt.Errorf("RecordFailedCode: %w", err)
+	}
+	if user.FailedResetAttempts < MaxFailedCodeAttempts {
+		if user.FailedResetAttempts == FailedCodeAlertAfter {
+			if err := e.RevokeOTP(user.UserID, purpose); err != nil {
+				return false, fmt.Errorf("RecordFailedCode: %w", err)
+			}
+			_ = e.sendSecurityAlert(user, string(purpose))
+		}
+		return false, nil
+	}
+
+	until := time.Now().Add(e.verificationCooldown())
+	user.LockedUntil = &until
+	if err := e.SetStatus(user, StatusLocked); err != nil {
+		return false, fmt.Errorf("RecordFailedCode: %w", err)
+	}
+	if err := e.DB.Model(&User{}).Where("userid = ?", user.UserID).Update("failed_reset_attempts", 0).Error; err != nil {
+		return false, fmt.Errorf("RecordFailedCode: %w", err)
+	}
+	user.FailedResetAttempts = 0
+	if err := e.RevokeOTP(user.UserID, purpose); err != nil {
+		return true, fmt.Errorf("RecordFailedCode: %w", err)
+	}
+	_ = e.sendSecurityAlert(user, string(purpose))
+	return true, nil
+}
+
+// countFailedCode adds one to the user's wrong-code count in the database, so
+// concurrent guesses are all counted, and loads the new count into user.
+func (e UserModel) countFailedCode(user *User) error {
+	return e.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("userid = ?", user.UserID).
+			Update("failed_reset_attempts", gorm.Expr("failed_reset_attempts + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Model(&User{}).Where("userid = ?", user.UserID).
+			Select("failed_reset_attempts").Row().Scan(&user.FailedResetAttempts)
+	})
+}
+
+// PurgeUnverified deletes accounts that were never verified and are older
+// than maxAge, along with their one-time codes. It returns how many were removed.
+func (e UserModel) PurgeUnverified(maxAge time.Duration) (int64, error) {
+	var ids []int
+	err := e.DB.Model(&User{}).
+		Where("verified = ? AND created_at < ?", false, time.Now().Add(-maxAge)).
+		Where("status IS NULL OR status IN ?", []AccountStatus{"", StatusPending, StatusLocked}).
+		Pluck("userid", &ids).Error
+	if err != nil {
+		return 0, fmt.Errorf("PurgeUnverified: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	var removed int64
+	err = e.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("userid IN ?", ids).Delete(&OTP{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&User{}).Where("userid IN ?", ids).Update("status", StatusDeleted).Error; err != nil {
+			return err
+		}
+		res := tx.Where("userid IN ?", ids).Delete(&User{})
+		if res.Error != nil {
+			return res.Error
+		}
+		removed = res.RowsAffected
+		for _, id := range ids {
+			if err := enqueueUserEvent(tx, EventUserDeleted, &User{UserID: id}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("PurgeUnverified: %w", err)
+	}
+	return removed, nil
+}
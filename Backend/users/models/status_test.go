@@ -0,0 +1,142 @@
+package models
+
+import (
+	"testing"
+	"time"
+	"users/mailer"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func newTestUserModel(t *testing.T) UserModel {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&User{}, &OTP{}, &OutboxEvent{}, &AuthEvent{}))
+	return UserModel{DB: db, Mailer: mailer.NewFileMailer(t.TempDir())}
+}
+
+func TestCurrentStatus(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	assert.Equal(t, StatusActive, (&User{Verified: true}).CurrentStatus(now), "legacy verified rows are active")
+	assert.Equal(t, StatusPending, (&User{}).CurrentStatus(now), "legacy unverified rows are pending")
+	assert.Equal(t, StatusLocked, (&User{Status: StatusLocked, LockedUntil: &future}).CurrentStatus(now))
+	assert.Equal(t, StatusPending, (&User{Status: StatusLocked, LockedUntil: &past}).CurrentStatus(now))
+	assert.Equal(t, StatusActive, (&User{Status: StatusLocked, LockedUntil: &past, Verified: true}).CurrentStatus(now))
+	assert.Equal(t, StatusDeactivated, (&User{Status: StatusDeactivated, Verified: true}).CurrentStatus(now))
+}
+
+func TestSetStatusTransitions(t *testing.T) {
+	m := newTestUserModel(t)
+	user := &User{UserID: 1, Email: "ellie@ufl.edu", Status: StatusPending}
+	assert.NoError(t, m.DB.Create(user).Error)
+
+	assert.ErrorIs(t, m.SetStatus(user, StatusDeactivated), ErrInvalidStatusTransition)
+	assert.NoError(t, m.SetStatus(user, StatusActive))
+	assert.NoError(t, m.SetStatus(user, StatusDeactivated))
+	assert.NoError(t, m.SetStatus(user, StatusDeleted))
+	assert.ErrorIs(t, m.SetStatus(user, StatusActive), ErrInvalidStatusTransition, "deleted is final")
+
+	var stored User
+	assert.NoError(t, m.DB.First(&stored, 1).Error)
+	assert.Equal(t, StatusDeleted, stored.Status)
+}
+
+func TestUpdateVerificationStatusActivatesPendingAccounts(t *testing.T) {
+	m := newTestUserModel(t)
+	until := time.Now().Add(time.Hour)
+	pending := &User{UserID: 3, Email: "mara@ufl.edu", Status: StatusPending}
+	locked := &User{UserID: 4, Email: "nico@ufl.edu", Status: StatusLocked, LockedUntil: &until}
+	assert.NoError(t, m.DB.Create(pending).Error)
+	assert.NoError(t, m.DB.Create(locked).Error)
+
+	pending.Verified, locked.Verified = true, true
+	assert.NoError(t, m.UpdateVerificationStatus(pending))
+	assert.NoError(t, m.UpdateVerificationStatus(locked))
+
+	stored, err := m.ReadByID(3)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusActive, stored.Status)
+	stored, err = m.ReadByID(4)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusLocked, stored.Status, "a lock outlasts verification")
+}
+
+func TestRecordFailedCodeLocksInsteadOfDeleting(t *testing.T) {
+	m := newTestUserModel(t)
+	m.VerificationCooldown = time.Hour
+	user := &User{UserID: 2, Email: "joel@ufl.edu", Status: StatusPending}
+	assert.NoError(t, m.DB.Create(user).Error)
+	_, err := m.IssueOTP(2, PurposeEmailVerification)
+	assert.NoError(t, err)
+
+	for i := 1; i < MaxFailedCodeAttempts; i++ {
+		locked, err := m.RecordFailedCode(user, PurposeEmailVerification)
+		assert.NoError(t, err)
+		assert.False(t, locked)
+	}
+	locked, err := m.RecordFailedCode(user, PurposeEmailVerification)
+	assert.NoError(t, err)
+	assert.True(t, locked)
+
+	stored, err := m.ReadByID(2)
+	assert.NoError(t, err, "the account still exists")
+	assert.Equal(t, StatusLocked, stored.CurrentStatus(time.Now()))
+	assert.Equal(t, StatusPending, stored.CurrentStatus(time.Now().Add(2*time.Hour)), "the lock lifts after the cooldown")
+	assert.Zero(t, stored.FailedResetAttempts)
+
+	var codes int64
+	m.DB.Model(&OTP{}).Where("userid = ?", 2).Count(&codes)
+	assert.Zero(t, codes, "outstanding codes are revoked")
+}
+
+func TestRecordFailedCodeCountsConcurrentGuesses(t *testing.T) {
+	m := newTestUserModel(t)
+	user := &User{UserID: 5, Email: "remy@ufl.edu", Status: StatusPending}
+	assert.NoError(t, m.DB.Create(user).Error)
+
+	// Each guess arrives on its own request, holding a copy read before any failed.
+	locked := false
+	for i := 0; i < MaxFailedCodeAttempts; i++ {
+		stale := *user
+		var err error
+		locked, err = m.RecordFailedCode(&stale, PurposeEmailVerification)
+		assert.NoError(t, err)
+	}
+	assert.True(t, locked, "every guess counts even when the caller's copy is stale")
+
+	stored, err := m.ReadByID(5)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusLocked, stored.CurrentStatus(time.Now()))
+	assert.Equal(t, "remy@ufl.edu", stored.Email)
+}
+
+func TestPurgeUnverified(t *testing.T) {
+	m := newTestUserModel(t)
+	old := time.Now().Add(-48 * time.Hour)
+	m.DB.Create(&User{UserID: 10, Email: "stale@ufl.edu", Status: StatusPending, CreatedAt: old})
+	m.DB.Create(&User{UserID: 11, Email: "fresh@ufl.edu", Status: StatusPending})
+	m.DB.Create(&User{UserID: 12, Email: "verified@ufl.edu", Status: StatusActive, Verified: true, CreatedAt: old})
+	_, _ = m.IssueOTP(10, PurposeEmailVerification)
+
+	removed, err := m.PurgeUnverified(24 * time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+
+	_, err = m.Read("stale@ufl.edu")
+	assert.Error(t, err)
+	_, err = m.Read("fresh@ufl.edu")
+	assert.NoError(t, err)
+	_, err = m.Read("verified@ufl.edu")
+	assert.NoError(t, err)
+
+	var tombstone User
+	assert.NoError(t, m.DB.Unscoped().First(&tombstone, 10).Error)
+	assert.Equal(t, StatusDeleted, tombstone.Status)
+	var codes int64
+	m.DB.Model(&OTP{}).Where("userid = ?", 10).Count(&codes)
+	assert.Zero(t, codes)
+}
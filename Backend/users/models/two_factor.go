@@ -0,0 +1,328 @@
+package models
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/alexedwards/argon2id"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+const (
+	// TOTPIssuer names the account in authenticator apps.
+	TOTPIssuer = "UniBazaar"
+	// totpPeriod and totpSkew accept the current code and its neighbours.
+	totpPeriod = 30
+	totpSkew   = 1
+
+	// LoginChallengeTTL is how long a password login waits for its second factor.
+	LoginChallengeTTL = 5 * time.Minute
+	// MaxChallengeAttempts wrong codes end a login challenge.
+	MaxChallengeAttempts = 5
+
+	recoveryCodeCount = 10
+)
+
+// recoveryCodeParams are lighter than the password parameters: every code of
+// a user may be compared on one login, and the codes are random, not chosen.
+var recoveryCodeParams = &argon2id.Params{Memory: 19 * 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+var (
+	ErrTwoFactorEnabled      = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled   = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotEnrolled  = errors.New("two-factor enrollment has not been started")
+	ErrInvalidSecondFactor   = errors.New("invalid authentication code")
+	ErrLoginChallengeInvalid = errors.New("invalid or expired login challenge")
+)
+
+// RecoveryCode is a single-use code that stands in for a TOTP code when the
+// authenticator is lost. Only the argon2id hash is stored.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    int    `gorm:"column:userid;not null;index"`
+	CodeHash  string `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// LoginChallenge is a password login of a user with two-factor authentication
+// waiting for its second factor. The opaque challenge token is stored as a
+// SHA-256 hash, like refresh tokens.
+type LoginChallenge struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    int       `gorm:"column:userid;not null;index"`
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	Attempts  int       `gorm:"not null;default:0"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+// TwoFactorEnrollment is what an authenticator app needs to add the account.
+type TwoFactorEnrollment struct {
+	Secret string
+	URI    string
+	QRCode []byte // PNG encoding of URI
+}
+
+type TwoFactorModel struct {
+	DB *gorm.DB
+}
+
+// Enroll starts TOTP enrollment with a fresh secret. Two-factor login only
+// applies once Confirm has seen a first code; enrolling again before that
+// replaces the secret.
+func (m TwoFactorModel) Enroll(user *User) (*TwoFactorEnrollment, error) {
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("Enroll: %w", ErrTwoFactorEnabled)
+	}
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: TOTPIssuer, AccountName: user.Email, Period: totpPeriod})
+	if err != nil {
+		return nil, fmt.Errorf("Enroll (generating secret): %w", err)
+	}
+	img, err := key.Image(256, 256)
+	if err != nil {
+		return nil, fmt.Errorf("Enroll (rendering QR code): %w", err)
+	}
+	var qr bytes.Buffer
+	if err := png.Encode(&qr, img); err != nil {
+		return nil, fmt.Errorf("Enroll (encoding QR code): %w", err)
+	}
+	if err := m.DB.Model(user).Updates(map[string]interface{}{
+		"totp_secret":    key.Secret(),
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("Enroll (saving secret): %w", err)
+	}
+	return &TwoFactorEnrollment{Secret: key.Secret(), URI: key.URL(), QRCode: qr.Bytes()}, nil
+}
+
+// Confirm enables two-factor authentication once code matches the enrolled
+// secret, and returns new recovery codes. They are only shown this once.
+func (m TwoFactorModel) Confirm(user *User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("Confirm: %w", ErrTwoFactorEnabled)
+	}
+	if user.TOTPSecret == "" {
+		return nil, fmt.Errorf("Confirm: %w", ErrTwoFactorNotEnrolled)
+	}
+	if err := m.verifyTOTP(m.DB, user, code); err != nil {
+		return nil, fmt.Errorf("Confirm: %w", err)
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("Confirm: %w", err)
+	}
+	err = m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("totp_enabled", true).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("userid = ?", user.UserID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		rows := make([]RecoveryCode, 0, len(hashes))
+		for _, hash := range hashes {
+			rows = append(rows, RecoveryCode{UserID: user.UserID, CodeHash: hash, CreatedAt: now})
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Confirm (saving): %w", err)
+	}
+	return codes, nil
+}
+
+// Disable turns two-factor authentication off and discards the secret and recovery codes.
+func (m TwoFactorModel) Disable(user *User) error {
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_enabled":   false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("userid = ?", user.UserID).Delete(&RecoveryCode{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("Disable: %w", err)
+	}
+	return nil
+}
+
+// Verify checks a second factor of a user with two-factor authentication: a
+// TOTP code, or else an unused recovery code, which is then used up.
+func (m TwoFactorModel) Verify(user *User, code string) error {
+	if !user.TOTPEnabled {
+		return fmt.Errorf("Verify: %w", ErrTwoFactorNotEnabled)
+	}
+	code = strings.TrimSpace(code)
+	if len(code) == otp.DigitsSix.Length() {
+		return m.verifyTOTP(m.DB, user, code)
+	}
+	return m.useRecoveryCode(user, code)
+}
+
+// verifyTOTP accepts code for the current time step or a neighbouring one. A
+// step is only accepted once, so an observed code cannot be replayed.
+func (m TwoFactorModel) verifyTOTP(db *gorm.DB, user *User, code string) error {
+	now := time.Now()
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= user.TOTPLastStep {
+			continue
+		}
+		expected, err := totp.GenerateCodeCustom(user.TOTPSecret, time.Unix(step*totpPeriod, 0), totp.ValidateOpts{
+			Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return fmt.Errorf("verifyTOTP: %w", err)
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) != 1 {
+			continue
+		}
+		res := db.Model(&User{}).Where("userid = ? AND totp_last_step < ?", user.UserID, step).Update("totp_last_step", step)
+		if res.Error != nil {
+			return fmt.Errorf("verifyTOTP: %w", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvalidSecondFactor
+		}
+		user.TOTPLastStep = step
+		return nil
+	}
+	return ErrInvalidSecondFactor
+}
+
+func (m TwoFactorModel) useRecoveryCode(user *User, code string) error {
+	code = normalizeRecoveryCode(code)
+	if code == "" {
+		return ErrInvalidSecondFactor
+	}
+	var unused []RecoveryCode
+	if err := m.DB.Where("userid = ? AND used_at IS NULL", user.UserID).Find(&unused).Error; err != nil {
+		return fmt.Errorf("useRecoveryCode: %w", err)
+	}
+	for _, rc := range unused {
+		match, err := argon2id.ComparePasswordAndHash(code, rc.CodeHash)
+		if err != nil || !match {
+			continue
+		}
+		res := m.DB.Model(&RecoveryCode{}).Where("id = ? AND used_at IS NULL", rc.ID).Update("used_at", time.Now())
+		if res.Error != nil {
+			return fmt.Errorf("useRecoveryCode: %w", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvalidSecondFactor
+		}
+		return nil
+	}
+	return ErrInvalidSecondFactor
+}
+
+// RemainingRecoveryCodes counts the unused recovery codes of userID.
+func (m TwoFactorModel) RemainingRecoveryCodes(userID int) (int64, error) {
+	var count int64
+	if err := m.DB.Model(&RecoveryCode{}).Where("userid = ? AND used_at IS NULL", userID).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("RemainingRecoveryCodes: %w", err)
+	}
+	return count, nil
+}
+
+// IssueChallenge starts the second step of a login of userID and returns the
+// challenge token to present with the code.
+func (m TwoFactorModel) IssueChallenge(userID int) (string, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("IssueChallenge (generating token): %w", err)
+	}
+	challenge := LoginChallenge{UserID: userID, TokenHash: hashRefreshToken(token), ExpiresAt: time.Now().Add(LoginChallengeTTL)}
+	if err := m.DB.Create(&challenge).Error; err != nil {
+		return "", fmt.Errorf("IssueChallenge (saving): %w", err)
+	}
+	return token, nil
+}
+
+// Challenge looks up an unexpired challenge with attempts left.
+func (m TwoFactorModel) Challenge(token string) (*LoginChallenge, error) {
+	var challenge LoginChallenge
+	err := m.DB.Where("token_hash = ? AND expires_at > ? AND attempts < ?", hashRefreshToken(token), time.Now(), MaxChallengeAttempts).
+		First(&challenge).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrLoginChallengeInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Challenge: %w", err)
+	}
+	return &challenge, nil
+}
+
+// FailChallenge counts a wrong code against challenge.
+func (m TwoFactorModel) FailChallenge(challenge *LoginChallenge) error {
+	if err := m.DB.Model(challenge).Update("attempts", gorm.Expr("attempts + 1")).Error; err != nil {
+		return fmt.Errorf("FailChallenge: %w", err)
+	}
+	return nil
+}
+
+// CompleteChallenge removes challenge once its second factor was accepted. It
+// returns ErrLoginChallengeInvalid if a concurrent request completed it first.
+func (m TwoFactorModel) CompleteChallenge(challenge *LoginChallenge) error {
+	res := m.DB.Where("id = ?", challenge.ID).Delete(&LoginChallenge{})
+	if res.Error != nil {
+		return fmt.Errorf("CompleteChallenge: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrLoginChallengeInvalid
+	}
+	return nil
+}
+
+// PruneChallenges deletes expired login challenges.
+func (m TwoFactorModel) PruneChallenges() (int64, error) {
+	res := m.DB.Where("expires_at <= ?", time.Now()).Delete(&LoginChallenge{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("PruneChallenges: %w", res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+// recoveryAlphabet avoids characters that are easily confused when copied by hand.
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// newRecoveryCodes returns recovery codes formatted as xxxxx-xxxxx and their hashes.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	buf := make([]byte, 10)
+	for i := 0; i < recoveryCodeCount; i++ {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, fmt.Errorf("newRecoveryCodes: %w", err)
+		}
+		var code strings.Builder
+		for j, b := range buf {
+			if j == 5 {
+				code.WriteByte('-')
+			}
+			code.WriteByte(recoveryAlphabet[int(b)%len(recoveryAlphabet)])
+		}
+		hash, err := argon2id.CreateHash(normalizeRecoveryCode(code.String()), recoveryCodeParams)
+		if err != nil {
+			return nil, nil, fmt.Errorf("newRecoveryCodes (hashing): %w", err)
+		}
+		codes = append(codes, code.String())
+		hashes = append(hashes, hash)
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
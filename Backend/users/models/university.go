@@ -0,0 +1,263 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidUniversity = errors.New("invalid university")
+
+// CampusList is stored as a JSON array in a text column.
+type CampusList []string
+
+func (c CampusList) Value() (driver.Value, error) {
+	if c == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+func (c *CampusList) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	case []byte:
+		return json.Unmarshal(v, c)
+	default:
+		return fmt.Errorf("CampusList: unsupported type %T", src)
+	}
+}
+
+// University is a row in the universities table. Students sign up with an
+// email address at Domain or any of its subdomains.
+type University struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Domain    string     `gorm:"uniqueIndex;not null" json:"domain"`
+	Name      string     `gorm:"not null" json:"name"`
+	Campuses  CampusList `gorm:"type:text" json:"campuses"`
+	Enabled   bool       `gorm:"not null" json:"enabled"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Normalize lowercases the domain and checks the required fields.
+func (u *University) Normalize() error {
+	u.Domain = strings.ToLower(strings.TrimSpace(u.Domain))
+	u.Name = strings.TrimSpace(u.Name)
+	if !strings.HasSuffix(u.Domain, ".edu") || strings.HasPrefix(u.Domain, ".") {
+		return fmt.Errorf("%w: domain must be a .edu domain", ErrInvalidUniversity)
+	}
+	if u.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidUniversity)
+	}
+	return nil
+}
+
+// DefaultUniversities are the schools UniBazaar launched with. They seed an
+// empty universities table and back ValidateEduEmail until a registry is installed.
+var DefaultUniversities = []University{
+	{Domain: "ufl.edu", Name: "University of Florida", Campuses: CampusList{"Gainesville"}, Enabled: true},
+	{Domain: "fsu.edu", Name: "Florida State University", Campuses: CampusList{"Tallahassee", "Panama City"}, Enabled: true},
+	{Domain: "ucf.edu", Name: "University of Central Florida", Campuses: CampusList{"Orlando"}, Enabled: true},
+	{Domain: "usf.edu", Name: "University of South Florida", Campuses: CampusList{"Tampa", "St. Petersburg", "Sarasota-Manatee"}, Enabled: true},
+	{Domain: "fiu.edu", Name: "Florida International University", Campuses: CampusList{"Miami", "Biscayne Bay"}, Enabled: true},
+	{Domain: "fau.edu", Name: "Florida Atlantic University", Campuses: CampusList{"Boca Raton"}, Enabled: true},
+	{Domain: "fgcu.edu", Name: "Florida Gulf Coast University", Campuses: CampusList{"Fort Myers"}, Enabled: true},
+	{Domain: "unf.edu", Name: "University of North Florida", Campuses: CampusList{"Jacksonville"}, Enabled: true},
+	{Domain: "famu.edu", Name: "Florida A&M University", Campuses: CampusList{"Tallahassee"}, Enabled: true},
+	{Domain: "ncf.edu", Name: "New College of Florida", Campuses: CampusList{"Sarasota"}, Enabled: true},
+	{Domain: "floridapoly.edu", Name: "Florida Polytechnic University", Campuses: CampusList{"Lakeland"}, Enabled: true},
+}
+
+// UniversityLookup resolves the enabled university for an email domain.
+type UniversityLookup interface {
+	LookupDomain(domain string) (*University, error)
+}
+
+// candidateDomains lists domain and its parents down to the registrable
+// domain, e.g. cise.ufl.edu, ufl.edu.
+func candidateDomains(domain string) []string {
+	labels := strings.Split(strings.ToLower(domain), ".")
+	var out []string
+	for i := 0; i < len(labels)-1; i++ {
+		out = append(out, strings.Join(labels[i:], "."))
+	}
+	return out
+}
+
+func lookupIn(byDomain map[string]University, domain string) *University {
+	for _, candidate := range candidateDomains(domain) {
+		if u, ok := byDomain[candidate]; ok && u.Enabled {
+			return &u
+		}
+	}
+	return nil
+}
+
+// staticUniversities is a fixed lookup over a slice of universities.
+type staticUniversities map[string]University
+
+func (s staticUniversities) LookupDomain(domain string) (*University, error) {
+	return lookupIn(s, domain), nil
+}
+
+func newStaticUniversities(list []University) staticUniversities {
+	s := make(staticUniversities, len(list))
+	for _, u := range list {
+		s[u.Domain] = u
+	}
+	return s
+}
+
+var (
+	universitiesMu sync.RWMutex
+	universities   UniversityLookup = newStaticUniversities(DefaultUniversities)
+)
+
+// SetUniversityLookup installs the registry ValidateEduEmail consults. nil
+// restores the built-in DefaultUniversities.
+func SetUniversityLookup(l UniversityLookup) {
+	if l == nil {
+		l = newStaticUniversities(DefaultUniversities)
+	}
+	universitiesMu.Lock()
+	defer universitiesMu.Unlock()
+	universities = l
+}
+
+func currentUniversityLookup() UniversityLookup {
+	universitiesMu.RLock()
+	defer universitiesMu.RUnlock()
+	return universities
+}
+
+// UniversityModel manages the universities table and caches it for lookups.
+// The cache is refreshed every CacheTTL and whenever this replica changes a row.
+type UniversityModel struct {
+	DB       *gorm.DB
+	CacheTTL time.Duration
+
+	cache *universityCache
+}
+
+type universityCache struct {
+	mu       sync.Mutex
+	byDomain map[string]University
+	loadedAt time.Time
+}
+
+// DefaultUniversityCacheTTL bounds how stale another replica's view can be.
+const DefaultUniversityCacheTTL = time.Minute
+
+func NewUniversityModel(db *gorm.DB) UniversityModel {
+	return UniversityModel{DB: db, CacheTTL: DefaultUniversityCacheTTL, cache: &universityCache{}}
+}
+
+// LookupDomain returns the enabled university for domain or one of its
+// parent domains, or nil if there is none.
+func (m UniversityModel) LookupDomain(domain string) (*University, error) {
+	m.cache.mu.Lock()
+	defer m.cache.mu.Unlock()
+	if m.cache.byDomain == nil || time.Since(m.cache.loadedAt) > m.CacheTTL {
+		var list []University
+		if err := m.DB.Find(&list).Error; err != nil {
+			return nil, fmt.Errorf("LookupDomain: %w", err)
+		}
+		m.cache.byDomain = make(map[string]University, len(list))
+		for _, u := range list {
+			m.cache.byDomain[u.Domain] = u
+		}
+		m.cache.loadedAt = time.Now()
+	}
+	return lookupIn(m.cache.byDomain, domain), nil
+}
+
+func (m UniversityModel) invalidate() {
+	m.cache.mu.Lock()
+	m.cache.byDomain = nil
+	m.cache.mu.Unlock()
+}
+
+// List returns universities ordered by name; disabled ones only if includeDisabled.
+func (m UniversityModel) List(includeDisabled bool) ([]University, error) {
+	var list []University
+	q := m.DB.Order("name")
+	if !includeDisabled {
+		q = q.Where("enabled = ?", true)
+	}
+	if err := q.Find(&list).Error; err != nil {
+		return nil, fmt.Errorf("List: %w", err)
+	}
+	return list, nil
+}
+
+func (m UniversityModel) Get(id uint) (*University, error) {
+	var u University
+	if err := m.DB.First(&u, id).Error; err != nil {
+		return nil, fmt.Errorf("Get: %w", err)
+	}
+	return &u, nil
+}
+
+func (m UniversityModel) Create(u *University) error {
+	if err := u.Normalize(); err != nil {
+		return fmt.Errorf("Create: %w", err)
+	}
+	if err := m.DB.Create(u).Error; err != nil {
+		return fmt.Errorf("Create: %w", err)
+	}
+	m.invalidate()
+	return nil
+}
+
+func (m UniversityModel) Update(u *University) error {
+	if err := u.Normalize(); err != nil {
+		return fmt.Errorf("Update: %w", err)
+	}
+	if err := m.DB.Model(u).Select("domain", "name", "campuses", "enabled").Updates(u).Error; err != nil {
+		return fmt.Errorf("Update: %w", err)
+	}
+	m.invalidate()
+	return nil
+}
+
+func (m UniversityModel) Delete(id uint) error {
+	res := m.DB.Delete(&University{}, id)
+	if res.Error != nil {
+		return fmt.Errorf("Delete: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("Delete: %w", gorm.ErrRecordNotFound)
+	}
+	m.invalidate()
+	return nil
+}
+
+// SeedDefaults inserts DefaultUniversities when the table is empty.
+func (m UniversityModel) SeedDefaults() error {
+	var count int64
+	if err := m.DB.Model(&University{}).Count(&count).Error; err != nil {
+		return fmt.Errorf("SeedDefaults: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	seed := make([]University, len(DefaultUniversities))
+	copy(seed, DefaultUniversities)
+	if err := m.DB.Create(&seed).Error; err != nil {
+		return fmt.Errorf("SeedDefaults: %w", err)
+	}
+	m.invalidate()
+	return nil
+}
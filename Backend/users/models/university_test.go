@@ -0,0 +1,86 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func newTestUniversityModel(t *testing.T) UniversityModel {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&University{}))
+	return NewUniversityModel(db)
+}
+
+func TestUniversityLookup(t *testing.T) {
+	m := newTestUniversityModel(t)
+	assert.NoError(t, m.SeedDefaults())
+	assert.NoError(t, m.SeedDefaults(), "seeding is a no-op once rows exist")
+
+	list, err := m.List(true)
+	assert.NoError(t, err)
+	assert.Len(t, list, len(DefaultUniversities))
+
+	u, err := m.LookupDomain("ufl.edu")
+	assert.NoError(t, err)
+	assert.Equal(t, "University of Florida", u.Name)
+	assert.Equal(t, CampusList{"Gainesville"}, u.Campuses)
+
+	u, err = m.LookupDomain("cise.ufl.edu")
+	assert.NoError(t, err)
+	if assert.NotNil(t, u, "subdomains resolve to their university") {
+		assert.Equal(t, "ufl.edu", u.Domain)
+	}
+
+	u, err = m.LookupDomain("notufl.edu")
+	assert.NoError(t, err)
+	assert.Nil(t, u)
+}
+
+func TestUniversityCRUDInvalidatesCache(t *testing.T) {
+	m := newTestUniversityModel(t)
+	m.CacheTTL = time.Hour
+
+	u, err := m.LookupDomain("gatech.edu")
+	assert.NoError(t, err)
+	assert.Nil(t, u)
+
+	gatech := &University{Domain: " GaTech.edu ", Name: "Georgia Tech", Campuses: CampusList{"Atlanta"}, Enabled: true}
+	assert.NoError(t, m.Create(gatech))
+	assert.Equal(t, "gatech.edu", gatech.Domain)
+	u, err = m.LookupDomain("gatech.edu")
+	assert.NoError(t, err)
+	assert.NotNil(t, u)
+
+	gatech.Enabled = false
+	assert.NoError(t, m.Update(gatech))
+	u, err = m.LookupDomain("gatech.edu")
+	assert.NoError(t, err)
+	assert.Nil(t, u, "disabled universities are not accepted")
+	enabled, err := m.List(false)
+	assert.NoError(t, err)
+	assert.Empty(t, enabled)
+
+	assert.NoError(t, m.Delete(gatech.ID))
+	assert.Error(t, m.Delete(gatech.ID))
+
+	assert.ErrorIs(t, m.Create(&University{Domain: "example.com", Name: "Not a school"}), ErrInvalidUniversity)
+}
+
+func TestValidateEduEmailUsesInstalledLookup(t *testing.T) {
+	assert.NoError(t, ValidateEduEmail("ellie@ufl.edu"))
+	assert.NoError(t, ValidateEduEmail("ellie@cise.ufl.edu"))
+	assert.Error(t, ValidateEduEmail("ellie@gatech.edu"))
+
+	m := newTestUniversityModel(t)
+	assert.NoError(t, m.Create(&University{Domain: "gatech.edu", Name: "Georgia Tech", Enabled: true}))
+	SetUniversityLookup(m)
+	defer SetUniversityLookup(nil)
+
+	assert.NoError(t, ValidateEduEmail("buzz@gatech.edu"))
+	assert.Error(t, ValidateEduEmail("ellie@ufl.edu"))
+}
@@ -6,40 +6,18 @@ import (
 	"fmt"
 	"log"
 	"net/mail"
-	"os"
 	"regexp"
-	"runtime"
 	"strings"
+	"time"
+	"users/mailer"
+	"users/sms"
 
 	"github.com/alexedwards/argon2id"
-	"github.com/sendgrid/sendgrid-go"
-	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/google/uuid"
 	passwordvalidator "github.com/wagslane/go-password-validator"
 	"gorm.io/gorm"
 )
 
-var validEDUDomains = map[string]bool{
-	"ufl.edu":         true,
-	"fsu.edu":         true,
-	"ucf.edu":         true,
-	"usf.edu":         true,
-	"fiu.edu":         true,
-	"fau.edu":         true,
-	"fgcu.edu":        true,
-	"unf.edu":         true,
-	"famu.edu":        true,
-	"ncf.edu":         true,
-	"floridapoly.edu": true,
-}
-
-var params = &argon2id.Params{
-	Memory:      128 * 1024,
-	Iterations:  4,
-	Parallelism: uint8(runtime.NumCPU()),
-	SaltLength:  16,
-	KeyLength:   32,
-}
-
 const minEntropyBits = 60
 
 var phoneRegex = regexp.MustCompile(`^\+?1?\d{10}$`)
@@ -57,10 +35,19 @@ func ValidatePhone(phone string) error {
 	return nil
 }
 
+// ValidatePassword rejects passwords with too little entropy and passwords
+// found in the breached-password corpus, if one is installed.
 func ValidatePassword(password string) error {
 	if err := passwordvalidator.Validate(password, minEntropyBits); err != nil {
 		return fmt.Errorf("password is too weak: %v", err)
 	}
+	found, err := IsBreachedPassword(password)
+	if err != nil {
+		return fmt.Errorf("checking breached passwords: %w", err)
+	}
+	if found {
+		return ErrBreachedPassword
+	}
 	return nil
 }
 
@@ -77,7 +64,11 @@ func ValidateEduEmail(email string) error {
 	if !strings.HasSuffix(domain, ".edu") {
 		return fmt.Errorf("invalid email: must be a .edu address")
 	}
-	if !validEDUDomains[domain] {
+	university, err := currentUniversityLookup().LookupDomain(domain)
+	if err != nil {
+		return fmt.Errorf("checking .edu domain: %w", err)
+	}
+	if university == nil {
 		return fmt.Errorf("unrecognized .edu domain: %s", domain)
 	}
 	return nil
@@ -95,64 +86,122 @@ func generateOTPCode() string {
 	return string(buf)
 }
 
+// HashPassword hashes password with the target PasswordParams.
 func HashPassword(password string) (string, error) {
-	return argon2id.CreateHash(password, params)
+	p := PasswordParams()
+	return argon2id.CreateHash(password, &p)
 }
 
 // User represents a user in the database.
-// Note: Password, OTPCode, FailedResetAttempts, and Verified are omitted from JSON output for security.
+// Note: Password, FailedResetAttempts, Verified, PendingEmail, PasswordBreached, the TOTP fields and the lifecycle fields are omitted from JSON output for security.
+// PasswordBreached is set when a login finds the password in the breach corpus and cleared when the password changes.
+// One-time codes live in the otps table, see OTP. Deleted users are soft-deleted
+// and hidden from queries by DeletedAt.
+//
+// UserID is assigned by the database sequence and is the ID other services
+// store: the JWT sub claim, messaging users.id and products UserId. PublicID
+// is a random UUID for places where a guessable, sequential ID should not leak.
 type User struct {
-	UserID              int    `gorm:"column:userid;primaryKey" json:"userid"`
-	Name                string `json:"name"`
-	Email               string `json:"email"`
-	Password            string `json:"-"`
-	OTPCode             string `json:"-"`
-	FailedResetAttempts int    `json:"-"`
-	Verified            bool   `json:"-"`
-	Phone               string `json:"phone"`
+	UserID              int            `gorm:"column:userid;primaryKey;autoIncrement" json:"userid"`
+	PublicID            string         `gorm:"column:public_id;uniqueIndex;not null" json:"public_id"`
+	Name                string         `json:"name"`
+	Email               string         `gorm:"index:idx_users_email_lower,unique,expression:lower(email),where:deleted_at IS NULL" json:"email"`
+	Password            string         `json:"-"`
+	FailedResetAttempts int            `json:"-"`
+	Verified            bool           `json:"-"`
+	Phone               string         `json:"phone"`
+	PhoneVerified       bool           `gorm:"not null;default:false" json:"phone_verified"`
+	TOTPSecret          string         `gorm:"column:totp_secret" json:"-"`
+	TOTPEnabled         bool           `gorm:"column:totp_enabled;not null;default:false" json:"-"`
+	TOTPLastStep        int64          `gorm:"column:totp_last_step;not null;default:0" json:"-"`
+	PasswordBreached    bool           `gorm:"not null;default:false" json:"-"`
+	PendingEmail        string         `json:"-"`
+	Role                Role           `gorm:"not null;default:student" json:"-"`
+	Status              AccountStatus  `gorm:"index" json:"-"`
+	LockedUntil         *time.Time     `json:"-"`
+	CreatedAt           time.Time      `json:"-"`
+	DeletedAt           gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// BeforeCreate assigns the public ID of a new user.
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	if u.PublicID == "" {
+		u.PublicID = uuid.NewString()
+	}
+	return nil
+}
+
+var ErrEmailTaken = errors.New("an account with this email already exists")
+
+// emailTaken turns a violation of the unique email index, hit when another
+// request claimed the address after it was checked, into ErrEmailTaken.
+func emailTaken(err error) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrEmailTaken
+	}
+	return err
 }
 
 type UserModel struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Mailer mailer.Mailer
+	// SMS sends phone verification codes; nil disables phone verification.
+	SMS    sms.SMSSender
+	OTPTTL time.Duration
+	// VerificationCooldown is how long too many wrong codes lock the account.
+	VerificationCooldown time.Duration
 }
 
-// Insert creates a new user record and emails an OTP.
-func (e UserModel) Insert(id int, name, email, password, phone string) error {
+// Insert creates a new user record and emails an OTP. The database assigns
+// the user's ID; the created user is returned.
+func (e UserModel) Insert(name, email, password, phone string) (*User, error) {
 	if err := ValidateEduEmail(email); err != nil {
-		return fmt.Errorf("Insert: %w", err)
+		return nil, fmt.Errorf("Insert: %w", err)
 	}
 	if err := ValidatePassword(password); err != nil {
-		return fmt.Errorf("Insert: %w", err)
+		return nil, fmt.Errorf("Insert: %w", err)
 	}
 	if err := ValidatePhone(phone); err != nil {
-		return fmt.Errorf("Insert: %w", err)
+		return nil, fmt.Errorf("Insert: %w", err)
+	}
+	var existing int64
+	if err := e.DB.Model(&User{}).Where("lower(email) = lower(?)", email).Count(&existing).Error; err != nil {
+		return nil, fmt.Errorf("Insert (checking email): %w", err)
+	}
+	if existing > 0 {
+		return nil, fmt.Errorf("Insert: %w", ErrEmailTaken)
 	}
 	hashedPassword, err := HashPassword(password)
 	if err != nil {
-		return fmt.Errorf("Insert (hashing password): %w", err)
+		return nil, fmt.Errorf("Insert (hashing password): %w", err)
 	}
 	user := User{
-		UserID:   id,
 		Name:     name,
 		Email:    email,
 		Password: hashedPassword,
 		Verified: false,
 		Phone:    phone,
+		Status:   StatusPending,
 	}
-	if err := e.DB.Create(&user).Error; err != nil {
-		return fmt.Errorf("Insert (creating user): %w", err)
+	err = e.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return emailTaken(err)
+		}
+		return enqueueUserEvent(tx, EventUserCreated, &user)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Insert (creating user): %w", err)
 	}
 
-	otpCode := generateOTPCode()
-	user.OTPCode = otpCode
-	if err := e.DB.Save(&user).Error; err != nil {
-		return fmt.Errorf("Insert (saving OTP): %w", err)
+	otpCode, err := e.IssueOTP(user.UserID, PurposeEmailVerification)
+	if err != nil {
+		return &user, fmt.Errorf("Insert (issuing OTP): %w", err)
 	}
 
-	if err := sendOTPEmail(email, otpCode, "Your UniBazaar OTP Code"); err != nil {
-		return fmt.Errorf("Insert (sending OTP email): %w", err)
+	if err := e.sendOTPEmail(email, otpCode, "Your UniBazaar OTP Code"); err != nil {
+		return &user, fmt.Errorf("Insert (sending OTP email): %w", err)
 	}
-	return nil
+	return &user, nil
 }
 
 // ResendOTP generates a new OTP for unverified accounts and emails it.
@@ -164,12 +213,14 @@ func (e UserModel) ResendOTP(email string) error {
 	if user.Verified {
 		return fmt.Errorf("ResendOTP: account already verified")
 	}
-	user.OTPCode = generateOTPCode()
-	user.FailedResetAttempts = 0
-	if err := e.DB.Save(user).Error; err != nil {
-		return fmt.Errorf("ResendOTP (save user): %w", err)
+	if user.CurrentStatus(time.Now()) == StatusLocked {
+		return fmt.Errorf("ResendOTP: %w", ErrAccountLocked)
+	}
+	otpCode, err := e.IssueOTP(user.UserID, PurposeEmailVerification)
+	if err != nil {
+		return fmt.Errorf("ResendOTP (issuing OTP): %w", err)
 	}
-	if err := sendOTPEmail(user.Email, user.OTPCode, "Your UniBazaar OTP Code"); err != nil {
+	if err := e.sendOTPEmail(user.Email, otpCode, "Your UniBazaar OTP Code"); err != nil {
 		return fmt.Errorf("ResendOTP (sending email): %w", err)
 	}
 	return nil
@@ -181,47 +232,80 @@ func (e UserModel) Update(email, newPassword string) error {
 	if err != nil {
 		return fmt.Errorf("Update (hash password): %w", err)
 	}
-	res := e.DB.Model(&User{}).Where("email = ?", email).Update("password", hashedPassword)
+	res := e.DB.Model(&User{}).Where("email = ?", email).
+		Updates(map[string]interface{}{"password": hashedPassword, "password_breached": false})
 	if res.Error != nil {
 		return fmt.Errorf("Update (DB update): %w", res.Error)
 	}
 	return nil
 }
 
-// UpdateName updates the user's name.
-func (e UserModel) UpdateName(email, newName string) error {
-	var user User
-	if err := e.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		return fmt.Errorf("UpdateName (finding user): %w", err)
-	}
-	user.Name = newName
-	if err := e.DB.Save(&user).Error; err != nil {
-		return fmt.Errorf("UpdateName (saving user): %w", err)
+// SetPasswordBreached records whether user's current password is in the
+// breach corpus.
+func (e UserModel) SetPasswordBreached(user *User, breached bool) error {
+	if err := e.DB.Model(user).Update("password_breached", breached).Error; err != nil {
+		return fmt.Errorf("SetPasswordBreached: %w", err)
 	}
+	user.PasswordBreached = breached
 	return nil
 }
 
-// UpdatePhone updates the user's phone number.
-func (e UserModel) UpdatePhone(email, newPhone string) error {
-	var user User
-	if err := e.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		return fmt.Errorf("UpdatePhone (finding user): %w", err)
+// UpdateProfile changes the user's name and/or phone; nil leaves a field as is.
+// A new phone number has to be verified again. Other services are notified
+// when the name or the phone's verified state changes.
+func (e UserModel) UpdateProfile(user *User, name, phone *string) error {
+	updates := map[string]interface{}{}
+	notify := name != nil
+	if phone != nil && *phone != user.Phone {
+		if err := ValidatePhone(*phone); err != nil {
+			return fmt.Errorf("UpdateProfile (validating phone): %w", err)
+		}
+		notify = notify || user.PhoneVerified
+		user.Phone, updates["phone"] = *phone, *phone
+		user.PhoneVerified, updates["phone_verified"] = false, false
+	}
+	if name != nil {
+		user.Name, updates["name"] = *name, *name
 	}
-	if err := ValidatePhone(newPhone); err != nil {
-		return fmt.Errorf("UpdatePhone (validating phone): %w", err)
+	if len(updates) == 0 {
+		return nil
 	}
-	user.Phone = newPhone
-	if err := e.DB.Save(&user).Error; err != nil {
-		return fmt.Errorf("UpdatePhone (saving user): %w", err)
+	err := e.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+		if _, changed := updates["phone"]; changed {
+			if err := tx.Where("userid = ? AND purpose = ?", user.UserID, PurposePhoneVerification).Delete(&OTP{}).Error; err != nil {
+				return err
+			}
+		}
+		if notify {
+			return enqueueUserEvent(tx, EventUserUpdated, user)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("UpdateProfile: %w", err)
 	}
 	return nil
 }
 
-// Delete removes a user by email.
+// Delete marks a user as deleted and soft-deletes the row.
 func (e UserModel) Delete(email string) error {
-	res := e.DB.Where("email = ?", email).Delete(&User{})
-	if res.Error != nil {
-		return fmt.Errorf("Delete (removing user): %w", res.Error)
+	err := e.DB.Transaction(func(tx *gorm.DB) error {
+		var users []User
+		if err := tx.Where("email = ?", email).Find(&users).Error; err != nil {
+			return err
+		}
+		for i := range users {
+			if err := deleteUser(tx, &users[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Delete (removing user): %w", err)
 	}
 	return nil
 }
@@ -236,6 +320,18 @@ func (e UserModel) Read(email string) (*User, error) {
 	return &user, nil
 }
 
+// ReadByPublicID finds a user by the UUID published in place of the numeric ID.
+func (e UserModel) ReadByPublicID(publicID string) (*User, error) {
+	if _, err := uuid.Parse(publicID); err != nil {
+		return nil, fmt.Errorf("ReadByPublicID: %w", gorm.ErrRecordNotFound)
+	}
+	var user User
+	if err := e.DB.Where("public_id = ?", publicID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("ReadByPublicID: %w", err)
+	}
+	return &user, nil
+}
+
 // ReadByID fetches a user by their numeric ID.
 func (e UserModel) ReadByID(id int) (*User, error) {
 	var user User
@@ -245,25 +341,28 @@ func (e UserModel) ReadByID(id int) (*User, error) {
 	return &user, nil
 }
 
-// UpdateVerificationStatus saves verification state.
+// UpdateVerificationStatus saves verification state. A verified account that
+// was pending, or whose cooling-off period has ended, becomes active.
 func (e UserModel) UpdateVerificationStatus(user *User) error {
+	if status := user.CurrentStatus(time.Now()); user.Verified && (status == StatusPending || status == StatusActive) {
+		user.Status = StatusActive
+		user.LockedUntil = nil
+	}
 	if err := e.DB.Model(user).Updates(map[string]interface{}{
-		"verified": user.Verified,
+		"verified":              user.Verified,
+		"failed_reset_attempts": user.FailedResetAttempts,
+		"status":                user.Status,
+		"locked_until":          user.LockedUntil,
 	}).Error; err != nil {
 		return fmt.Errorf("UpdateVerificationStatus: %w", err)
 	}
 	return nil
 }
 
-func (e UserModel) SaveUser(user *User) error {
-	if err := e.DB.Save(user).Error; err != nil {
-		return fmt.Errorf("SaveUser: %w", err)
-	}
-	return nil
-}
-
-func (e UserModel) SendSecurityAlert(user *User) error {
-	if err := sendOTPEmail(user.Email, "Suspicious attempts detected", "UniBazaar Security Alert"); err != nil {
+// SendSecurityAlert warns user of suspicious attempts on their account;
+// reason says what triggered it.
+func (e UserModel) SendSecurityAlert(user *User, reason string) error {
+	if err := e.sendSecurityAlert(user, reason); err != nil {
 		return fmt.Errorf("SendSecurityAlert: %w", err)
 	}
 	return nil
@@ -283,16 +382,14 @@ func (e UserModel) InitiatePasswordReset(email string) error {
 	if err != nil {
 		return fmt.Errorf("InitiatePasswordReset (read user): %w", err)
 	}
-	user.FailedResetAttempts = 0
-	if err := e.DB.Save(user).Error; err != nil {
-		return fmt.Errorf("InitiatePasswordReset (save reset attempts): %w", err)
+	if user.CurrentStatus(time.Now()) == StatusLocked {
+		return fmt.Errorf("InitiatePasswordReset: %w", ErrAccountLocked)
 	}
-	otpCode := generateOTPCode()
-	user.OTPCode = otpCode
-	if err := e.DB.Save(user).Error; err != nil {
-		return fmt.Errorf("InitiatePasswordReset (save OTP): %w", err)
+	otpCode, err := e.IssueOTP(user.UserID, PurposePasswordReset)
+	if err != nil {
+		return fmt.Errorf("InitiatePasswordReset (issuing OTP): %w", err)
 	}
-	if err := sendOTPEmail(email, otpCode, "UniBazaar Password Reset Code"); err != nil {
+	if err := e.sendOTPEmail(email, otpCode, "UniBazaar Password Reset Code"); err != nil {
 		return fmt.Errorf("InitiatePasswordReset (sending email): %w", err)
 	}
 	return nil
@@ -303,57 +400,67 @@ func (e UserModel) VerifyResetCodeAndSetNewPassword(email, code, newPassword str
 	if err != nil {
 		return fmt.Errorf("VerifyResetCodeAndSetNewPassword (read user): %w", err)
 	}
-	if user.OTPCode != code {
-		user.FailedResetAttempts++
-		if user.FailedResetAttempts >= 3 {
-			_ = sendOTPEmail(user.Email, "Suspicious attempts detected", "UniBazaar Security Alert")
-			user.FailedResetAttempts = 0
-			user.OTPCode = ""
-		}
-		if saveErr := e.DB.Save(user).Error; saveErr != nil {
-			return fmt.Errorf("VerifyResetCodeAndSetNewPassword (save user on invalid code): %w", saveErr)
-		}
-		return fmt.Errorf("invalid OTP code")
+	if user.CurrentStatus(time.Now()) == StatusLocked {
+		return fmt.Errorf("VerifyResetCodeAndSetNewPassword: %w", ErrAccountLocked)
 	}
-	user.FailedResetAttempts = 0
+	// Validate before redeeming so a weak password does not burn the code.
 	if err := ValidatePassword(newPassword); err != nil {
 		return fmt.Errorf("VerifyResetCodeAndSetNewPassword (validate password): %w", err)
 	}
+	if err := e.ConsumeOTP(user.UserID, PurposePasswordReset, code); err != nil {
+		if !errors.Is(err, ErrOTPInvalid) {
+			return fmt.Errorf("VerifyResetCodeAndSetNewPassword: %w", err)
+		}
+		if _, recordErr := e.RecordFailedCode(user, PurposePasswordReset); recordErr != nil {
+			return fmt.Errorf("VerifyResetCodeAndSetNewPassword (recording wrong code): %w", recordErr)
+		}
+		return err
+	}
 	hashed, err := HashPassword(newPassword)
 	if err != nil {
 		return fmt.Errorf("VerifyResetCodeAndSetNewPassword (hash password): %w", err)
 	}
-	user.Password = hashed
-	user.OTPCode = ""
-	if err := e.DB.Save(user).Error; err != nil {
+	if err := e.DB.Model(&User{}).Where("userid = ?", user.UserID).Updates(map[string]interface{}{
+		"password":              hashed,
+		"password_breached":     false,
+		"failed_reset_attempts": 0,
+	}).Error; err != nil {
 		return fmt.Errorf("VerifyResetCodeAndSetNewPassword (save new password): %w", err)
 	}
+	user.Password, user.PasswordBreached, user.FailedResetAttempts = hashed, false, 0
 	return nil
 }
 
-// sendOTPEmail sends an email through SendGrid.
-func sendOTPEmail(toEmail, code, subject string) error {
-	from := sgmail.NewEmail("UniBazaar Support", "unibazaar.marketplace@gmail.com")
-	to := sgmail.NewEmail("User", toEmail)
-	plainText := fmt.Sprintf("Your code is %s.\nIt expires in 5 minutes.", code)
-	htmlContent := fmt.Sprintf("<strong>Your code is %s</strong><br>It expires in 5 minutes.", code)
-	message := sgmail.NewSingleEmail(from, subject, to, plainText, htmlContent)
-
-	client := sendgrid.NewSendClient(os.Getenv("SENDGRID_API_KEY"))
-	response, err := client.Send(message)
-	if err != nil {
+// sendOTPEmail sends a one-time code through the configured Mailer.
+func (e UserModel) sendOTPEmail(toEmail, code, subject string) error {
+	expiresIn := fmt.Sprintf("%d minutes", int(e.otpTTL().Minutes()))
+	msg := mailer.Message{
+		To:      toEmail,
+		Subject: subject,
+		Text:    fmt.Sprintf("Your code is %s.\nIt expires in %s.", code, expiresIn),
+		HTML:    fmt.Sprintf("<strong>Your code is %s</strong><br>It expires in %s.", code, expiresIn),
+	}
+	if err := e.Mailer.Send(msg); err != nil {
 		log.Println("Failed to send email:", err)
 		return fmt.Errorf("sendOTPEmail: %w", err)
 	}
-	log.Printf("Email sent. Status Code: %d\n", response.StatusCode)
 	return nil
 }
 
-// CreateUser builds a lightweight User object (without password) for JWT generation.
-func CreateUser(name, email, phone string) *User {
-	return &User{
-		Name:  name,
-		Email: email,
-		Phone: phone,
+// sendSecurityAlert emails the account owner about repeated failed code or
+// login attempts and records the alert in the auth_events table.
+func (e UserModel) sendSecurityAlert(user *User, reason string) error {
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "UniBazaar Security Alert",
+		Text:    "Suspicious attempts detected.\nSeveral failed attempts to access your UniBazaar account were detected. If this wasn't you, please reset your password.",
+		HTML:    "<strong>Suspicious attempts detected.</strong><br>Several failed attempts to access your UniBazaar account were detected. If this wasn't you, please reset your password.",
+	}
+	err := e.Mailer.Send(msg)
+	e.recordSecurityAlert(user, reason, err)
+	if err != nil {
+		log.Println("Failed to send email:", err)
+		return fmt.Errorf("sendSecurityAlert: %w", err)
 	}
+	return nil
 }
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/alexedwards/argon2id"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestInsertRejectsTakenEmail(t *testing.T) {
+	assert.NoError(t, SetPasswordParams(lightParams))
+	defer func() { _ = SetPasswordParams(DefaultPasswordParams) }()
+	m := newTestUserModel(t)
+	const password = "Unique-Email-Checks-2025"
+
+	_, err := m.Insert("Ana Lopez", "ana@ufl.edu", password, "")
+	assert.NoError(t, err)
+	_, err = m.Insert("Ana Again", "ANA@ufl.edu", password, "")
+	assert.ErrorIs(t, err, ErrEmailTaken, "emails are compared case-insensitively")
+
+	// Another sign-up for the address lands between the check and the insert.
+	raced := false
+	assert.NoError(t, m.DB.Callback().Create().Before("gorm:create").Register("test:race", func(tx *gorm.DB) {
+		if user, ok := tx.Statement.Dest.(*User); ok && user.Email == "raced@ufl.edu" && !raced {
+			raced = true
+			tx.Session(&gorm.Session{NewDB: true}).Exec(
+				"INSERT INTO users (public_id, name, email, status) VALUES (?, ?, ?, ?)",
+				"00000000-0000-4000-8000-000000000001", "Rae First", "Raced@ufl.edu", StatusPending)
+		}
+	}))
+	_, err = m.Insert("Rae Second", "raced@ufl.edu", password, "")
+	assert.True(t, raced)
+	assert.ErrorIs(t, err, ErrEmailTaken, "the unique index catches what the check missed")
+	var count int64
+	m.DB.Model(&User{}).Where("name = ?", "Rae Second").Count(&count)
+	assert.Zero(t, count)
+
+	var deleted User
+	assert.NoError(t, m.DB.Where("email = ?", "ana@ufl.edu").First(&deleted).Error)
+	assert.NoError(t, m.DB.Delete(&deleted).Error)
+	_, err = m.Insert("Ana Lopez", "ana@ufl.edu", password, "")
+	assert.NoError(t, err, "a deleted account does not hold on to its address")
+}
+
+func TestCodeChecksOnlyWriteTheirOwnColumns(t *testing.T) {
+	assert.NoError(t, SetPasswordParams(lightParams))
+	defer func() { _ = SetPasswordParams(DefaultPasswordParams) }()
+	m := newTestUserModel(t)
+	user := &User{UserID: 1, Name: "Cleo Park", Email: "cleo@ufl.edu", Verified: true, Status: StatusActive}
+	assert.NoError(t, m.DB.Create(user).Error)
+
+	// Another request changes the phone number after user was read.
+	assert.NoError(t, m.DB.Callback().Update().Before("gorm:update").Register("test:concurrent", func(tx *gorm.DB) {
+		tx.Session(&gorm.Session{NewDB: true}).Exec("UPDATE users SET phone = ? WHERE userid = ?", "352-555-0101", user.UserID)
+	}))
+	stale := *user
+	_, err := m.recordFailedProfileCode(&stale, PurposeEmailChange)
+	assert.NoError(t, err)
+	code, err := m.IssueOTP(user.UserID, PurposePasswordReset)
+	assert.NoError(t, err)
+	assert.NoError(t, m.VerifyResetCodeAndSetNewPassword("cleo@ufl.edu", code, "Fresh-Password-2025"))
+
+	var got User
+	assert.NoError(t, m.DB.First(&got, user.UserID).Error)
+	assert.Equal(t, "352-555-0101", got.Phone, "the concurrent change survives")
+	assert.Zero(t, got.FailedResetAttempts)
+	match, _ := argon2id.ComparePasswordAndHash("Fresh-Password-2025", got.Password)
+	assert.True(t, match)
+}
@@ -3,16 +3,36 @@ package server
 import (
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	config "users/config"
+	events "users/events"
 	handler "users/handler"
+	mailer "users/mailer"
+	migrations "users/migrations"
 	models "users/models"
+	sms "users/sms"
+	utils "users/utils"
 
+	"github.com/alexedwards/argon2id"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/joho/godotenv" // go get github.com/joho/godotenv
+	"gorm.io/gorm"
 )
 
+// defaultUnverifiedAccountTTL is how long a sign-up may stay unverified before
+// the account is removed.
+const defaultUnverifiedAccountTTL = 7 * 24 * time.Hour
+
+// deliveredEventRetention is how long delivered outbox events are kept.
+const deliveredEventRetention = 7 * 24 * time.Hour
+
 func InitServer() {
 	if err := godotenv.Load(); err != nil {
 		log.Println("no .env file found relying on real environment variables")
@@ -24,11 +44,148 @@ func InitServer() {
 	}
 
 	conn := config.Connect(dsn)
+	if conn == nil {
+		log.Fatal("could not connect to database")
+	}
+	if os.Getenv("MIGRATE_ON_START") != "false" {
+		if err := migrateUp(conn); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	keys, err := utils.KeySetFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	utils.SetKeySet(keys)
+
+	mail, err := mailer.New(mailer.ConfigFromEnv())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	appModels := models.NewModels(conn, mail)
+	texts, err := sms.New(sms.ConfigFromEnv())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if texts == nil {
+		log.Println("SMS_BACKEND is not set, phone verification is disabled")
+	}
+	appModels.UserModel.SMS = texts
+	if rpID := os.Getenv("WEBAUTHN_RP_ID"); rpID != "" {
+		name := os.Getenv("WEBAUTHN_RP_NAME")
+		if name == "" {
+			name = "UniBazaar"
+		}
+		var origins []string
+		for _, origin := range strings.Split(os.Getenv("WEBAUTHN_RP_ORIGINS"), ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				origins = append(origins, origin)
+			}
+		}
+		wa, err := webauthn.New(&webauthn.Config{
+			RPID:          rpID,
+			RPDisplayName: name,
+			RPOrigins:     origins,
+			AuthenticatorSelection: protocol.AuthenticatorSelection{
+				UserVerification: protocol.VerificationRequired,
+			},
+		})
+		if err != nil {
+			log.Fatalf("invalid WebAuthn configuration: %v", err)
+		}
+		appModels.Passkeys.WebAuthn = wa
+	} else {
+		log.Println("WEBAUTHN_RP_ID is not set, passkeys are disabled")
+	}
+	if err := appModels.Universities.SeedDefaults(); err != nil {
+		log.Fatal(err)
+	}
+	models.SetUniversityLookup(appModels.Universities)
+	if err := models.SetPasswordParams(passwordParamsFromEnv()); err != nil {
+		log.Fatal(err)
+	}
+	if dir := os.Getenv("BREACHED_PASSWORDS_DIR"); dir != "" {
+		corpus, err := models.OpenBreachCorpus(dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		models.SetBreachedPasswords(corpus)
+	} else {
+		log.Println("BREACHED_PASSWORDS_DIR is not set, passwords are not checked against known breaches")
+	}
+	if ttl := os.Getenv("OTP_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatalf("invalid OTP_TTL %q: %v", ttl, err)
+		}
+		appModels.UserModel.OTPTTL = d
+	}
+	if cooldown := os.Getenv("VERIFICATION_COOLDOWN"); cooldown != "" {
+		d, err := time.ParseDuration(cooldown)
+		if err != nil {
+			log.Fatalf("invalid VERIFICATION_COOLDOWN %q: %v", cooldown, err)
+		}
+		appModels.UserModel.VerificationCooldown = d
+	}
+	unverifiedTTL := defaultUnverifiedAccountTTL
+	if ttl := os.Getenv("UNVERIFIED_ACCOUNT_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatalf("invalid UNVERIFIED_ACCOUNT_TTL %q: %v", ttl, err)
+		}
+		unverifiedTTL = d
+	}
+	if ttl := os.Getenv("REFRESH_TOKEN_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatalf("invalid REFRESH_TOKEN_TTL %q: %v", ttl, err)
+		}
+		appModels.RefreshTokens.TTL = d
+	}
+
+	if path := os.Getenv("SERVICE_ACCOUNTS_FILE"); path != "" {
+		accounts, err := models.LoadServiceAccounts(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		appModels.ServiceAccounts = accounts
+	}
 
 	app := handler.Application{
-		Models: models.NewModels(conn),
+		Models:   appModels,
+		TestMode: os.Getenv("AUTH_TEST_MODE") == "true",
+		// Azure App Service and other reverse proxies set X-Forwarded-For.
+		TrustProxyHeaders: os.Getenv("TRUST_PROXY_HEADERS") == "true",
+	}
+	if app.TestMode {
+		log.Println("WARNING: AUTH_TEST_MODE is enabled, /getjwt issues tokens without credentials")
 	}
 
+	go prunePeriodically("expired token revocations", appModels.TokenRevocations.Prune, time.Hour)
+	go prunePeriodically("stale login attempts", appModels.LoginThrottle.Prune, time.Hour)
+	go prunePeriodically("expired login challenges", appModels.TwoFactor.PruneChallenges, time.Hour)
+	go prunePeriodically("expired passkey ceremonies", appModels.Passkeys.PruneCeremonies, time.Hour)
+	go prunePeriodically("ended sessions", appModels.SessionModel.Prune, time.Hour)
+	go prunePeriodically("unverified accounts", func() (int64, error) {
+		return appModels.UserModel.PurgeUnverified(unverifiedTTL)
+	}, time.Hour)
+	go prunePeriodically("delivered outbox events", func() (int64, error) {
+		return appModels.Outbox.Prune(deliveredEventRetention)
+	}, time.Hour)
+
+	relayInterval := 5 * time.Second
+	if v := os.Getenv("OUTBOX_RELAY_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("invalid OUTBOX_RELAY_INTERVAL %q: %v", v, err)
+		}
+		relayInterval = d
+	}
+	startRelay(appModels.Outbox, models.DestinationMessaging, os.Getenv("MESSAGING_SERVICE_URL"), relayInterval)
+	startRelay(appModels.Outbox, models.DestinationProducts, os.Getenv("PRODUCTS_SERVICE_URL"), relayInterval)
+
 	fmt.Println("connected to database")
 
 	port := os.Getenv("PORT")
@@ -51,3 +208,74 @@ func InitServer() {
 		log.Fatal(err)
 	}
 }
+
+// passwordParamsFromEnv overrides models.DefaultPasswordParams with
+// ARGON2_MEMORY_KIB, ARGON2_ITERATIONS and ARGON2_PARALLELISM.
+func passwordParamsFromEnv() argon2id.Params {
+	p := models.DefaultPasswordParams
+	for _, setting := range []struct {
+		name string
+		max  uint64
+		set  func(uint64)
+	}{
+		{"ARGON2_MEMORY_KIB", math.MaxUint32, func(v uint64) { p.Memory = uint32(v) }},
+		{"ARGON2_ITERATIONS", math.MaxUint32, func(v uint64) { p.Iterations = uint32(v) }},
+		{"ARGON2_PARALLELISM", math.MaxUint8, func(v uint64) { p.Parallelism = uint8(v) }},
+	} {
+		raw := os.Getenv(setting.name)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil || v > setting.max {
+			log.Fatalf("invalid %s %q", setting.name, raw)
+		}
+		setting.set(v)
+	}
+	return p
+}
+
+// migrateUp applies pending schema migrations. Replicas starting together
+// wait on each other through the migrator's advisory lock.
+func migrateUp(conn *gorm.DB) error {
+	db, err := conn.DB()
+	if err != nil {
+		return err
+	}
+	m, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+	applied, err := m.Up()
+	for _, mig := range applied {
+		log.Printf("applied migration %04d_%s\n", mig.Version, mig.Name)
+	}
+	return err
+}
+
+// startRelay delivers user events for destination to the service at baseURL.
+// Without a URL the events wait in the outbox until one is configured.
+func startRelay(outbox models.OutboxModel, destination, baseURL string, interval time.Duration) {
+	if baseURL == "" {
+		log.Printf("no URL configured for the %s service, its user events will queue in the outbox\n", destination)
+		return
+	}
+	relay := events.NewRelay(outbox, destination, strings.TrimRight(baseURL, "/")+"/internal/user-events")
+	go relay.Run(interval)
+}
+
+// prunePeriodically runs prune every interval, logging what was removed.
+func prunePeriodically(what string, prune func() (int64, error), interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		removed, err := prune()
+		if err != nil {
+			log.Printf("failed to prune %s: %v\n", what, err)
+			continue
+		}
+		if removed > 0 {
+			log.Printf("pruned %d %s\n", removed, what)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package sms
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FileSender writes every message as a .txt file into Dir instead of sending
+// it, so local and CI runs can inspect what would have been sent.
+type FileSender struct {
+	Dir string
+}
+
+func (s *FileSender) Send(msg Message) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return fmt.Errorf("FileSender (creating dir): %w", err)
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("FileSender: %w", err)
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s.txt", now.UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	body := fmt.Sprintf("To: %s\nDate: %s\n\n%s\n", msg.To, now.Format(time.RFC1123Z), msg.Body)
+	if err := os.WriteFile(filepath.Join(s.Dir, name), []byte(body), 0o644); err != nil {
+		return fmt.Errorf("FileSender (writing file): %w", err)
+	}
+	return nil
+}
+
+// Messages returns the paths of all .txt files in Dir, oldest first.
+func (s *FileSender) Messages() ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("FileSender (reading dir): %w", err)
+	}
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".txt") {
+			paths = append(paths, filepath.Join(s.Dir, entry.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
@@ -0,0 +1,12 @@
+package sms
+
+import "log"
+
+// LogSender writes every message to the process log. For local development
+// only: the log then contains the verification codes.
+type LogSender struct{}
+
+func (LogSender) Send(msg Message) error {
+	log.Printf("SMS to %s: %s\n", msg.To, msg.Body)
+	return nil
+}
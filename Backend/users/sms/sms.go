@@ -0,0 +1,66 @@
+package sms
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Message is a single text message. To is an E.164 number such as +13525551234.
+type Message struct {
+	To   string
+	Body string
+}
+
+// SMSSender delivers text messages. UserModel only depends on this interface
+// so phone verification can run without a live gateway.
+type SMSSender interface {
+	Send(msg Message) error
+}
+
+// Config selects and configures an SMSSender backend.
+type Config struct {
+	Backend string // "twilio", "log" or "file"; empty disables SMS
+
+	TwilioAccountSID string
+	TwilioAuthToken  string
+	TwilioFrom       string
+
+	DropDir string
+}
+
+// ConfigFromEnv reads the SMS configuration from environment variables.
+// Unlike the mailer there is no default backend: SMS costs money per message
+// and the log backend prints codes, so both have to be chosen explicitly.
+func ConfigFromEnv() Config {
+	return Config{
+		Backend:          strings.ToLower(strings.TrimSpace(os.Getenv("SMS_BACKEND"))),
+		TwilioAccountSID: os.Getenv("TWILIO_ACCOUNT_SID"),
+		TwilioAuthToken:  os.Getenv("TWILIO_AUTH_TOKEN"),
+		TwilioFrom:       os.Getenv("TWILIO_FROM_NUMBER"),
+		DropDir:          os.Getenv("SMS_DROP_DIR"),
+	}
+}
+
+// New builds the SMSSender selected by cfg.Backend. It returns nil without an
+// error when no backend is configured.
+func New(cfg Config) (SMSSender, error) {
+	switch cfg.Backend {
+	case "":
+		return nil, nil
+	case "twilio":
+		if cfg.TwilioAccountSID == "" || cfg.TwilioAuthToken == "" || cfg.TwilioFrom == "" {
+			return nil, fmt.Errorf("sms: TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM_NUMBER are required for the twilio backend")
+		}
+		return &TwilioSender{AccountSID: cfg.TwilioAccountSID, AuthToken: cfg.TwilioAuthToken, From: cfg.TwilioFrom}, nil
+	case "log":
+		return LogSender{}, nil
+	case "file":
+		if cfg.DropDir == "" {
+			return nil, fmt.Errorf("sms: SMS_DROP_DIR is required for the file backend")
+		}
+		return &FileSender{Dir: cfg.DropDir}, nil
+	default:
+		return nil, fmt.Errorf("sms: unknown backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,66 @@
+package sms
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	sender, err := New(Config{})
+	assert.NoError(t, err)
+	assert.Nil(t, sender, "SMS is disabled without a backend")
+
+	_, err = New(Config{Backend: "twilio"})
+	assert.Error(t, err)
+	_, err = New(Config{Backend: "file"})
+	assert.Error(t, err)
+	_, err = New(Config{Backend: "carrier-pigeon"})
+	assert.Error(t, err)
+
+	sender, err = New(Config{Backend: "log"})
+	assert.NoError(t, err)
+	assert.IsType(t, LogSender{}, sender)
+}
+
+func TestFileSender(t *testing.T) {
+	s := &FileSender{Dir: t.TempDir()}
+	require.NoError(t, s.Send(Message{To: "+13525551234", Body: "first"}))
+	require.NoError(t, s.Send(Message{To: "+13525551234", Body: "second"}))
+
+	paths, err := s.Messages()
+	require.NoError(t, err)
+	require.Len(t, paths, 2)
+	raw, err := os.ReadFile(paths[1])
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), "To: +13525551234")
+	assert.Contains(t, string(raw), "second")
+}
+
+func TestTwilioSender(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/2010-04-01/Accounts/AC123/Messages.json", r.URL.Path)
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "AC123", user)
+		assert.Equal(t, "secret", pass)
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "+13525551234", r.PostForm.Get("To"))
+		assert.Equal(t, "+15550000000", r.PostForm.Get("From"))
+		if r.PostForm.Get("Body") == "fail" {
+			http.Error(w, `{"message":"invalid number"}`, http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	s := &TwilioSender{AccountSID: "AC123", AuthToken: "secret", From: "+15550000000", BaseURL: srv.URL}
+	assert.NoError(t, s.Send(Message{To: "+13525551234", Body: "hello"}))
+	err := s.Send(Message{To: "+13525551234", Body: "fail"})
+	assert.ErrorContains(t, err, "invalid number")
+}
@@ -0,0 +1,51 @@
+package sms
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const twilioBaseURL = "https://api.twilio.com"
+
+// TwilioSender sends text messages through the Twilio Messages API.
+type TwilioSender struct {
+	AccountSID string
+	AuthToken  string
+	From       string
+	// BaseURL overrides the API host, for tests.
+	BaseURL string
+	Client  *http.Client
+}
+
+func (s *TwilioSender) Send(msg Message) error {
+	base := s.BaseURL
+	if base == "" {
+		base = twilioBaseURL
+	}
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	form := url.Values{"To": {msg.To}, "From": {s.From}, "Body": {msg.Body}}
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", base, url.PathEscape(s.AccountSID))
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("TwilioSender: %w", err)
+	}
+	req.SetBasicAuth(s.AccountSID, s.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("TwilioSender: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("TwilioSender: unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
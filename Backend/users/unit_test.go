@@ -12,9 +12,12 @@ type MockUserModel struct {
 	mock.Mock
 }
 
-func (m *MockUserModel) Insert(id int, name, email, password, phone string) error {
-	args := m.Called(id, name, email, password, phone)
-	return args.Error(0)
+func (m *MockUserModel) Insert(name, email, password, phone string) (*models.User, error) {
+	args := m.Called(name, email, password, phone)
+	if args.Get(0) != nil {
+		return args.Get(0).(*models.User), args.Error(1)
+	}
+	return nil, args.Error(1)
 }
 
 func (m *MockUserModel) Read(email string) (*models.User, error) {
@@ -25,13 +28,8 @@ func (m *MockUserModel) Read(email string) (*models.User, error) {
 	return nil, args.Error(1)
 }
 
-func (m *MockUserModel) UpdateName(email, newName string) error {
-	args := m.Called(email, newName)
-	return args.Error(0)
-}
-
-func (m *MockUserModel) UpdatePhone(email, newPhone string) error {
-	args := m.Called(email, newPhone)
+func (m *MockUserModel) UpdateProfile(user *models.User, name, phone *string) error {
+	args := m.Called(user, name, phone)
 	return args.Error(0)
 }
 
@@ -52,9 +50,11 @@ func (m *MockUserModel) VerifyResetCodeAndSetNewPassword(email, code, newPasswor
 
 func TestUserInsert(t *testing.T) {
 	mockUserModel := new(MockUserModel)
-	mockUserModel.On("Insert", 1, "John Doe", "john@ufl.edu", "StrongP@ssw0rd!", "5551234567").Return(nil)
-	err := mockUserModel.Insert(1, "John Doe", "john@ufl.edu", "StrongP@ssw0rd!", "5551234567")
+	created := &models.User{UserID: 1, Name: "John Doe", Email: "john@ufl.edu"}
+	mockUserModel.On("Insert", "John Doe", "john@ufl.edu", "StrongP@ssw0rd!", "5551234567").Return(created, nil)
+	user, err := mockUserModel.Insert("John Doe", "john@ufl.edu", "StrongP@ssw0rd!", "5551234567")
 	assert.Nil(t, err)
+	assert.Equal(t, 1, user.UserID)
 	mockUserModel.AssertExpectations(t)
 }
 
@@ -74,18 +74,12 @@ func TestUserRead(t *testing.T) {
 	mockUserModel.AssertExpectations(t)
 }
 
-func TestUpdateUserName(t *testing.T) {
-	mockUserModel := new(MockUserModel)
-	mockUserModel.On("UpdateName", "john@ufl.edu", "Johnathan Doe").Return(nil)
-	err := mockUserModel.UpdateName("john@ufl.edu", "Johnathan Doe")
-	assert.Nil(t, err)
-	mockUserModel.AssertExpectations(t)
-}
-
-func TestUpdateUserPhone(t *testing.T) {
+func TestUpdateUserProfile(t *testing.T) {
 	mockUserModel := new(MockUserModel)
-	mockUserModel.On("UpdatePhone", "john@ufl.edu", "5559998888").Return(nil)
-	err := mockUserModel.UpdatePhone("john@ufl.edu", "5559998888")
+	user := &models.User{UserID: 1, Email: "john@ufl.edu"}
+	name, phone := "Johnathan Doe", "5559998888"
+	mockUserModel.On("UpdateProfile", user, &name, &phone).Return(nil)
+	err := mockUserModel.UpdateProfile(user, &name, &phone)
 	assert.Nil(t, err)
 	mockUserModel.AssertExpectations(t)
 }
@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// SigningKey is a private key used to sign access tokens, identified by the
+// kid header of the tokens it signs.
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	Key    crypto.Signer
+}
+
+// KeySet holds every key the service currently publishes. Tokens are signed
+// with the active key; all keys stay valid for verification so that tokens
+// signed before a rotation keep working until they expire.
+type KeySet struct {
+	active string
+	keys   map[string]SigningKey
+}
+
+// NewKeySet builds a KeySet that signs with the key identified by activeID.
+func NewKeySet(activeID string, keys ...SigningKey) (*KeySet, error) {
+	ks := &KeySet{active: activeID, keys: make(map[string]SigningKey, len(keys))}
+	for _, k := range keys {
+		if _, dup := ks.keys[k.ID]; dup {
+			return nil, fmt.Errorf("NewKeySet: duplicate key id %q", k.ID)
+		}
+		ks.keys[k.ID] = k
+	}
+	if _, ok := ks.keys[activeID]; !ok {
+		return nil, fmt.Errorf("NewKeySet: active key %q not found", activeID)
+	}
+	return ks, nil
+}
+
+// NewSigningKey wraps an RSA or Ed25519 private key, picking RS256 or EdDSA.
+func NewSigningKey(id string, key crypto.Signer) (SigningKey, error) {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return SigningKey{ID: id, Method: jwt.SigningMethodRS256, Key: key}, nil
+	case ed25519.PrivateKey:
+		return SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, Key: key}, nil
+	default:
+		return SigningKey{}, fmt.Errorf("NewSigningKey (%s): unsupported key type %T", id, key)
+	}
+}
+
+// GenerateEd25519Key creates a fresh Ed25519 signing key with a random kid.
+func GenerateEd25519Key() (SigningKey, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("GenerateEd25519Key: %w", err)
+	}
+	return NewSigningKey(uuid.NewString(), priv)
+}
+
+// LoadKeySet reads every *.pem private key in dir; the file name without its
+// extension is the kid. activeID selects the signing key and defaults to the
+// last kid in lexical order, so date-prefixed names rotate naturally.
+func LoadKeySet(dir, activeID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("LoadKeySet (%s): %w", dir, err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("LoadKeySet (%s): no .pem keys found", dir)
+	}
+	sort.Strings(paths)
+
+	keys := make([]SigningKey, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("LoadKeySet (%s): %w", path, err)
+		}
+		signer, err := parsePrivateKeyPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("LoadKeySet (%s): %w", path, err)
+		}
+		key, err := NewSigningKey(strings.TrimSuffix(filepath.Base(path), ".pem"), signer)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if activeID == "" {
+		activeID = keys[len(keys)-1].ID
+	}
+	return NewKeySet(activeID, keys...)
+}
+
+func parsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported key type %T", key)
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("expected a PKCS#8 or PKCS#1 private key")
+}
+
+// Active returns the key new tokens are signed with.
+func (ks *KeySet) Active() SigningKey {
+	return ks.keys[ks.active]
+}
+
+// PublicKey returns the verification key for kid.
+func (ks *KeySet) PublicKey(kid string) (crypto.PublicKey, jwt.SigningMethod, bool) {
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, nil, false
+	}
+	return k.Key.Public(), k.Method, true
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every key in the set, active key first.
+func (ks *KeySet) JWKS() JWKS {
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		if id != ks.active {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	ids = append([]string{ks.active}, ids...)
+
+	doc := JWKS{Keys: make([]JWK, 0, len(ids))}
+	for _, id := range ids {
+		k := ks.keys[id]
+		jwk := JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Method.Alg()}
+		switch pub := k.Key.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		doc.Keys = append(doc.Keys, jwk)
+	}
+	return doc
+}
+
+var (
+	keySetMu sync.RWMutex
+	keySet   *KeySet
+)
+
+// SetKeySet installs the key set used by GenerateJWT and ParseJWT.
+func SetKeySet(ks *KeySet) {
+	keySetMu.Lock()
+	defer keySetMu.Unlock()
+	keySet = ks
+}
+
+// CurrentKeySet returns the installed key set. If none was installed (tests,
+// local development) an ephemeral Ed25519 key is generated on first use.
+func CurrentKeySet() *KeySet {
+	keySetMu.RLock()
+	ks := keySet
+	keySetMu.RUnlock()
+	if ks != nil {
+		return ks
+	}
+
+	keySetMu.Lock()
+	defer keySetMu.Unlock()
+	if keySet == nil {
+		key, err := GenerateEd25519Key()
+		if err != nil {
+			panic(err)
+		}
+		keySet, _ = NewKeySet(key.ID, key)
+	}
+	return keySet
+}
+
+// KeySetFromEnv loads keys from JWT_KEYS_DIR, signing with JWT_ACTIVE_KEY_ID.
+// Without JWT_KEYS_DIR it fails, unless JWT_EPHEMERAL_KEY=true asks for a
+// throwaway key for local development; tokens signed with it do not survive a
+// restart and are not accepted by other replicas.
+func KeySetFromEnv() (*KeySet, error) {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		if os.Getenv("JWT_EPHEMERAL_KEY") != "true" {
+			return nil, errors.New("KeySetFromEnv: JWT_KEYS_DIR is not set (set JWT_EPHEMERAL_KEY=true to use a throwaway key in development)")
+		}
+		log.Println("WARNING: JWT_EPHEMERAL_KEY is enabled, signing tokens with a throwaway key")
+		key, err := GenerateEd25519Key()
+		if err != nil {
+			return nil, err
+		}
+		return NewKeySet(key.ID, key)
+	}
+	return LoadKeySet(dir, os.Getenv("JWT_ACTIVE_KEY_ID"))
+}
@@ -2,8 +2,11 @@ package utils
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 	"users/models"
 
@@ -25,40 +28,116 @@ func StructToMap(data interface{}) map[string]interface{} {
 	return result
 }
 
-// GenerateJWT adds a unique jti claim so tokens can be revoked
+// DefaultAccessTokenTTL is used when ACCESS_TOKEN_TTL is not set.
+const DefaultAccessTokenTTL = 15 * time.Minute
+
+// AccessTokenTTL returns the lifetime of access tokens, configurable through
+// the ACCESS_TOKEN_TTL environment variable (a Go duration such as "10m").
+func AccessTokenTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("ACCESS_TOKEN_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return DefaultAccessTokenTTL
+}
+
+// GenerateJWT issues a short-lived access token. The jti claim lets the token be
+// revoked and sub carries the user ID; only non-sensitive profile fields are embedded.
 func GenerateJWT(user models.User) (string, error) {
-	userMap := StructToMap(user)
-	expirationTime := time.Now().Add(48 * time.Hour).Unix()
+	return generateJWT(user, nil)
+}
 
+// GenerateSessionJWT issues an access token for user that names its session
+// (refresh token family) in the sid claim, so revoking the session revokes it.
+func GenerateSessionJWT(user models.User, sessionID string) (string, error) {
+	return generateJWT(user, jwt.MapClaims{"sid": sessionID})
+}
+
+// GenerateDelegatedJWT issues an access token for user on behalf of a service
+// account, recorded in the act (actor) claim.
+func GenerateDelegatedJWT(user models.User, clientID string) (string, error) {
+	return generateJWT(user, jwt.MapClaims{"act": map[string]interface{}{"sub": clientID}})
+}
+
+func generateJWT(user models.User, extra jwt.MapClaims) (string, error) {
+	now := time.Now()
 	claims := jwt.MapClaims{
-		"user": userMap,
-		"exp":  expirationTime,
-		"iat":  time.Now().Unix(),
-		"jti":  uuid.NewString(), // unique token ID
+		"sub": strconv.Itoa(user.UserID),
+		"user": map[string]interface{}{
+			"UserID": user.UserID,
+			"Name":   user.Name,
+			"Email":  user.Email,
+			"Phone":  user.Phone,
+		},
+		"role":  string(user.CurrentRole()),
+		"perms": user.CurrentRole().Permissions(),
+		"exp":   now.Add(AccessTokenTTL()).Unix(),
+		"iat":   float64(now.UnixMicro()) / 1e6, // fractional so revocations can tell tokens of the same second apart
+		"jti":   uuid.NewString(),               // unique token ID
+	}
+	for k, v := range extra {
+		claims[k] = v
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	key := CurrentKeySet().Active()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	tokenString, err := token.SignedString(key.Key)
 	if err != nil {
 		return "", err
 	}
-
-	fmt.Println("Generated JWT for user:", user.Name, "| email:", user.Email)
-	fmt.Println("Token is:", tokenString)
 	return tokenString, nil
 }
 
+// ServiceTokenTTL is the lifetime of tokens the users service issues for its
+// own calls to other services.
+const ServiceTokenTTL = 5 * time.Minute
+
+// GenerateServiceJWT issues a token identifying the users service itself to
+// audience. Its sub is not a user ID, so it is rejected wherever a user token
+// is expected; token_use and scope tell the receiver what it may be used for.
+func GenerateServiceJWT(audience string, scopes ...string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":       "service:users",
+		"aud":       audience,
+		"token_use": "service",
+		"scope":     strings.Join(scopes, " "),
+		"exp":       now.Add(ServiceTokenTTL).Unix(),
+		"iat":       now.Unix(),
+		"jti":       uuid.NewString(),
+	}
+	key := CurrentKeySet().Active()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Key)
+}
+
+// IssuedAt reads the iat claim to the microsecond. claims.GetIssuedAt would
+// truncate it to the second.
+func IssuedAt(claims jwt.MapClaims) (time.Time, bool) {
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.UnixMicro(int64(math.Round(iat * 1e6))), true
+}
+
+// ParseJWT verifies a token against the key named by its kid header.
 func ParseJWT(tokenString string) (*jwt.Token, error) {
+	ks := CurrentKeySet()
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Ensure HMAC signing
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		pub, method, ok := ks.PublicKey(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(os.Getenv("JWT_SECRET")), nil
+		return pub, nil
 	})
 
 	if err != nil {
-		fmt.Println("Error parsing JWT:", err)
 		return nil, err
 	}
 	if !token.Valid {
@@ -1,7 +1,13 @@
 package main
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 	"users/models"
@@ -13,9 +19,6 @@ import (
 
 // TestGenerateJWT tests that we can generate a valid JWT from a user struct
 func TestGenerateJWT(t *testing.T) {
-	originalSecret := os.Getenv("JWT_SECRET")
-	defer os.Setenv("JWT_SECRET", originalSecret)
-	os.Setenv("JWT_SECRET", "testsecret")
 
 	user := models.User{
 		UserID: 42,
@@ -31,9 +34,6 @@ func TestGenerateJWT(t *testing.T) {
 
 // TestParseJWTValidToken checks that a valid token will parse correctly
 func TestParseJWTValidToken(t *testing.T) {
-	originalSecret := os.Getenv("JWT_SECRET")
-	defer os.Setenv("JWT_SECRET", originalSecret)
-	os.Setenv("JWT_SECRET", "testsecret")
 
 	user := models.User{
 		UserID: 42,
@@ -62,9 +62,6 @@ func TestParseJWTValidToken(t *testing.T) {
 
 // TestParseJWTInvalidToken checks that an invalid token fails
 func TestParseJWTInvalidToken(t *testing.T) {
-	originalSecret := os.Getenv("JWT_SECRET")
-	defer os.Setenv("JWT_SECRET", originalSecret)
-	os.Setenv("JWT_SECRET", "testsecret")
 	invalidToken := "abc.def.ghi"
 
 	token, err := utils.ParseJWT(invalidToken)
@@ -73,9 +70,6 @@ func TestParseJWTInvalidToken(t *testing.T) {
 }
 
 func TestExpiredToken(t *testing.T) {
-	originalSecret := os.Getenv("JWT_SECRET")
-	defer os.Setenv("JWT_SECRET", originalSecret)
-	os.Setenv("JWT_SECRET", "testsecret")
 
 	claims := jwt.MapClaims{
 		"user": map[string]interface{}{
@@ -87,11 +81,96 @@ func TestExpiredToken(t *testing.T) {
 		"iat": time.Now().Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte("testsecret"))
+	key := utils.CurrentKeySet().Active()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	tokenString, err := token.SignedString(key.Key)
 	assert.NoError(t, err, "Signing a test token should not fail")
 
 	parsedToken, parseErr := utils.ParseJWT(tokenString)
 	assert.Nil(t, parsedToken, "Parsed token should be nil for an expired token")
 	assert.Error(t, parseErr, "Should raise an error for an expired token")
 }
+
+// TestParseJWTRejectsHMAC checks that shared-secret tokens are no longer accepted
+func TestParseJWTRejectsHMAC(t *testing.T) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "42",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = utils.CurrentKeySet().Active().ID
+	tokenString, err := token.SignedString([]byte("testsecret"))
+	assert.NoError(t, err)
+
+	parsedToken, parseErr := utils.ParseJWT(tokenString)
+	assert.Nil(t, parsedToken)
+	assert.Error(t, parseErr)
+}
+
+// TestKeyRotation checks that tokens signed with a retired key stay valid while it is published
+func TestKeyRotation(t *testing.T) {
+	original := utils.CurrentKeySet()
+	defer utils.SetKeySet(original)
+
+	oldKey, err := utils.GenerateEd25519Key()
+	assert.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	newKey, err := utils.NewSigningKey("2025-rsa", rsaKey)
+	assert.NoError(t, err)
+
+	before, _ := utils.NewKeySet(oldKey.ID, oldKey)
+	utils.SetKeySet(before)
+	oldToken, err := utils.GenerateJWT(models.User{UserID: 7, Name: "Dina Woodward"})
+	assert.NoError(t, err)
+
+	after, err := utils.NewKeySet(newKey.ID, oldKey, newKey)
+	assert.NoError(t, err)
+	utils.SetKeySet(after)
+	newToken, err := utils.GenerateJWT(models.User{UserID: 7, Name: "Dina Woodward"})
+	assert.NoError(t, err)
+
+	parsed, err := utils.ParseJWT(newToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "RS256", parsed.Method.Alg())
+	assert.Equal(t, "2025-rsa", parsed.Header["kid"])
+	_, err = utils.ParseJWT(oldToken)
+	assert.NoError(t, err, "token signed with the previous key should still verify")
+
+	jwks := after.JWKS()
+	assert.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "2025-rsa", jwks.Keys[0].KeyID, "active key is listed first")
+	assert.Equal(t, "RSA", jwks.Keys[0].KeyType)
+	assert.Equal(t, "OKP", jwks.Keys[1].KeyType)
+
+	// Once the old key is retired its tokens are rejected.
+	retired, _ := utils.NewKeySet(newKey.ID, newKey)
+	utils.SetKeySet(retired)
+	_, err = utils.ParseJWT(oldToken)
+	assert.Error(t, err)
+}
+
+// TestLoadKeySet checks that PEM keys are loaded with their file name as kid
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+	for _, kid := range []string{"2024-01", "2025-01"} {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		assert.NoError(t, err)
+		der, err := x509.MarshalPKCS8PrivateKey(priv)
+		assert.NoError(t, err)
+		pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, kid+".pem"), pemBytes, 0o600))
+	}
+
+	ks, err := utils.LoadKeySet(dir, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "2025-01", ks.Active().ID)
+	assert.Len(t, ks.JWKS().Keys, 2)
+
+	ks, err = utils.LoadKeySet(dir, "2024-01")
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-01", ks.Active().ID)
+
+	_, err = utils.LoadKeySet(dir, "missing")
+	assert.Error(t, err)
+}
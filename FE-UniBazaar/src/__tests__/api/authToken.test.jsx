@@ -0,0 +1,47 @@
+import { describe, it, expect, vi, beforeEach } from "vitest";
+import axios from "axios";
+import { authHeaders, saveTokens, withAuth } from "@/api/authToken";
+
+vi.mock("axios");
+
+describe("authToken", () => {
+  beforeEach(() => {
+    vi.resetAllMocks();
+    localStorage.clear();
+  });
+
+  it("sends the saved access token", async () => {
+    saveTokens({ token: "access-1", refresh_token: "refresh-1" });
+    expect(authHeaders()).toEqual({ Authorization: "Bearer access-1" });
+
+    const request = vi.fn().mockResolvedValue({ data: "ok" });
+    await expect(withAuth(request)).resolves.toEqual({ data: "ok" });
+    expect(request).toHaveBeenCalledWith({ Authorization: "Bearer access-1" });
+  });
+
+  it("refreshes an expired token once and retries", async () => {
+    saveTokens({ token: "expired", refresh_token: "refresh-1" });
+    axios.post.mockResolvedValueOnce({ data: { token: "access-2", refresh_token: "refresh-2" } });
+    const request = vi
+      .fn()
+      .mockRejectedValueOnce({ response: { status: 401 } })
+      .mockResolvedValueOnce({ data: "ok" });
+
+    await expect(withAuth(request)).resolves.toEqual({ data: "ok" });
+    expect(axios.post.mock.calls[0][0].endsWith("/token/refresh")).toBe(true);
+    expect(axios.post.mock.calls[0][1]).toEqual({ refresh_token: "refresh-1" });
+    expect(request).toHaveBeenLastCalledWith({ Authorization: "Bearer access-2" });
+    expect(localStorage.getItem("refreshToken")).toBe("refresh-2");
+  });
+
+  it("does not retry other errors or without a refresh token", async () => {
+    const forbidden = { response: { status: 403 } };
+    saveTokens({ token: "access-1", refresh_token: "refresh-1" });
+    await expect(withAuth(vi.fn().mockRejectedValue(forbidden))).rejects.toBe(forbidden);
+
+    localStorage.clear();
+    const unauthorized = { response: { status: 401 } };
+    await expect(withAuth(vi.fn().mockRejectedValue(unauthorized))).rejects.toBe(unauthorized);
+    expect(axios.post).not.toHaveBeenCalled();
+  });
+});
@@ -1,4 +1,4 @@
-import { describe, test, expect, vi } from "vitest";
+import { describe, test, expect, vi, beforeEach, afterEach } from "vitest";
 import axios from "axios";
 import { getAllProductsAPI, postProductAPI } from "../../api/productAxios"; // Adjust import path if needed
 
@@ -11,8 +11,13 @@ describe("Product API Tests", () => {
     { id: "2", name: "Product 2", price: 20 },
   ];
 
+  beforeEach(() => {
+    localStorage.setItem("accessToken", "test-token");
+  });
+
   afterEach(() => {
     vi.clearAllMocks();
+    localStorage.clear();
   });
 
   test("getAllProductsAPI should return product data", async () => {
@@ -40,7 +45,9 @@ describe("Product API Tests", () => {
     const result = await postProductAPI(formData);
 
     expect(result).toEqual(mockResponse);
-    expect(axios.post).toHaveBeenCalledWith(expect.stringContaining("/products"), formData);
+    expect(axios.post).toHaveBeenCalledWith(expect.stringContaining("/products"), formData, {
+      headers: { Authorization: "Bearer test-token" },
+    });
   });
 
   test("postProductAPI should throw an error on failure", async () => {
@@ -1,5 +1,5 @@
 // src/__tests__/customComponents/WebSocket.test.jsx
-import { renderHook } from '@testing-library/react';
+import { renderHook, waitFor } from '@testing-library/react';
 import { describe, it, expect, vi, beforeEach, afterEach } from 'vitest';
 import useWebSocket from '@/customComponents/WebsocketConnection'; // Adjust path
 
@@ -31,12 +31,16 @@ describe('useWebSocket', () => {
     mockWebSocketInstance.close.mockClear();
   });
 
-  it('should connect to WebSocket when userId is provided', () => {
+  it('should connect to WebSocket when userId is provided', async () => {
+    // An unexpired access token, passed in the query because browsers cannot set headers.
+    const payload = btoa(JSON.stringify({ sub: userId, exp: Math.floor(Date.now() / 1000) + 600 }));
+    const token = `header.${payload}.signature`;
+    localStorage.setItem('accessToken', token);
+
     renderHook(() => useWebSocket(userId, onMessageReceived));
 
-    // --- Updated Assertion ---
-    const expectedUrl = `${EXPECTED_WS_URL_BASE}/ws?user_id=${userId}`;
-    expect(mockWebSocket).toHaveBeenCalledTimes(1);
+    const expectedUrl = `${EXPECTED_WS_URL_BASE}/ws?user_id=${userId}&token=${encodeURIComponent(token)}`;
+    await waitFor(() => expect(mockWebSocket).toHaveBeenCalledTimes(1));
     expect(mockWebSocket).toHaveBeenCalledWith(expectedUrl);
   });
 
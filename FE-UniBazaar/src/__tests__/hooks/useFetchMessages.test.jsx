@@ -18,6 +18,7 @@ describe('useFetchMessages', () => {
 
   beforeEach(() => {
     vi.clearAllMocks();
+    localStorage.setItem('accessToken', 'test-token');
     fetch.mockClear(); // Clear fetch mocks
     fetch.mockResolvedValue({ // Default successful mock
         ok: true,
@@ -36,7 +37,7 @@ describe('useFetchMessages', () => {
     // --- Updated Assertion ---
     const expectedUrl = `${EXPECTED_API_URL_BASE}/api/conversation/${userId}/${selectedUser.id}`;
     expect(global.fetch).toHaveBeenCalledTimes(1);
-    expect(global.fetch).toHaveBeenCalledWith(expectedUrl);
+    expect(global.fetch).toHaveBeenCalledWith(expectedUrl, { headers: { Authorization: 'Bearer test-token' } });
 
     // Wait for the fetch promise to resolve and state update to happen
     await act(async () => {
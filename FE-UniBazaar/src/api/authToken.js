@@ -0,0 +1,86 @@
+import axios from "axios";
+
+const USER_BASE_URL = import.meta.env.VITE_USER_BASE_URL;
+const ACCESS_TOKEN_KEY = "accessToken";
+const REFRESH_TOKEN_KEY = "refreshToken";
+
+// Refresh a little before the access token expires so requests in flight don't fail.
+const EXPIRY_MARGIN_MS = 30 * 1000;
+
+// Keeps the tokens returned by /login and /token/refresh.
+export const saveTokens = ({ token, refresh_token }) => {
+  if (token) localStorage.setItem(ACCESS_TOKEN_KEY, token);
+  if (refresh_token) localStorage.setItem(REFRESH_TOKEN_KEY, refresh_token);
+};
+
+export const clearTokens = () => {
+  localStorage.removeItem(ACCESS_TOKEN_KEY);
+  localStorage.removeItem(REFRESH_TOKEN_KEY);
+};
+
+export const getAccessToken = () => localStorage.getItem(ACCESS_TOKEN_KEY) || "";
+
+export const authHeaders = () => {
+  const token = getAccessToken();
+  return token ? { Authorization: `Bearer ${token}` } : {};
+};
+
+const tokenExpiresSoon = (token) => {
+  try {
+    const payload = JSON.parse(atob(token.split(".")[1].replace(/-/g, "+").replace(/_/g, "/")));
+    return !payload.exp || payload.exp * 1000 - Date.now() < EXPIRY_MARGIN_MS;
+  } catch {
+    return true;
+  }
+};
+
+let refreshing = null;
+
+// Trades the refresh token for a new token pair. Concurrent callers share one
+// request, since the users service revokes a refresh token that is used twice.
+export const refreshAccessToken = () => {
+  const refreshToken = localStorage.getItem(REFRESH_TOKEN_KEY);
+  if (!refreshToken) {
+    return Promise.reject(new Error("Not signed in."));
+  }
+  if (!refreshing) {
+    refreshing = axios
+      .post(USER_BASE_URL + "/token/refresh", { refresh_token: refreshToken })
+      .then((response) => {
+        saveTokens(response.data);
+        return response.data.token;
+      })
+      .catch((error) => {
+        clearTokens();
+        throw error;
+      })
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+};
+
+// Returns an access token that is not about to expire, refreshing it if needed.
+// Used where a 401 cannot be retried, such as the WebSocket upgrade.
+export const freshAccessToken = async () => {
+  const token = getAccessToken();
+  if (token && !tokenExpiresSoon(token)) {
+    return token;
+  }
+  return refreshAccessToken().catch(() => token);
+};
+
+// Runs request with the bearer token headers and, if the token was rejected,
+// once more after refreshing it.
+export const withAuth = async (request) => {
+  try {
+    return await request(authHeaders());
+  } catch (error) {
+    if (error?.response?.status !== 401 || !localStorage.getItem(REFRESH_TOKEN_KEY)) {
+      throw error;
+    }
+    await refreshAccessToken();
+    return request(authHeaders());
+  }
+};
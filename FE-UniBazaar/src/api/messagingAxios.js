@@ -1,10 +1,10 @@
 import axios from "axios";
+import { withAuth } from "@/api/authToken";
 
 const CHAT_USERS_BASE_URL = import.meta.env.VITE_CHAT_USERS_BASE_URL;
 
 export const getAllUsersAPI = () => {
-    return axios
-      .get(CHAT_USERS_BASE_URL + "/users")
+    return withAuth((headers) => axios.get(CHAT_USERS_BASE_URL + "/users", { headers }))
       .then((response) => {
         return response.data; 
       })
@@ -14,23 +14,6 @@ export const getAllUsersAPI = () => {
       });
   };
 
-  export const syncUserToMessagingAPI = (userData) => {
-    if (!CHAT_USERS_BASE_URL) {
-      console.error("Messaging service URL (VITE_CHAT_USERS_BASE_URL) is not defined.");
-      return Promise.reject(new Error("Messaging service URL is not configured."));
-    }
-  
-    return axios
-      .post(CHAT_USERS_BASE_URL + "/api/users/sync", userData) 
-      .then((response) => {
-        console.log("User sync successful:", response.data);
-        return response.data; 
-      })
-      .catch((error) => {
-        console.error("Error syncing user to messaging service:", error);
-      });
-  };
-
   export const getUnreadSendersAPI = (userId) => { 
     if (!CHAT_USERS_BASE_URL) {
         console.error("Messaging service URL (VITE_CHAT_USERS_BASE_URL) is not defined.");
@@ -43,8 +26,7 @@ export const getAllUsersAPI = () => {
 
     const url = `${CHAT_USERS_BASE_URL}/api/unread-senders?user_id=${userId}`;
 
-    return axios
-        .get(url) 
+    return withAuth((headers) => axios.get(url, { headers }))
         .then((response) => {
             if (response.data && Array.isArray(response.data.senderIds)) {
                 return response.data.senderIds;
@@ -1,5 +1,6 @@
 import axios from "axios";
 import { toast } from "react-toastify";
+import { withAuth } from "@/api/authToken";
 
 const PRODUCT_BASE_URL = import.meta.env.VITE_PRODUCT_BASE_URL;
 
@@ -21,8 +22,9 @@ export const getAllProductsAPI = async (limit, lastId) => {
 
 export const postProductAPI = async (formData) => {
   try {
-    const response = await axios
-      .post(PRODUCT_BASE_URL + "/products", formData);
+    const response = await withAuth((headers) =>
+      axios.post(PRODUCT_BASE_URL + "/products", formData, { headers })
+    );
     toast.success("Product posted successfully!");
     return response.data;
   } catch (error) {
@@ -34,7 +36,9 @@ export const postProductAPI = async (formData) => {
 
 export const updateProductAPI = async (userId, productId, formData) => {
   try {
-    const response = await axios.put(`${PRODUCT_BASE_URL}/products/${userId}/${productId}`, formData);
+    const response = await withAuth((headers) =>
+      axios.put(`${PRODUCT_BASE_URL}/products/${userId}/${productId}`, formData, { headers })
+    );
     toast.success("Product updated successfully!");
     return response.data;
   } catch (error) {
@@ -81,7 +85,9 @@ export const searchProductsAPI = async (query, limit) => {
 
 export const deleteProductAPI = async (userId, productId) => {
   try {
-    const response = await axios.delete(`${PRODUCT_BASE_URL}/products/${userId}/${productId}`);
+    const response = await withAuth((headers) =>
+      axios.delete(`${PRODUCT_BASE_URL}/products/${userId}/${productId}`, { headers })
+    );
     toast.success("Product deleted successfully!");
     return response.data;
   } catch (error) {
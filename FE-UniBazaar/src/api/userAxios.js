@@ -1,4 +1,5 @@
 import axios from "axios";
+import { clearTokens, saveTokens, withAuth } from "@/api/authToken";
 
 const USER_BASE_URL = import.meta.env.VITE_USER_BASE_URL;
 
@@ -10,6 +11,7 @@ export const userLoginAPI = ({ userLoginObject }) => {
       if (userData.userId) {
         localStorage.setItem("userId", userData.userId);
       }
+      saveTokens(userData);
       return userData;
     })
     .catch((error) => {
@@ -17,6 +19,15 @@ export const userLoginAPI = ({ userLoginObject }) => {
       throw error.response?.data?.message || error;
     });
 };
+// Ends the session on the server as well; the tokens are dropped either way.
+export const userLogoutAPI = () => {
+  return withAuth((headers) => axios.post(USER_BASE_URL + "/logout", null, { headers }))
+    .catch((error) => {
+      console.error("Error logging out:", error);
+    })
+    .finally(clearTokens);
+};
+
 export const userRegisterAPI = ({ userRegisterObject }) => {
   console.log("Register Recevied Obj", userRegisterObject);
   return axios
@@ -56,10 +67,9 @@ export const userResendAPI = (userVerificationObject) => {
     });
 };
 
-export const userProfileDetailsAPI = (userId) => {
-  console.log(userId);
+export const userProfileDetailsAPI = (publicId) => {
   return axios
-    .get(`${USER_BASE_URL}/displayUser/${userId}`)
+    .get(`${USER_BASE_URL}/displayUser/${publicId}`)
     .then((response) => response.data)
     .catch((error) => {
       console.error("Error fetching data", error);
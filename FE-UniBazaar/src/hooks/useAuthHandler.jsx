@@ -1,6 +1,5 @@
 import { userLoginAPI, userRegisterAPI } from "@/api/userAxios";
 import { useUserAuth } from "@/hooks/useUserAuth";
-import { syncUserToMessagingAPI } from "../api/messagingAxios"; 
 import { useState } from "react";
 
 export function useAuthHandler({ toggleModal }) {
@@ -50,20 +49,8 @@ export function useAuthHandler({ toggleModal }) {
           setSuccessMessage("Login successful! Redirecting to Home...");
 
           
-          useAuth.loginUser(data); 
-
-          if (data.userId && data.name && data.email) {
-            syncUserToMessagingAPI({
-              id: data.userId,
-              name: data.name,
-              email: data.email,
-            }).catch(syncError => {
-              // Log the error, but usually don't block the login flow
-              console.error("Failed to sync user to messaging service (non-blocking):", syncError);
-            });
-          } else {
-            console.warn("Login successful, but missing details (userId, name, email) in response. Cannot sync to messaging.");
-          }
+          // The users service pushes the account to messaging itself.
+          useAuth.loginUser(data);
 
           setTimeout(() => {
             setSuccessMessage("");
@@ -1,4 +1,5 @@
 import { useEffect } from 'react'; 
+import { authHeaders, refreshAccessToken } from '@/api/authToken';
 const CHAT_USERS_BASE_URL = import.meta.env.VITE_CHAT_USERS_BASE_URL;
 
 
@@ -12,7 +13,12 @@ export const useFetchMessages = (userId, selectedUser, setMessages) => {
             try {
                 const url = `${CHAT_USERS_BASE_URL}/api/conversation/${userId}/${selectedUser.id}`;
                 console.log("Fetching messages from:", url);
-                const res = await fetch(url);
+                let res = await fetch(url, { headers: authHeaders() });
+                if (res.status === 401) {
+                    // The access token expired; retry once with a refreshed one.
+                    await refreshAccessToken();
+                    res = await fetch(url, { headers: authHeaders() });
+                }
 
                 if (!res.ok) {
                     const errorData = await res.json().catch(() => null);
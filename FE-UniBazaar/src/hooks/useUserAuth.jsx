@@ -1,4 +1,5 @@
 import { createContext, useContext, useState } from "react";
+import { userLogoutAPI } from "@/api/userAxios";
 
 const AuthContext = createContext(null);
 
@@ -8,8 +9,14 @@ export const AuthProvider = ({ children }) => {
     const match = document.cookie.match(/(?:^|;\s*)userId=([^;]*)/);
     return match ? decodeURIComponent(match[1]) : "";
   };
+  // Helper: Get the public user ID (used for profile lookups) from cookie
+  const getPublicIdFromCookie = () => {
+    const match = document.cookie.match(/(?:^|;\s*)publicId=([^;]*)/);
+    return match ? decodeURIComponent(match[1]) : "";
+  };
 
   const [userID, setUserID] = useState(getUserIdFromCookie());
+  const [publicID, setPublicID] = useState(getPublicIdFromCookie());
   const [userState, setUserState] = useState(!!getUserIdFromCookie());
 
   const loginUser = (userData) => {
@@ -26,12 +33,21 @@ export const AuthProvider = ({ children }) => {
     document.cookie = `userId=${encodeURIComponent(
       id
     )}; expires=${expires}; path=/`;
+
+    const publicId = userData?.public_id || "";
+    setPublicID(publicId);
+    document.cookie = `publicId=${encodeURIComponent(
+      publicId
+    )}; expires=${expires}; path=/`;
   };
 
   const logoutUser = () => {
+    userLogoutAPI();
     setUserID("");
+    setPublicID("");
     setUserState(false);
     document.cookie = "userId=; expires=Thu, 01 Jan 1970 00:00:00 UTC; path=/;";
+    document.cookie = "publicId=; expires=Thu, 01 Jan 1970 00:00:00 UTC; path=/;";
     const currentPath = location.pathname;
     if (
       currentPath.startsWith("/sell") ||
@@ -42,7 +58,7 @@ export const AuthProvider = ({ children }) => {
   };
 
   return (
-    <AuthContext.Provider value={{ userID, userState, loginUser, logoutUser }}>
+    <AuthContext.Provider value={{ userID, publicID, userState, loginUser, logoutUser }}>
       {children}
     </AuthContext.Provider>
   );
@@ -6,7 +6,7 @@ import { Label } from "@/components/ui/label";
 import { Avatar, AvatarFallback, AvatarImage } from "@/components/ui/avatar";
 
 function ViewMyProfilePage() {
-  const { userID } = useUserAuth();
+  const { publicID } = useUserAuth();
   const [profile, setProfile] = useState({ name: "", email: "", phone: "" });
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState("");
@@ -17,9 +17,9 @@ function ViewMyProfilePage() {
       setError("");
 
       try {
-        if (!userID) throw new Error("No user ID found");
+        if (!publicID) throw new Error("No user ID found");
 
-        const res = await userProfileDetailsAPI(userID);
+        const res = await userProfileDetailsAPI(publicID);
 
         setProfile({
           name: res.name,
@@ -35,7 +35,7 @@ function ViewMyProfilePage() {
     };
 
     fetchProfile();
-  }, [userID]);
+  }, [publicID]);
 
   return (
     <div className="w-full h-full flex justify-center items-center">